@@ -2,16 +2,25 @@ package block
 
 import (
 	"bytes"
+	"context"
 	"crypto/ecdsa"
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"goblockchain/utils"
-	"log"
+	"io"
+	"log/slog"
+	"math/big"
+	"net"
 	"net/http"
+	"runtime"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -25,93 +34,550 @@ const (
 	NeighborIpRangeStart     = 0
 	NeighborIpRangeEnd       = 1
 	ChainNeighborSyncTimeSec = 20
+	BlockVersion             = 2
+	MaxTransactionsPerBlock  = 100
+	MinimumFee               = 0.001
+	MinTxToMine              = 5
+	LocktimeThreshold        = 500000000 // below: block height, at or above: unix time
+	DefaultScheme            = "http"
+	MaxMempoolSize           = 5000
+	MaxBlockBytes            = 1 << 20
 )
 
+// Reasons AddTransaction rejects a transaction.
+var (
+	ErrDuplicateTransaction = errors.New("duplicate transaction")
+	ErrNegativeFee          = errors.New("fee must not be negative")
+	ErrInvalidRecipient     = errors.New("invalid recipient address")
+	ErrInvalidSignature     = errors.New("invalid signature")
+	ErrInsufficientBalance  = errors.New("insufficient balance")
+	ErrMempoolFull          = errors.New("transaction pool is full and the fee is too low to replace any pending transaction")
+	ErrReplayedTransaction  = errors.New("transaction sequence was already used by the sender")
+	ErrSequenceGap          = errors.New("transaction sequence skips ahead of the sender's next")
+	ErrCoinbaseTransaction  = errors.New("coinbase transactions are only created by miners")
+)
+
+// Reasons AcceptBlock rejects a block.
+var (
+	ErrInvalidBlock    = errors.New("invalid block")
+	ErrStaleBlock      = errors.New("block does not extend the tip of our chain")
+	ErrUnknownAncestor = errors.New("block builds on a block we don't have")
+)
+
+// Difficulty is retargeted every DifficultyAdjustmentInterval blocks.
+const DifficultyAdjustmentInterval = 10
+
+// The coinbase reward halves every HalvingInterval blocks.
+const HalvingInterval = 100000
+
+// A coinbase output created at height h can only be spent in a block at
+// height h+CoinbaseMaturity or above.
+const CoinbaseMaturity = 10
+
+// MaxClockDrift is how far ahead of our clock a block timestamp may be.
+const MaxClockDrift = 2 * time.Hour
+
+// NeighborTimeout bounds every HTTP call to a neighbor, so a dead peer
+// can't stall mining or sync.
+const NeighborTimeout = 5 * time.Second
+
+// Failed neighbor calls are retried up to NeighborRetryAttempts times in
+// total, waiting NeighborRetryDelay and doubling the wait after each try.
+const (
+	NeighborRetryAttempts = 3
+	NeighborRetryDelay    = 200 * time.Millisecond
+)
+
+// Pending transactions older than TransactionTTL are dropped from the pool.
+const TransactionTTL = 72 * time.Hour
+
 type Block struct {
+	version      int
+	height       int
 	timestamp    int64
 	nonce        int
+	difficulty   int
 	previousHash [32]byte
+	merkleRoot   [32]byte
 	transactions []*Transaction
+	pruned       bool
+	// The header hash is cached on first use; blocks do not change once
+	// they are built or decoded.
+	hash      [32]byte
+	hashValid bool
+	muxHash   sync.Mutex
 }
 
 func NewBlock(nonce int, previousHash [32]byte, transactions []*Transaction) *Block {
 	return &Block{
+		version:      BlockVersion,
 		timestamp:    time.Now().UnixNano(),
 		nonce:        nonce,
+		difficulty:   MiningDifficulty,
 		previousHash: previousHash,
+		merkleRoot:   merkleRoot(transactions),
 		transactions: transactions,
 	}
 }
 func (b *Block) Print() {
+	fmt.Printf("version       	%d\n", b.version)
 	fmt.Printf("timestamp     	%d\n", b.timestamp)
 	fmt.Printf("nonce         	%d\n", b.nonce)
+	fmt.Printf("difficulty    	%d\n", b.difficulty)
 	fmt.Printf("previous_hash 	%x\n", b.previousHash)
+	fmt.Printf("merkle_root   	%x\n", b.merkleRoot)
 	for _, t := range b.transactions {
 		t.Print()
 	}
 }
 func (b *Block) Hash() [32]byte {
+	b.muxHash.Lock()
+	defer b.muxHash.Unlock()
+	if !b.hashValid {
+		b.hash = b.Header().Hash()
+		b.hashValid = true
+	}
+	return b.hash
+}
+func (b *Block) invalidateHash() {
+	b.muxHash.Lock()
+	defer b.muxHash.Unlock()
+	b.hashValid = false
+}
+func (b *Block) SaltedHash(salt string) [32]byte {
+	return b.Header().SaltedHash(salt)
+}
+func (b *Block) Header() *BlockHeader {
+	return &BlockHeader{
+		Version:      b.version,
+		Height:       b.height,
+		Timestamp:    b.timestamp,
+		Nonce:        b.nonce,
+		Difficulty:   b.difficulty,
+		PreviousHash: b.previousHash,
+		MerkleRoot:   b.merkleRoot,
+	}
+}
+func (b *Block) serializedSize() int {
 	m, _ := json.Marshal(b)
-	return sha256.Sum256([]byte(m))
+	return len(m)
 }
 func (b *Block) MarshalJSON() ([]byte, error) {
 	return json.Marshal(struct {
+		Version      int            `json:"version"`
+		Height       int            `json:"height"`
 		Timestamp    int64          `json:"timestamp"`
 		Nonce        int            `json:"nonce"`
-		PreviousHash string         `json:"previous-hash"`
+		Difficulty   int            `json:"difficulty"`
+		PreviousHash string         `json:"previous_hash"`
+		MerkleRoot   string         `json:"merkle_root"`
 		Transactions []*Transaction `json:"transactions"`
+		Pruned       bool           `json:"pruned,omitempty"`
 	}{
+		Version:      b.version,
+		Height:       b.height,
 		Timestamp:    b.timestamp,
 		Nonce:        b.nonce,
+		Difficulty:   b.difficulty,
 		PreviousHash: fmt.Sprintf("%x", b.previousHash),
+		MerkleRoot:   fmt.Sprintf("%x", b.merkleRoot),
 		Transactions: b.transactions,
+		Pruned:       b.pruned,
 	})
 }
 
 type Blockchain struct {
-	transactionPool   []*Transaction
-	chain             []*Block
-	blockchainAddress string
-	port              uint16
-	mux               sync.Mutex
-	neighbors         []string
-	muxNeighbors      sync.Mutex
+	transactionPool         []*Transaction
+	chain                   []*Block
+	blockchainAddress       string
+	port                    uint16
+	scheme                  string
+	difficulty              int
+	mux                     sync.Mutex
+	neighbors               []string
+	registeredNeighbors     []string
+	muxNeighbors            sync.RWMutex
+	genesis                 GenesisConfig
+	miningCancel            context.CancelFunc
+	muxMining               sync.Mutex
+	muxMine                 sync.Mutex
+	minTxToMine             int
+	maxMiningWait           time.Duration
+	events                  eventBus
+	autosavePath            string
+	maxTransactionsPerBlock int
+	maxBlockBytes           int
+	maxClockDrift           time.Duration
+	miningWorkers           int
+	halvingInterval         int
+	coinbaseMaturity        int
+	maxMempoolSize          int
+	transactionTTL          time.Duration
+	now                     func() time.Time
+	client                  *http.Client
+	retryAttempts           int
+	retryDelay              time.Duration
+	peerHealth              map[string]*peerHealth
+	seen                    *seenSet
+	orphans                 *orphanPool
+	balanceCheck            bool
+	healthInterval          time.Duration
+	maxPeerFailures         int
+	stop                    chan struct{}
+	stopOnce                sync.Once
+	startMining             sync.Once
+	startSync               sync.Once
+	synced                  atomic.Bool
+	miningStarted           atomic.Bool
+	keepBlocks              int
+	// muxChain guards chain and the indexes derived from it: the embedded
+	// chainIndex of the whole chain and pruned, the index of the blocks
+	// whose transactions were pruned.
+	*chainIndex
+	pruned   *chainIndex
+	muxChain sync.RWMutex
 }
 
-func NewBlockchain(blockchainAddress string, port uint16) *Blockchain {
-	b := &Block{}
+func NewBlockchain(blockchainAddress string, port uint16, scheme string) *Blockchain {
+	return NewBlockchainWithGenesis(blockchainAddress, port, scheme, GenesisConfig{})
+}
+func NewBlockchainWithGenesis(blockchainAddress string, port uint16, scheme string, genesis GenesisConfig) *Blockchain {
 	bc := new(Blockchain)
 	bc.blockchainAddress = blockchainAddress
-	bc.CreateBlock(0, b.Hash())
+	if scheme == "" {
+		scheme = DefaultScheme
+	}
+	bc.scheme = scheme
+	bc.difficulty = MiningDifficulty
+	bc.genesis = genesis.withDefaults()
+	bc.chainIndex = newChainIndex()
+	bc.pruned = newChainIndex()
+	bc.minTxToMine = MinTxToMine
+	bc.maxMiningWait = MiningTimeSec * time.Second
+	bc.maxTransactionsPerBlock = MaxTransactionsPerBlock
+	bc.maxBlockBytes = MaxBlockBytes
+	bc.maxClockDrift = MaxClockDrift
+	bc.miningWorkers = runtime.NumCPU()
+	bc.halvingInterval = HalvingInterval
+	bc.coinbaseMaturity = CoinbaseMaturity
+	bc.maxMempoolSize = MaxMempoolSize
+	bc.transactionTTL = TransactionTTL
+	bc.now = time.Now
+	bc.client = &http.Client{Timeout: NeighborTimeout}
+	bc.retryAttempts = NeighborRetryAttempts
+	bc.retryDelay = NeighborRetryDelay
+	bc.peerHealth = make(map[string]*peerHealth)
+	bc.seen = newSeenSet(SeenTransactionsSize)
+	bc.orphans = newOrphanPool(MaxOrphanBlocks)
+	bc.balanceCheck = true
+	bc.healthInterval = PeerHealthInterval
+	bc.maxPeerFailures = PeerMaxFailures
+	bc.stop = make(chan struct{})
+	genesisBlock := bc.genesis.Block()
+	bc.muxChain.Lock()
+	bc.chain = append(bc.chain, genesisBlock)
+	bc.applyBlock(genesisBlock)
+	bc.muxChain.Unlock()
 	bc.port = port
 	return bc
 }
+
+// SetClock replaces time.Now for block timestamps, transaction finality,
+// expiry and clock drift checks, so tests can control time.
+func (bc *Blockchain) SetClock(now func() time.Time) {
+	bc.now = now
+}
+func (bc *Blockchain) Scheme() string {
+	return bc.scheme
+}
+func (bc *Blockchain) neighborEndpoint(neighbor string, path string) string {
+	return fmt.Sprintf("%s://%s%s", bc.scheme, neighbor, path)
+}
+
+// SetNeighborTimeout sets the timeout for each HTTP call to a neighbor.
+func (bc *Blockchain) SetNeighborTimeout(d time.Duration) {
+	bc.client = &http.Client{Timeout: d}
+}
+
+// SetNeighborRetry sets how many times a neighbor call is attempted and
+// the delay before the first retry.
+func (bc *Blockchain) SetNeighborRetry(attempts int, baseDelay time.Duration) {
+	if attempts < 1 {
+		attempts = 1
+	}
+	bc.retryAttempts = attempts
+	bc.retryDelay = baseDelay
+}
+
+// statusError is a neighbor response outside 2xx.
+type statusError struct {
+	method string
+	path   string
+	status string
+	code   int
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("%s %s: %s", e.method, e.path, e.status)
+}
+
+// retryable reports whether err may go away on its own: network errors,
+// throttling and server errors. A 4xx means the neighbor rejected the
+// request and sending it again won't help.
+func retryable(err error) bool {
+	var se *statusError
+	if errors.As(err, &se) {
+		return se.code == http.StatusTooManyRequests || se.code >= 500
+	}
+	return true
+}
+
+// withRetry calls fn until it succeeds, fails permanently or has been tried
+// attempts times, doubling the delay between tries. It gives up early once
+// ctx is done or the blockchain is stopped.
+func (bc *Blockchain) withRetry(ctx context.Context, attempts int, delay time.Duration, fn func() error) error {
+	var err error
+	for i := 0; i < attempts; i++ {
+		if err = fn(); err == nil || !retryable(err) {
+			return err
+		}
+		if i == attempts-1 {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-bc.stop:
+			return err
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+	return err
+}
+
+// broadcast sends the same request to every neighbor except except, in
+// parallel, retrying transient failures, and returns once each has
+// succeeded or given up.
+func (bc *Blockchain) broadcast(ctx context.Context, method string, path string, body []byte, except string) {
+	var wg sync.WaitGroup
+	self := bc.selfAddress()
+	for _, n := range bc.Neighbors() {
+		if except != "" && sameNode(n, except) {
+			continue
+		}
+		wg.Add(1)
+		go func(n string) {
+			defer wg.Done()
+			err := bc.withRetry(ctx, bc.retryAttempts, bc.retryDelay, func() error {
+				return bc.sendToNeighbor(ctx, method, n, path, body, self)
+			})
+			if err != nil {
+				slog.Warn("neighbor request failed", "neighbor", n, "method", method, "path", path, "error", err)
+			}
+		}(n)
+	}
+	wg.Wait()
+}
+
+// sendToNeighbor makes one request to a neighbor, setting X-Relay-From to
+// from, our own address, and discards the response body. Any non-2xx status is returned as a
+// *statusError.
+func (bc *Blockchain) sendToNeighbor(ctx context.Context, method string, neighbor string, path string, body []byte, from string) error {
+	req, err := http.NewRequestWithContext(ctx, method, bc.neighborEndpoint(neighbor, path), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set(RelayFromHeader, from)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := bc.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return &statusError{method: method, path: path, status: resp.Status, code: resp.StatusCode}
+	}
+	return nil
+}
+
+// Chain returns the current chain. Blocks are never modified once added, so
+// the result stays consistent while new blocks are appended or the chain is
+// replaced.
 func (bc *Blockchain) Chain() []*Block {
-	return bc.chain
+	bc.muxChain.RLock()
+	defer bc.muxChain.RUnlock()
+	// Cap the slice so a caller's append can't write into our array.
+	return bc.chain[:len(bc.chain):len(bc.chain)]
 }
-func (bc *Blockchain) Run() {
-	bc.StartSyncNeighbors()
+
+// Run starts the background neighbor sync, which lasts until ctx is done or
+// Stop is called.
+func (bc *Blockchain) Run(ctx context.Context) {
+	bc.StartSyncNeighbors(ctx)
+}
+func (bc *Blockchain) SetNeighbors(ctx context.Context) {
+	// Scan without the lock; probing the range can take a while.
+	neighbors := utils.FindNeighbors(utils.GetHost(), bc.port, NeighborIpRangeStart, NeighborIpRangeEnd, BlockchainPortRangeStart, BlockchainPortRangeEnd)
+	// Manually registered peers survive every rescan of the local range.
+	bc.muxNeighbors.RLock()
+	for _, n := range bc.registeredNeighbors {
+		if !containsNeighbor(neighbors, n) {
+			neighbors = append(neighbors, n)
+		}
+	}
+	bc.muxNeighbors.RUnlock()
+	neighbors = bc.compatibleNeighbors(ctx, neighbors)
+	bc.muxNeighbors.Lock()
+	defer bc.muxNeighbors.Unlock()
+	bc.neighbors = neighbors
+	// Every neighbor just passed the handshake, so start it with a clean
+	// health record.
+	bc.peerHealth = make(map[string]*peerHealth)
+	slog.Debug("neighbors updated", "neighbors", bc.neighbors)
+}
+
+// Neighbors returns a snapshot of the neighbor list that callers may iterate
+// without holding any lock.
+func (bc *Blockchain) Neighbors() []string {
+	bc.muxNeighbors.RLock()
+	defer bc.muxNeighbors.RUnlock()
+	neighbors := make([]string, len(bc.neighbors))
+	copy(neighbors, bc.neighbors)
+	return neighbors
 }
-func (bc *Blockchain) SetNeighbors() {
-	bc.neighbors = utils.FindNeighbors(utils.GetHost(), bc.port, NeighborIpRangeStart, NeighborIpRangeEnd, BlockchainPortRangeStart, BlockchainPortRangeEnd)
-	log.Printf("%v", bc.neighbors)
+
+// RegisterNeighbor adds a host:port peer that is kept across neighbor
+// syncs. Registering a known peer again is a no-op.
+func (bc *Blockchain) RegisterNeighbor(address string) error {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if host == "" {
+		return fmt.Errorf("missing host in %q", address)
+	}
+	p, err := strconv.ParseUint(port, 10, 16)
+	if err != nil || p == 0 {
+		return fmt.Errorf("invalid port in %q", address)
+	}
+	if utils.IsSelf(host, uint16(p), utils.GetHost(), bc.port) {
+		return fmt.Errorf("%q is this node", address)
+	}
+	bc.muxNeighbors.Lock()
+	defer bc.muxNeighbors.Unlock()
+	if !containsNeighbor(bc.registeredNeighbors, address) {
+		bc.registeredNeighbors = append(bc.registeredNeighbors, address)
+	}
+	if !containsNeighbor(bc.neighbors, address) {
+		bc.neighbors = append(bc.neighbors, address)
+	}
+	return nil
 }
-func (bc *Blockchain) SyncNeighbors() {
+func (bc *Blockchain) RemoveNeighbor(address string) bool {
 	bc.muxNeighbors.Lock()
 	defer bc.muxNeighbors.Unlock()
-	bc.SetNeighbors()
+	var registered, found bool
+	bc.registeredNeighbors, registered = removeNeighbor(bc.registeredNeighbors, address)
+	bc.neighbors, found = removeNeighbor(bc.neighbors, address)
+	delete(bc.peerHealth, address)
+	return registered || found
 }
-func (bc *Blockchain) StartSyncNeighbors() {
-	bc.SyncNeighbors()
-	_ = time.AfterFunc(time.Second*ChainNeighborSyncTimeSec, bc.StartSyncNeighbors)
+func containsNeighbor(neighbors []string, address string) bool {
+	for _, n := range neighbors {
+		if n == address {
+			return true
+		}
+	}
+	return false
 }
-func (bc *Blockchain) MarshalJSON() ([]byte, error) {
-	return json.Marshal(struct {
-		Blocks []*Block `json:"chains"`
-	}{
-		Blocks: bc.chain,
+func removeNeighbor(neighbors []string, address string) ([]string, bool) {
+	kept := make([]string, 0, len(neighbors))
+	for _, n := range neighbors {
+		if n != address {
+			kept = append(kept, n)
+		}
+	}
+	return kept, len(kept) != len(neighbors)
+}
+func (bc *Blockchain) SyncNeighbors(ctx context.Context) {
+	bc.SetNeighbors(ctx)
+}
+
+// StartSyncNeighbors refreshes the neighbor list now and then every
+// ChainNeighborSyncTimeSec until ctx is done or Stop is called, and health
+// checks the neighbors in between. Later calls are no-ops.
+func (bc *Blockchain) StartSyncNeighbors(ctx context.Context) {
+	bc.startSync.Do(func() {
+		if bc.stopped() || ctx.Err() != nil {
+			return
+		}
+		bc.SyncNeighbors(ctx)
+		bc.synced.Store(true)
+		go bc.syncNeighborsLoop(ctx)
+		go bc.healthCheckLoop(ctx)
 	})
 }
+
+// Synced reports whether the initial neighbor sync has completed.
+func (bc *Blockchain) Synced() bool {
+	return bc.synced.Load()
+}
+func (bc *Blockchain) syncNeighborsLoop(ctx context.Context) {
+	ticker := time.NewTicker(time.Second * ChainNeighborSyncTimeSec)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-bc.stop:
+			return
+		case <-ticker.C:
+			bc.SyncNeighbors(ctx)
+		}
+	}
+}
+
+// Stop ends the background mining and neighbor sync loops and cancels any
+// proof of work in progress. It is safe to call more than once.
+func (bc *Blockchain) Stop() {
+	bc.stopOnce.Do(func() {
+		close(bc.stop)
+	})
+	bc.cancelMining()
+}
+
+// Done returns a channel that is closed once Stop is called.
+func (bc *Blockchain) Done() <-chan struct{} {
+	return bc.stop
+}
+func (bc *Blockchain) stopped() bool {
+	select {
+	case <-bc.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// MarshalJSON writes the chain, along with the index of its pruned blocks
+// if it has any so that a peer can still adopt it.
+func (bc *Blockchain) MarshalJSON() ([]byte, error) {
+	v := struct {
+		Blocks []*Block    `json:"chain"`
+		Pruned *chainIndex `json:"pruned,omitempty"`
+	}{}
+	bc.muxChain.RLock()
+	v.Blocks = bc.chain[:len(bc.chain):len(bc.chain)]
+	if bc.pruned != nil && bc.pruned.height > 0 {
+		v.Pruned = bc.pruned
+	}
+	bc.muxChain.RUnlock()
+	return json.Marshal(v)
+}
 func (b *Block) PreviousHash() [32]byte {
 	return b.previousHash
 }
@@ -121,215 +587,1268 @@ func (b *Block) Transactions() []*Transaction {
 func (b *Block) Nonce() int {
 	return b.nonce
 }
+func (b *Block) Height() int {
+	return b.height
+}
+func (b *Block) Version() int {
+	return b.version
+}
+func (b *Block) Difficulty() int {
+	return b.difficulty
+}
 func (bc *Blockchain) CreateBlock(nonce int, previousHash [32]byte) *Block {
-	b := NewBlock(nonce, previousHash, bc.transactionPool)
-	bc.chain = append(bc.chain, b)
-	bc.transactionPool = []*Transaction{}
-	for _, n := range bc.neighbors {
-		endpoint := fmt.Sprintf("https://%s/transaction", n)
-		client := &http.Client{}
-		req, _ := http.NewRequest("DELETE", endpoint, nil)
-		resp, _ := client.Do(req)
-		log.Printf("%v", resp)
-	}
+	bc.mux.Lock()
+	b := bc.blockTemplate(len(bc.Chain()), previousHash, bc.prioritize(bc.transactionPool))
+	b.nonce = nonce
+	bc.addBlock(b)
+	bc.mux.Unlock()
+	bc.announceBlock(context.Background(), b)
 	return b
 }
+
+// blockTemplate is the block mine searches a nonce for. Everything but
+// the nonce is set up front because the proof of work covers it all.
+func (bc *Blockchain) blockTemplate(height int, previousHash [32]byte, transactions []*Transaction) *Block {
+	b := NewBlock(0, previousHash, transactions)
+	b.height = height
+	b.timestamp = bc.now().UnixNano()
+	b.difficulty = bc.difficulty
+	return b
+}
+
+// addBlock appends a block we made and drops its transactions from the
+// pool. The caller holds bc.mux.
+func (bc *Blockchain) addBlock(b *Block) {
+	b.invalidateHash()
+	bc.muxChain.Lock()
+	bc.chain = append(bc.chain, b)
+	bc.applyBlock(b)
+	bc.pruneChain()
+	bc.muxChain.Unlock()
+	bc.removeFromPool(b.transactions)
+}
+
+// announceBlock sends a block we made to our neighbors, which drop its
+// transactions from their pools when they accept it.
+func (bc *Blockchain) announceBlock(ctx context.Context, b *Block) {
+	m, _ := b.MarshalJSON()
+	bc.broadcast(ctx, http.MethodPost, "/block", m, "")
+}
 func (b *Block) UnmarshalJSON(data []byte) error {
+	defer b.invalidateHash()
 	var previousHash string
+	var root string
 	v := &struct {
+		Version      *int            `json:"version"`
+		Height       *int            `json:"height"`
 		Timestamp    *int64          `json:"timestamp"`
 		Nonce        *int            `json:"nonce"`
+		Difficulty   *int            `json:"difficulty"`
 		PreviousHash *string         `json:"previous_hash"`
-		Transaction  *[]*Transaction `json:"transactions"`
+		MerkleRoot   *string         `json:"merkle_root"`
+		Transactions *[]*Transaction `json:"transactions"`
+		Pruned       *bool           `json:"pruned"`
 	}{
+		Version:      &b.version,
+		Height:       &b.height,
 		Timestamp:    &b.timestamp,
 		Nonce:        &b.nonce,
+		Difficulty:   &b.difficulty,
 		PreviousHash: &previousHash,
-		Transaction:  &b.transactions,
+		MerkleRoot:   &root,
+		Transactions: &b.transactions,
+		Pruned:       &b.pruned,
 	}
 	if err := json.Unmarshal(data, &v); err != nil {
 		return err
 	}
-	ph, _ := hex.DecodeString(*v.PreviousHash)
-	copy(b.previousHash[:], ph[:32])
+	ph, err := hex.DecodeString(*v.PreviousHash)
+	if err != nil {
+		return err
+	}
+	if len(ph) != len(b.previousHash) {
+		return fmt.Errorf("invalid previous_hash length %d", len(ph))
+	}
+	copy(b.previousHash[:], ph)
+	if b.pruned && (root == "" || len(b.transactions) > 0) {
+		return errors.New("pruned block must carry a merkle_root and no transactions")
+	}
+	// Keep the root as sent so validation can detect tampered bodies.
+	if root == "" {
+		b.merkleRoot = merkleRoot(b.transactions)
+		return nil
+	}
+	mr, err := hex.DecodeString(root)
+	if err != nil {
+		return err
+	}
+	if len(mr) != len(b.merkleRoot) {
+		return fmt.Errorf("invalid merkle_root length %d", len(mr))
+	}
+	copy(b.merkleRoot[:], mr)
 	return nil
 }
+
+// chainIndex holds what the first height blocks of a chain, up to the one
+// hashing to tip, add up to: the spent index, balances, next sequences and
+// chain stats.
+type chainIndex struct {
+	height           int
+	tip              [32]byte
+	spent            map[[32]byte]int
+	balances         map[string]float64
+	addressRefs      map[string]int
+	sequences        map[string]uint64
+	blockBytes       int
+	transactionCount int
+}
+
+func newChainIndex() *chainIndex {
+	return &chainIndex{
+		spent:       make(map[[32]byte]int),
+		balances:    make(map[string]float64),
+		addressRefs: make(map[string]int),
+		sequences:   make(map[string]uint64),
+	}
+}
+func (x *chainIndex) clone() *chainIndex {
+	c := newChainIndex()
+	for k, v := range x.spent {
+		c.spent[k] = v
+	}
+	for k, v := range x.balances {
+		c.balances[k] = v
+	}
+	for k, v := range x.addressRefs {
+		c.addressRefs[k] = v
+	}
+	for k, v := range x.sequences {
+		c.sequences[k] = v
+	}
+	c.height = x.height
+	c.tip = x.tip
+	c.blockBytes = x.blockBytes
+	c.transactionCount = x.transactionCount
+	return c
+}
+
+// applyBlock adds a block's effects to the balance index, the spent index
+// and the chain stats. revertBlock is its exact inverse. The caller holds
+// muxChain.
+func (x *chainIndex) applyBlock(b *Block) {
+	for _, t := range b.transactions {
+		x.spent[t.Hash()] += 1
+		x.adjustBalance(t.recipientBlockchainAddress, float64(t.value), 1)
+		x.adjustBalance(t.senderBlockchainAddress, -float64(t.value)-float64(t.fee), 1)
+		if t.senderBlockchainAddress != MiningSender {
+			x.sequences[t.senderBlockchainAddress] = t.sequence + 1
+		}
+	}
+	x.height++
+	x.tip = b.Hash()
+	x.blockBytes += b.serializedSize()
+	x.transactionCount += len(b.transactions)
+}
+
+// revertBlock takes the last applied block back off the index. A sender's
+// next sequence goes back to that of its earliest transaction in b.
+func (x *chainIndex) revertBlock(b *Block) {
+	for i := len(b.transactions) - 1; i >= 0; i-- {
+		t := b.transactions[i]
+		h := t.Hash()
+		if x.spent[h] -= 1; x.spent[h] <= 0 {
+			delete(x.spent, h)
+		}
+		x.adjustBalance(t.senderBlockchainAddress, float64(t.value)+float64(t.fee), -1)
+		x.adjustBalance(t.recipientBlockchainAddress, -float64(t.value), -1)
+		if t.senderBlockchainAddress != MiningSender {
+			if t.sequence == 0 {
+				delete(x.sequences, t.senderBlockchainAddress)
+			} else {
+				x.sequences[t.senderBlockchainAddress] = t.sequence
+			}
+		}
+	}
+	x.height--
+	x.tip = b.previousHash
+	x.blockBytes -= b.serializedSize()
+	x.transactionCount -= len(b.transactions)
+}
+func (x *chainIndex) adjustBalance(blockchainAddress string, delta float64, ref int) {
+	// Balances are kept in float64 so sums of float32-sized amounts stay
+	// exact; an address with no remaining references is dropped entirely.
+	x.balances[blockchainAddress] += delta
+	if x.addressRefs[blockchainAddress] += ref; x.addressRefs[blockchainAddress] <= 0 {
+		delete(x.addressRefs, blockchainAddress)
+		delete(x.balances, blockchainAddress)
+	}
+}
+
+// rebuildIndex discards the balance and spent indexes and the chain stats
+// and replays every block in the chain on top of the pruned blocks' index.
+// If the chain forks below the pruned blocks, that index no longer applies
+// and is dropped; otherwise those blocks are pruned in the new chain too.
+// The caller holds muxChain.
+func (bc *Blockchain) rebuildIndex() {
+	if n := bc.pruned.height; n > 0 && (len(bc.chain) < n || bc.chain[n-1].Hash() != bc.pruned.tip) {
+		bc.pruned = newChainIndex()
+	}
+	bc.chain = headersBelow(bc.chain, bc.pruned.height)
+	bc.chainIndex = bc.pruned.clone()
+	// The pruned index counts the blocks' bytes from before pruning.
+	bc.blockBytes = 0
+	for height, b := range bc.chain {
+		if height < bc.pruned.height {
+			bc.blockBytes += b.serializedSize()
+			continue
+		}
+		bc.applyBlock(b)
+	}
+}
+
+// replaceChain adopts chain and rebuilds every index from scratch, so
+// nothing derived from the old chain can survive a reorg. If chain has
+// pruned blocks, pruned is the index prunedBase found for them.
+func (bc *Blockchain) replaceChain(chain []*Block, pruned *chainIndex) {
+	bc.muxChain.Lock()
+	if pruned != nil && prunedHeight(chain) > 1 {
+		bc.pruned = pruned
+	}
+	bc.chain = chain
+	bc.rebuildIndex()
+	bc.pruneChain()
+	bc.muxChain.Unlock()
+	bc.difficulty = nextDifficulty(chain)
+}
+func (bc *Blockchain) SerializedSize() int {
+	empty, _ := (&Blockchain{chain: []*Block{}}).MarshalJSON()
+	bc.muxChain.RLock()
+	defer bc.muxChain.RUnlock()
+	size := len(empty) + bc.blockBytes
+	if len(bc.chain) > 1 {
+		// Separating commas between blocks.
+		size += len(bc.chain) - 1
+	}
+	return size
+}
+func (bc *Blockchain) IsSpent(transactionHash [32]byte) bool {
+	bc.muxChain.RLock()
+	defer bc.muxChain.RUnlock()
+	return bc.spent[transactionHash] > 0
+}
 func (bc *Blockchain) UnmarshalJSON(data []byte) error {
 	v := &struct {
-		Blocks *[]*Block `json:"chain"`
+		Blocks *[]*Block    `json:"chain"`
+		Pruned **chainIndex `json:"pruned"`
 	}{
 		Blocks: &bc.chain,
+		Pruned: &bc.pruned,
 	}
 	if err := json.Unmarshal(data, &v); err != nil {
 		return err
 	}
 	return nil
 }
+func (bc *Blockchain) Headers() []*BlockHeader {
+	chain := bc.Chain()
+	headers := make([]*BlockHeader, 0, len(chain))
+	for _, b := range chain {
+		headers = append(headers, b.Header())
+	}
+	return headers
+}
+
+// TransactionPool returns a snapshot of the pending transactions.
 func (bc *Blockchain) TransactionPool() []*Transaction {
-	return bc.transactionPool
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+	pool := make([]*Transaction, len(bc.transactionPool))
+	copy(pool, bc.transactionPool)
+	return pool
 }
 func (bc *Blockchain) ClearTransactionPool() {
-	bc.transactionPool = bc.transactionPool[:0]
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+	bc.transactionPool = []*Transaction{}
+	// The block being mined would include what we just dropped; mine also
+	// checks the pool before sealing.
+	bc.cancelMining()
+	bc.emit(Event{Type: EventPoolCleared})
+}
+
+// RemoveTransaction drops one pending transaction by id and reports whether
+// it was in the pool.
+func (bc *Blockchain) RemoveTransaction(id string) bool {
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+	return bc.removeTransaction(id)
+}
+
+// removeTransaction is RemoveTransaction for callers holding bc.mux.
+func (bc *Blockchain) removeTransaction(id string) bool {
+	for i, t := range bc.transactionPool {
+		if t.TransactionId() == id {
+			pool := make([]*Transaction, 0, len(bc.transactionPool)-1)
+			pool = append(pool, bc.transactionPool[:i]...)
+			bc.transactionPool = append(pool, bc.transactionPool[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// ExpireTransactions drops pending transactions that have been in the pool
+// longer than the TTL and returns how many were dropped.
+func (bc *Blockchain) ExpireTransactions() int {
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+	return bc.expireTransactions()
+}
+
+// expireTransactions is ExpireTransactions for callers holding bc.mux.
+func (bc *Blockchain) expireTransactions() int {
+	if bc.transactionTTL <= 0 {
+		return 0
+	}
+	cutoff := bc.now().Add(-bc.transactionTTL)
+	pool := []*Transaction{}
+	for _, t := range bc.transactionPool {
+		if t.pooledAt.Before(cutoff) {
+			slog.Info("transaction expired", "id", t.TransactionId())
+			continue
+		}
+		pool = append(pool, t)
+	}
+	expired := len(bc.transactionPool) - len(pool)
+	bc.transactionPool = pool
+	return expired
+}
+
+// SetTransactionTTL sets how long a transaction may wait in the pool. Zero
+// or less keeps transactions until they are mined.
+func (bc *Blockchain) SetTransactionTTL(d time.Duration) {
+	bc.transactionTTL = d
+}
+func (bc *Blockchain) removeFromPool(transactions []*Transaction) {
+	included := make(map[[32]byte]bool)
+	for _, t := range transactions {
+		included[t.Hash()] = true
+	}
+	pool := []*Transaction{}
+	for _, t := range bc.transactionPool {
+		if !included[t.Hash()] {
+			pool = append(pool, t)
+		}
+	}
+	bc.transactionPool = pool
 }
 func (bc *Blockchain) LastBlock() *Block {
-	return bc.chain[len(bc.chain)-1]
+	chain := bc.Chain()
+	return chain[len(chain)-1]
+}
+func (bc *Blockchain) BlockByHeight(height int) (*Block, bool) {
+	chain := bc.Chain()
+	if height < 0 || height >= len(chain) {
+		return nil, false
+	}
+	return chain[height], true
+}
+func (bc *Blockchain) BlockByHash(hash string) (*Block, bool) {
+	for _, b := range bc.Chain() {
+		h := b.Hash()
+		if fmt.Sprintf("%x", h) == hash {
+			return b, true
+		}
+	}
+	return nil, false
 }
 func (bc *Blockchain) Print() {
-	for i, block := range bc.chain {
+	for i, block := range bc.Chain() {
 		fmt.Printf("%s Chain %d %s\n", strings.Repeat("=", 25), i, strings.Repeat("=", 25))
 		block.Print()
 	}
 	fmt.Printf("%s\n", strings.Repeat("*", 25))
 }
-func (bc *Blockchain) CreateTransaction(sender string, recipient string, value float32,
-	senderPublicKey *ecdsa.PublicKey, s *utils.Signature) bool {
-	isTransaction := bc.AddTransaction(sender, recipient, value, senderPublicKey, s)
-	if isTransaction {
-		for _, n := range bc.neighbors {
-			publicKeyStr := fmt.Sprintf("%064x%064x", senderPublicKey.X.Bytes(), senderPublicKey.Y.Bytes())
-			signturaStr := s.String()
-			bt := &TransactionRequest{
-				&sender, &recipient, &publicKeyStr, &value, &signturaStr}
-			m, _ := json.Marshal(bt)
-			buf := bytes.NewBuffer(m)
-			endpoint := fmt.Sprintf("https://%s/transactions", n)
-			client := &http.Client{}
-			req, _ := http.NewRequest("PUT", endpoint, buf)
-			resp, _ := client.Do(req)
-			log.Printf("%v", resp)
-		}
-	}
-	return isTransaction
-}
-func (bc *Blockchain) AddTransaction(sender string, recipient string, value float32,
-	senderPublicKey *ecdsa.PublicKey, s *utils.Signature) bool {
-	t := NewTransaction(sender, recipient, value)
-	if sender == MiningSender {
-		bc.transactionPool = append(bc.transactionPool, t)
-		return true
+func (bc *Blockchain) CreateTransaction(ctx context.Context, t *Transaction, senderPublicKey *ecdsa.PublicKey, s *utils.Signature) error {
+	return bc.RelayTransaction(ctx, t, senderPublicKey, s, "")
+}
+
+// AddTransaction checks t and adds it to the pool. The checks and the
+// append happen under one lock, so concurrent submissions can't together
+// spend more than the sender has.
+func (bc *Blockchain) AddTransaction(t *Transaction, senderPublicKey *ecdsa.PublicKey, s *utils.Signature) error {
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+	return bc.addTransaction(t, senderPublicKey, s)
+}
+
+// addTransaction is AddTransaction for callers holding bc.mux.
+func (bc *Blockchain) addTransaction(t *Transaction, senderPublicKey *ecdsa.PublicKey, s *utils.Signature) error {
+	// Mining adds the block's one coinbase itself; one in the pool would
+	// make the block invalid.
+	if t.senderBlockchainAddress == MiningSender {
+		slog.Warn("coinbase transaction submitted to the pool")
+		return ErrCoinbaseTransaction
+	}
+	if next := bc.nextSequence(t.senderBlockchainAddress); t.sequence < next {
+		slog.Warn("replayed transaction sequence", "sender", t.senderBlockchainAddress, "sequence", t.sequence, "next", next)
+		return ErrReplayedTransaction
+	} else if t.sequence > next {
+		slog.Warn("transaction sequence skips ahead", "sender", t.senderBlockchainAddress, "sequence", t.sequence, "next", next)
+		return ErrSequenceGap
+	}
+	if bc.knowsTransaction(t) {
+		slog.Warn("duplicate transaction", "id", t.TransactionId())
+		return ErrDuplicateTransaction
+	}
+	if t.fee < 0 {
+		slog.Warn("negative transaction fee", "fee", t.fee)
+		return ErrNegativeFee
 	}
+	t.senderPublicKey = senderPublicKey
+	t.signature = s
+	t.pooledAt = bc.now()
+	if !utils.ValidateAddress(t.recipientBlockchainAddress) {
+		slog.Warn("invalid recipient address", "recipient", t.recipientBlockchainAddress)
+		return ErrInvalidRecipient
+	}
+	if !bc.VerityTransactionSignature(senderPublicKey, s, t) {
+		slog.Warn("invalid transaction signature", "id", t.TransactionId())
+		return ErrInvalidSignature
+	}
+	if bc.Balance(t.senderBlockchainAddress)-bc.pendingOutgoing(t.senderBlockchainAddress) < t.cost() {
+		slog.Warn("insufficient balance", "sender", t.senderBlockchainAddress)
+		return ErrInsufficientBalance
+	}
+	if err := bc.makeRoom(t); err != nil {
+		slog.Warn("transaction rejected", "id", t.TransactionId(), "error", err)
+		return err
+	}
+	bc.transactionPool = append(bc.transactionPool, t)
+	bc.emit(Event{Type: EventTransactionAdded, Transaction: t})
+	return nil
+}
 
-	if bc.VerityTransactionSignature(senderPublicKey, s, t) {
-		/*if bc.CalculateTotalAmount(sender) < value {
-			log.Println("ERROR: Not enough balance in a wallet")
-			return false
-		}*/
-		bc.transactionPool = append(bc.transactionPool, t)
+// makeRoom enforces maxMempoolSize. A full pool only admits t by evicting
+// the lowest-fee pending transaction, and only if t pays more than it. The
+// caller holds bc.mux.
+func (bc *Blockchain) makeRoom(t *Transaction) error {
+	if bc.maxMempoolSize <= 0 || len(bc.transactionPool) < bc.maxMempoolSize {
+		return nil
+	}
+	lowest := -1
+	for i, p := range bc.transactionPool {
+		if lowest < 0 || p.fee < bc.transactionPool[lowest].fee {
+			lowest = i
+		}
+	}
+	if lowest < 0 || t.fee <= bc.transactionPool[lowest].fee {
+		return ErrMempoolFull
+	}
+	evicted := bc.transactionPool[lowest]
+	bc.removeTransaction(evicted.TransactionId())
+	slog.Info("transaction evicted", "id", evicted.TransactionId(), "fee", evicted.fee)
+	return nil
+}
+
+// knowsTransaction reports whether t is already pending or mined, so that a
+// transaction relayed by several neighbors is only accepted once. The caller
+// holds bc.mux.
+func (bc *Blockchain) knowsTransaction(t *Transaction) bool {
+	h := t.Hash()
+	if bc.IsSpent(h) {
 		return true
-	} else {
-		log.Println("ERROR: Verify Transaction")
+	}
+	for _, p := range bc.transactionPool {
+		if p.Hash() == h {
+			return true
+		}
 	}
 	return false
 }
+func (bc *Blockchain) pendingOutgoing(blockchainAddress string) float32 {
+	var total float32 = 0.0
+	for _, t := range bc.transactionPool {
+		if t.senderBlockchainAddress == blockchainAddress {
+			total += t.cost()
+		}
+	}
+	return total
+}
 func (bc *Blockchain) VerityTransactionSignature(senderPublicKey *ecdsa.PublicKey, s *utils.Signature, t *Transaction) bool {
-	m, _ := json.Marshal(t)
-	h := sha256.Sum256([]byte(m))
+	h := t.Hash()
 	return ecdsa.Verify(senderPublicKey, h[:], s.R, s.S)
 }
+func (bc *Blockchain) finalTransactions(height int, now time.Time) []*Transaction {
+	transactions := make([]*Transaction, 0)
+	for _, t := range bc.copyTransactionPool() {
+		if t.IsFinal(height, now) {
+			transactions = append(transactions, t)
+		}
+	}
+	return transactions
+}
+
+func (bc *Blockchain) selectTransactions(height int, now time.Time) []*Transaction {
+	return bc.fitBlockBytes(height, bc.prioritize(bc.finalTransactions(height, now)))
+}
+
+// prioritize orders transactions by fee, highest first, and keeps at most
+// maxTransactionsPerBlock of them. Equal fees keep pool order, and each
+// sender's transactions are then put in sequence. The rest are left in the
+// pool for a later block.
+func (bc *Blockchain) prioritize(transactions []*Transaction) []*Transaction {
+	sorted := make([]*Transaction, len(transactions))
+	copy(sorted, transactions)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].fee > sorted[j].fee
+	})
+	if len(sorted) > bc.maxTransactionsPerBlock {
+		sorted = sorted[:bc.maxTransactionsPerBlock]
+	}
+	return bc.inSequence(sorted)
+}
+func (bc *Blockchain) SetMaxClockDrift(d time.Duration) {
+	bc.maxClockDrift = d
+}
+func (bc *Blockchain) SetMaxTransactionsPerBlock(n int) {
+	if n < 1 {
+		n = 1
+	}
+	bc.maxTransactionsPerBlock = n
+}
+
+// SetMaxMempoolSize caps the number of pending transactions. Zero or less
+// removes the cap.
+func (bc *Blockchain) SetMaxMempoolSize(n int) {
+	bc.maxMempoolSize = n
+}
+func (bc *Blockchain) AuditPool() []PoolAuditResult {
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+	return bc.auditPool()
+}
+func (bc *Blockchain) auditPool() []PoolAuditResult {
+	results := make([]PoolAuditResult, 0, len(bc.transactionPool))
+	pending := make(map[string]float32)
+	for _, t := range bc.transactionPool {
+		reason := bc.auditTransaction(t, pending)
+		results = append(results, PoolAuditResult{Hash: t.Hash(), Valid: reason == "", Reason: reason})
+	}
+	return results
+}
+func (bc *Blockchain) auditTransaction(t *Transaction, pending map[string]float32) string {
+	if t.senderBlockchainAddress == "" || t.recipientBlockchainAddress == "" {
+		return "missing blockchain address"
+	}
+	if t.value <= 0 {
+		return "value must be positive"
+	}
+	if t.fee < 0 {
+		return "fee must not be negative"
+	}
+	if t.senderBlockchainAddress == MiningSender {
+		return ""
+	}
+	if t.senderPublicKey == nil || t.signature == nil {
+		return "missing signature"
+	}
+	if !bc.VerityTransactionSignature(t.senderPublicKey, t.signature, t) {
+		return "invalid signature"
+	}
+	pending[t.senderBlockchainAddress] += t.cost()
+	if bc.Balance(t.senderBlockchainAddress) < pending[t.senderBlockchainAddress] {
+		return "insufficient balance"
+	}
+	return ""
+}
+func (bc *Blockchain) PurgeInvalidPool() int {
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+	pool := []*Transaction{}
+	for i, r := range bc.auditPool() {
+		if r.Valid {
+			pool = append(pool, bc.transactionPool[i])
+		}
+	}
+	removed := len(bc.transactionPool) - len(pool)
+	bc.transactionPool = pool
+	return removed
+}
 func (bc *Blockchain) CopyTransactionPool() []*Transaction {
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+	return bc.copyTransactionPool()
+}
+func (bc *Blockchain) copyTransactionPool() []*Transaction {
 	transactions := make([]*Transaction, 0)
 	for _, t := range bc.transactionPool {
-		transactions = append(transactions, NewTransaction(t.senderBlockchainAddress, t.recipientBlockchainAddress, t.value))
+		transactions = append(transactions, NewTransaction(t.senderBlockchainAddress, t.recipientBlockchainAddress, t.value, t.fee, t.locktime, t.sequence))
 	}
 	return transactions
 }
-func (bc *Blockchain) ValidProof(nonce int, previousHash [32]byte, transactions []*Transaction, difficulty int) bool {
-	zeros := strings.Repeat("0", difficulty)
-	guessBlock := Block{0, nonce, previousHash, transactions}
-	guessHashStr := fmt.Sprintf("%x", guessBlock.Hash())
-	return guessHashStr[:difficulty] == zeros
+func (bc *Blockchain) EstimateFee(blocks int) float32 {
+	if blocks < 1 {
+		blocks = 1
+	}
+	pool := bc.TransactionPool()
+	if len(pool) == 0 {
+		return MinimumFee
+	}
+	fees := make([]float32, 0, len(pool))
+	for _, t := range pool {
+		fees = append(fees, t.fee)
+	}
+	sort.Slice(fees, func(i, j int) bool { return fees[i] > fees[j] })
+	var estimate float32 = MinimumFee
+	// The pool ahead of us must fit into the requested number of blocks, so
+	// outbid whatever would take the last available slot.
+	if capacity := blocks * bc.maxTransactionsPerBlock; len(fees) >= capacity {
+		if fee := fees[capacity-1] + MinimumFee; fee > estimate {
+			estimate = fee
+		}
+	}
+	if fee := bc.recentFeeFloor(blocks); fee > estimate {
+		estimate = fee
+	}
+	return estimate
 }
-func (bc *Blockchain) ProofOfWork() int {
-	transactions := bc.CopyTransactionPool()
-	previousHash := bc.LastBlock().Hash()
-	nonce := 0
-	for !bc.ValidProof(nonce, previousHash, transactions, MiningDifficulty) {
-		nonce += 1
+func (bc *Blockchain) recentFeeFloor(blocks int) float32 {
+	var floor float32
+	found := false
+	chain := bc.Chain()
+	for i := len(chain) - 1; i > 0 && i >= len(chain)-blocks; i-- {
+		b := chain[i]
+		// Only full blocks tell us anything about competition for space.
+		if len(b.transactions) <= bc.maxTransactionsPerBlock {
+			continue
+		}
+		for _, t := range b.transactions {
+			if t.senderBlockchainAddress == MiningSender {
+				continue
+			}
+			if !found || t.fee < floor {
+				floor = t.fee
+				found = true
+			}
+		}
+	}
+	return floor
+}
+
+// ValidProof reports whether h's nonce meets its difficulty.
+func (bc *Blockchain) ValidProof(h *BlockHeader) bool {
+	return meetsDifficulty(proofHash(h, h.Difficulty, bc.genesis.PowSalt), h.Difficulty)
+}
+
+// proofOfWork searches for a nonce that completes h, which carries
+// everything else the block will: height, timestamp and difficulty
+// included.
+func (bc *Blockchain) proofOfWork(ctx context.Context, h BlockHeader) (int, bool) {
+	workers := bc.miningWorkers
+	if workers <= 1 {
+		return bc.searchNonce(ctx, 0, 1, h)
+	}
+	// Worker i probes i, i+workers, i+2*workers, ... and the first to find a
+	// valid nonce cancels the rest.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	found := make(chan int, workers)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(start int) {
+			defer wg.Done()
+			if nonce, ok := bc.searchNonce(ctx, start, workers, h); ok {
+				found <- nonce
+				cancel()
+			}
+		}(i)
+	}
+	wg.Wait()
+	select {
+	case nonce := <-found:
+		return nonce, true
+	default:
+		return 0, false
 	}
-	return nonce
+}
+func (bc *Blockchain) searchNonce(ctx context.Context, start int, stride int, h BlockHeader) (int, bool) {
+	h.Nonce = start
+	for !bc.ValidProof(&h) {
+		if ctx.Err() != nil {
+			return 0, false
+		}
+		h.Nonce += stride
+	}
+	return h.Nonce, true
+}
+func (bc *Blockchain) SetMiningWorkers(n int) {
+	if n < 1 {
+		n = 1
+	}
+	bc.miningWorkers = n
 }
 func (bc *Blockchain) Mining() bool {
+	return bc.mine(context.Background())
+}
+
+// mine mines one block from the pool, giving up when ctx is done or a
+// competing block arrives. The pool is only locked while transactions are
+// selected and while the block is sealed, so submissions are not held up
+// by the proof of work.
+func (bc *Blockchain) mine(ctx context.Context) bool {
+	bc.muxMine.Lock()
+	defer bc.muxMine.Unlock()
 	bc.mux.Lock()
-	defer bc.mux.Unlock()
-	if len(bc.TransactionPool()) == 0 {
+	bc.expireTransactions()
+	work, cancel := context.WithCancel(ctx)
+	defer cancel()
+	bc.setMiningCancel(cancel)
+	defer bc.setMiningCancel(nil)
+	height := len(bc.Chain())
+	previousHash := bc.LastBlock().Hash()
+	transactions := bc.selectTransactions(height, bc.now())
+	if len(transactions) == 0 {
+		bc.mux.Unlock()
 		return false
 	}
-	bc.AddTransaction(MiningSender, bc.blockchainAddress, MiningReward, nil, nil)
-	nonce := bc.ProofOfWork()
-	previousHash := bc.LastBlock().Hash()
-	bc.CreateBlock(nonce, previousHash)
-	log.Println("action=mining,status=success")
+	var fees float32
+	for _, t := range transactions {
+		fees += t.fee
+	}
+	reward := bc.BlockReward(height)
+	transactions = append(transactions, newCoinbase(bc.blockchainAddress, reward+fees, height))
+	b := bc.blockTemplate(height, previousHash, transactions)
+	bc.mux.Unlock()
+	start := time.Now()
+	nonce, ok := bc.proofOfWork(work, *b.Header())
+	if !ok {
+		slog.Info("mining canceled")
+		return false
+	}
+	bc.mux.Lock()
+	if work.Err() != nil || bc.LastBlock().Hash() != previousHash || !bc.pending(b.transactions) {
+		bc.mux.Unlock()
+		slog.Info("mining canceled")
+		return false
+	}
+	b.nonce = nonce
+	bc.addBlock(b)
+	bc.AdjustDifficulty()
+	bc.emit(Event{Type: EventBlockMined, Block: b, Duration: time.Since(start)})
+	bc.autosave()
+	bc.mux.Unlock()
+	bc.announceBlock(ctx, b)
+	slog.Info("block mined", "height", b.height, "transactions", len(b.transactions))
+	return true
+}
+
+// pending reports whether every transaction but the coinbase is still in
+// the pool, so that a block holding them may be sealed. The caller holds
+// bc.mux.
+func (bc *Blockchain) pending(transactions []*Transaction) bool {
+	pooled := make(map[string]bool, len(bc.transactionPool))
+	for _, t := range bc.transactionPool {
+		pooled[t.TransactionId()] = true
+	}
+	for _, t := range transactions {
+		if t.senderBlockchainAddress != MiningSender && !pooled[t.TransactionId()] {
+			return false
+		}
+	}
 	return true
 }
-func (bc *Blockchain) StartMining() {
-	bc.Mining()
-	_ = time.AfterFunc(MiningTimeSec*time.Second, bc.StartMining)
+func (bc *Blockchain) setMiningCancel(cancel context.CancelFunc) {
+	bc.muxMining.Lock()
+	defer bc.muxMining.Unlock()
+	bc.miningCancel = cancel
 }
-func (bc *Blockchain) ResolveConflicts() bool {
-	var longestChain []*Block = nil
-	maxLength := len(bc.chain)
-	for _, n := range bc.neighbors {
-		endpoint := fmt.Sprintf("https://%s/chain", n)
-		resp, _ := http.Get(endpoint)
-		if resp.StatusCode == 200 {
-			var bcResp Blockchain
-			decoder := json.NewDecoder(resp.Body)
-			_ = decoder.Decode(&bcResp)
-			chain := bcResp.chain
-			if len(chain) > maxLength && bc.ValidChain(chain) {
-				maxLength = len(chain)
-				longestChain = chain
+func (bc *Blockchain) cancelMining() {
+	bc.muxMining.Lock()
+	defer bc.muxMining.Unlock()
+	if bc.miningCancel != nil {
+		bc.miningCancel()
+	}
+}
+
+// BlockReward is the coinbase reward, excluding fees, for a block at height:
+// MiningReward halved once per halvingInterval blocks, reaching zero after
+// 64 halvings.
+func (bc *Blockchain) BlockReward(height int) float32 {
+	halvings := height / bc.halvingInterval
+	if halvings >= 64 {
+		return 0
+	}
+	return MiningReward / float32(uint64(1)<<uint(halvings))
+}
+func (bc *Blockchain) SetHalvingInterval(n int) {
+	if n < 1 {
+		n = 1
+	}
+	bc.halvingInterval = n
+}
+func (bc *Blockchain) SetMiningThreshold(minTxToMine int, maxWait time.Duration) {
+	bc.minTxToMine = minTxToMine
+	bc.maxMiningWait = maxWait
+}
+func (bc *Blockchain) Difficulty() int {
+	return bc.difficulty
+}
+func (bc *Blockchain) AdjustDifficulty() {
+	bc.difficulty = nextDifficulty(bc.Chain())
+}
+
+// nextDifficulty returns the difficulty required of the block following
+// chain. Every DifficultyAdjustmentInterval blocks it compares how long the
+// last interval took against the MiningTimeSec target and moves one step.
+// The genesis block is left out since its timestamp predates mining.
+func nextDifficulty(chain []*Block) int {
+	last := chain[len(chain)-1]
+	difficulty := last.difficulty
+	first := len(chain) - 1 - DifficultyAdjustmentInterval
+	if len(chain)%DifficultyAdjustmentInterval != 0 || first < 1 {
+		return difficulty
+	}
+	elapsed := time.Duration(last.timestamp - chain[first].timestamp)
+	target := MiningTimeSec * time.Second * DifficultyAdjustmentInterval
+	switch {
+	case elapsed < target/2:
+		difficulty += 1
+	case elapsed > target*2 && difficulty > 1:
+		difficulty -= 1
+	}
+	return difficulty
+}
+
+// StartMining runs a single background miner until ctx is done or Stop is
+// called. Later calls are no-ops, so the mining rate does not depend on how
+// often it is called.
+func (bc *Blockchain) StartMining(ctx context.Context) {
+	bc.startMining.Do(func() {
+		events, unsubscribe := bc.Subscribe()
+		bc.miningStarted.Store(true)
+		go bc.mineOnThreshold(ctx, events, unsubscribe)
+	})
+}
+
+// MiningActive reports whether the background mining loop is running.
+func (bc *Blockchain) MiningActive() bool {
+	return bc.miningStarted.Load() && !bc.stopped()
+}
+func (bc *Blockchain) mineOnThreshold(ctx context.Context, events <-chan Event, unsubscribe func()) {
+	defer bc.miningStarted.Store(false)
+	defer unsubscribe()
+	ticker := time.NewTicker(bc.maxMiningWait)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-bc.stop:
+			return
+		case e := <-events:
+			if e.Type != EventTransactionAdded || len(bc.TransactionPool()) < bc.minTxToMine {
+				continue
 			}
+		case <-ticker.C:
+			// Max wait reached: mine whatever is pooled so nothing starves.
+		}
+		bc.mine(ctx)
+		ticker.Reset(bc.maxMiningWait)
+	}
+}
+
+// chainWork is the total proof of work behind a chain, 2^difficulty summed
+// over its blocks.
+func chainWork(chain []*Block) *big.Int {
+	work := new(big.Int)
+	for _, b := range chain {
+		// A hash has 64 hex digits; anything outside that range is invalid
+		// and is rejected by ValidChain anyway.
+		if b.difficulty < 0 || b.difficulty > 64 {
+			continue
+		}
+		work.Add(work, new(big.Int).Lsh(big.NewInt(1), uint(b.difficulty)))
+	}
+	return work
+}
+
+// ResolveConflicts adopts the valid neighbor chain with the most cumulative
+// work, if it has more than ours. It keeps our chain if ctx is done before
+// every neighbor has been asked.
+func (bc *Blockchain) ResolveConflicts(ctx context.Context) bool {
+	var longestChain []*Block = nil
+	maxWork := chainWork(bc.Chain())
+	for _, n := range bc.Neighbors() {
+		if ctx.Err() != nil {
+			return false
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, bc.neighborEndpoint(n, "/chain"), nil)
+		if err != nil {
+			return false
+		}
+		resp, err := bc.client.Do(req)
+		if err != nil {
+			slog.Warn("fetching neighbor chain failed", "neighbor", n, "error", err)
+			continue
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			slog.Warn("fetching neighbor chain failed", "neighbor", n, "status", resp.Status)
+			continue
+		}
+		var bcResp Blockchain
+		err = json.NewDecoder(resp.Body).Decode(&bcResp)
+		resp.Body.Close()
+		if err != nil {
+			slog.Warn("decoding neighbor chain failed", "neighbor", n, "error", err)
+			continue
+		}
+		chain := bcResp.chain
+		if len(chain) == 0 || !validGenesis(chain[0], bc.genesis) {
+			slog.Warn("neighbor chain is from another network", "neighbor", n, "network", bc.NetworkID())
+			continue
+		}
+		// The index a pruning peer sends for its pruned blocks is ignored;
+		// see prunedBase.
+		if work := chainWork(chain); work.Cmp(maxWork) > 0 && bc.ValidChain(chain) {
+			maxWork = work
+			longestChain = chain
 		}
 	}
-	if longestChain != nil {
-		bc.chain = longestChain
-		log.Printf("Resovle conflicts replaceed")
+	if longestChain != nil && ctx.Err() == nil {
+		// The block being mined now builds on a stale tip; stop grinding it.
+		bc.cancelMining()
+		bc.mux.Lock()
+		pruned, err := bc.prunedBase(longestChain, nil)
+		if err != nil {
+			// Our chain changed and no longer holds its pruned blocks.
+			bc.mux.Unlock()
+			slog.Warn("neighbor chain no longer applies", "error", err)
+			return false
+		}
+		bc.replaceChain(longestChain, pruned)
+		bc.mux.Unlock()
+		bc.emit(Event{Type: EventReorg, Block: bc.LastBlock()})
+		slog.Info("chain replaced by a neighbor's", "height", len(longestChain)-1)
 		return true
 	}
-	log.Printf("Resovle conflicts not replaced")
+	slog.Debug("chain kept, no neighbor has more work")
 	return false
 }
-func (bc *Blockchain) CalculateTotalAmount(blockchainAddress string) float32 {
-	var totalAmount float32 = 0.0
-	for _, b := range bc.chain {
+
+// AcceptBlock appends a block propagated by a neighbor if it extends our
+// tip, followed by any buffered orphans that now connect to it.
+// ErrUnknownAncestor means the parent hasn't arrived yet: the block is
+// buffered, but the sender may also be on a chain we haven't seen, and
+// ResolveConflicts should be run to catch up. An orphan that fails the
+// checks addOrphan applies is ErrInvalidBlock instead.
+func (bc *Blockchain) AcceptBlock(b *Block) error {
+	err := bc.acceptBlock(b)
+	switch err {
+	case nil:
+		bc.connectOrphans(b)
+	case ErrUnknownAncestor:
+		if !bc.addOrphan(b) {
+			return ErrInvalidBlock
+		}
+	}
+	return err
+}
+func (bc *Blockchain) acceptBlock(b *Block) error {
+	last := bc.LastBlock()
+	if b.previousHash != last.Hash() {
+		if bc.knownBlock(b.previousHash) {
+			return ErrStaleBlock
+		}
+		return ErrUnknownAncestor
+	}
+	// Whatever we are mining builds on the same parent and would lose.
+	bc.cancelMining()
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+	chain := bc.Chain()
+	if chain[len(chain)-1] != last {
+		// Someone else extended the chain while we waited for the lock.
+		return ErrStaleBlock
+	}
+	if !bc.validSuccessor(chain, b, bc.now().Add(bc.maxClockDrift).UnixNano()) {
+		return ErrInvalidBlock
+	}
+	if err := checkSequences(b, bc.confirmedSequences(b)); err != nil {
+		slog.Warn("invalid block", "height", b.height, "error", err)
+		return ErrInvalidBlock
+	}
+	bc.muxChain.Lock()
+	bc.chain = append(bc.chain, b)
+	bc.applyBlock(b)
+	bc.pruneChain()
+	bc.muxChain.Unlock()
+	bc.removeFromPool(b.transactions)
+	bc.AdjustDifficulty()
+	bc.emit(Event{Type: EventBlockAccepted, Block: b})
+	bc.autosave()
+	slog.Info("block accepted", "height", b.height)
+	return nil
+}
+
+// GetTransaction looks a transaction up by id in the chain and then the
+// pool, along with its height and confirmations. A transaction that is
+// still pending has height -1 and no confirmations.
+func (bc *Blockchain) GetTransaction(id string) (*Transaction, int, int, bool) {
+	chain := bc.Chain()
+	for height, b := range chain {
 		for _, t := range b.transactions {
-			value := t.value
+			if t.TransactionId() == id {
+				return t, height, len(chain) - height, true
+			}
+		}
+	}
+	for _, t := range bc.TransactionPool() {
+		if t.TransactionId() == id {
+			return t, -1, 0, true
+		}
+	}
+	return nil, 0, 0, false
+}
+
+// Balance reads an address's confirmed balance from the index kept up to
+// date as blocks are committed. CalculateTotalAmount computes the same value
+// by scanning the whole chain.
+func (bc *Blockchain) Balance(blockchainAddress string) float32 {
+	bc.muxChain.RLock()
+	defer bc.muxChain.RUnlock()
+	return float32(bc.balances[blockchainAddress]) - bc.immatureCoinbase(blockchainAddress)
+}
+
+// immatureCoinbase sums the coinbase outputs to an address that are still
+// too young to spend. The caller holds muxChain.
+func (bc *Blockchain) immatureCoinbase(blockchainAddress string) float32 {
+	var total float32
+	for i := len(bc.chain) - 1; i >= 0 && !bc.isMature(i); i-- {
+		for _, t := range bc.chain[i].transactions {
+			if t.senderBlockchainAddress == MiningSender && t.recipientBlockchainAddress == blockchainAddress {
+				total += t.value
+			}
+		}
+	}
+	return total
+}
+func (bc *Blockchain) isMature(height int) bool {
+	// Genesis allocations are spendable from the start.
+	return height == 0 || len(bc.chain)-height >= bc.coinbaseMaturity
+}
+func (bc *Blockchain) SetCoinbaseMaturity(n int) {
+	if n < 0 {
+		n = 0
+	}
+	bc.coinbaseMaturity = n
+}
+
+// CalculateTotalAmount is the spendable balance of an address: everything
+// it received, less everything it spent, excluding immature coinbase outputs.
+// Pruned blocks are counted from their index.
+func (bc *Blockchain) CalculateTotalAmount(blockchainAddress string) float32 {
+	bc.muxChain.RLock()
+	defer bc.muxChain.RUnlock()
+	totalAmount := float32(bc.pruned.balances[blockchainAddress])
+	for height := bc.pruned.height; height < len(bc.chain); height++ {
+		for _, t := range bc.chain[height].transactions {
+			if t.senderBlockchainAddress == MiningSender && !bc.isMature(height) {
+				continue
+			}
 			if blockchainAddress == t.recipientBlockchainAddress {
-				totalAmount += value
+				totalAmount += t.value
 			}
 			if blockchainAddress == t.senderBlockchainAddress {
-				totalAmount -= value
+				totalAmount -= t.cost()
 			}
 		}
 	}
 	return totalAmount
 }
+
+// AllBalances walks the chain once and returns the net amount of every
+// address that has transacted, immature coinbase outputs included, so the
+// amounts add up to everything ever issued. MiningSender is left out.
+// Pruned blocks are counted from their index.
+func (bc *Blockchain) AllBalances() map[string]float32 {
+	bc.muxChain.RLock()
+	defer bc.muxChain.RUnlock()
+	totals := make(map[string]float64)
+	for address, balance := range bc.pruned.balances {
+		if address != MiningSender {
+			totals[address] = balance
+		}
+	}
+	for height := bc.pruned.height; height < len(bc.chain); height++ {
+		for _, t := range bc.chain[height].transactions {
+			totals[t.recipientBlockchainAddress] += float64(t.value)
+			if t.senderBlockchainAddress != MiningSender {
+				totals[t.senderBlockchainAddress] -= float64(t.cost())
+			}
+		}
+	}
+	balances := make(map[string]float32, len(totals))
+	for address, total := range totals {
+		balances[address] = float32(total)
+	}
+	return balances
+}
+func (bc *Blockchain) Throughput() ThroughputStats {
+	var stats ThroughputStats
+	bc.muxChain.RLock()
+	defer bc.muxChain.RUnlock()
+	if len(bc.chain) == 0 {
+		return stats
+	}
+	totalTransactions := bc.transactionCount
+	stats.AvgTxPerBlock = float64(totalTransactions) / float64(len(bc.chain))
+	span := time.Duration(bc.chain[len(bc.chain)-1].timestamp - bc.chain[0].timestamp)
+	if span > 0 {
+		stats.TxPerSecond = float64(totalTransactions) / span.Seconds()
+	}
+	return stats
+}
 func (bc *Blockchain) ValidChain(chain []*Block) bool {
-	preBlock := chain[0]
-	currentIndex := 1
-	for currentIndex < len(chain) {
-		b := chain[currentIndex]
-		if b.previousHash != preBlock.Hash() {
-			return false
+	err := bc.checkChain(chain, nil)
+	if err == nil && bc.balanceCheck {
+		err = bc.checkBalances(chain, nil)
+	}
+	if err != nil {
+		slog.Warn("invalid chain", "error", err)
+		return false
+	}
+	return true
+}
+
+// checkChain checks that chain starts at our genesis block and that every
+// later block is a valid successor of the ones before it. Pruned blocks
+// have only their headers checked; see prunedBase for saved.
+func (bc *Blockchain) checkChain(chain []*Block, saved *chainIndex) error {
+	if len(chain) == 0 {
+		return errors.New("empty chain")
+	}
+	if !validGenesis(chain[0], bc.genesis) {
+		return &ChainError{0, errors.New("not our genesis block")}
+	}
+	latest := bc.now().Add(bc.maxClockDrift).UnixNano()
+	if chain[0].timestamp > latest {
+		return &ChainError{0, errors.New("too far in the future")}
+	}
+	base, err := bc.prunedBase(chain, saved)
+	if err != nil {
+		return err
+	}
+	sequences := make(map[string]uint64, len(base.sequences))
+	for sender, next := range base.sequences {
+		sequences[sender] = next
+	}
+	// Genesis is not mined, so the proof of work is checked from block 1 on.
+	for i := 1; i < len(chain); i++ {
+		if err := bc.checkSuccessor(chain[:i], chain[i], latest); err != nil {
+			return &ChainError{i, err}
 		}
-		if !bc.ValidProof(b.Nonce(), b.PreviousHash(), b.Transactions(), MiningDifficulty) {
-			return false
+		if err := checkSequences(chain[i], sequences); err != nil {
+			return &ChainError{i, err}
 		}
-		preBlock = b
-		currentIndex += 1
+	}
+	return nil
+}
+func (bc *Blockchain) validSuccessor(chain []*Block, b *Block, latest int64) bool {
+	if err := bc.checkSuccessor(chain, b, latest); err != nil {
+		slog.Warn("invalid block", "height", len(chain), "error", err)
+		return false
+	}
+	return true
+}
+
+// checkSuccessor checks that b can be appended to chain: it links to and
+// follows the last block, is not newer than latest, carries the expected
+// difficulty and, unless we already hold it, the current version, pays a
+// single coinbase no larger than it may and has a valid body and proof of
+// work.
+func (bc *Blockchain) checkSuccessor(chain []*Block, b *Block, latest int64) error {
+	preBlock := chain[len(chain)-1]
+	if b.previousHash != preBlock.Hash() {
+		return fmt.Errorf("previous hash %x does not match parent %x", b.previousHash, preBlock.Hash())
+	}
+	if b.height != preBlock.height+1 {
+		return fmt.Errorf("height %d does not follow parent height %d", b.height, preBlock.height)
+	}
+	if b.timestamp <= preBlock.timestamp {
+		return errors.New("not newer than its parent")
+	}
+	if b.timestamp > latest {
+		return errors.New("too far in the future")
+	}
+	if want := nextDifficulty(chain); b.difficulty != want {
+		return fmt.Errorf("difficulty %d, expected %d", b.difficulty, want)
+	}
+	// Version 1 proofs do not cover the height or timestamp, so only blocks
+	// we already hold may still carry one.
+	if b.version < BlockVersion && !bc.storedBlock(b) {
+		return fmt.Errorf("version %d is only accepted for blocks already in the chain", b.version)
+	}
+	if b.pruned {
+		return bc.checkBlock(b)
+	}
+	if err := bc.checkCoinbase(b); err != nil {
+		return err
+	}
+	return bc.checkBlock(b)
+}
+
+// genesisPreviousHash commits the genesis block, and so every block after
+// it, to a network: chains built for another network id fail validGenesis.
+func genesisPreviousHash(networkID string) [32]byte {
+	return sha256.Sum256([]byte(networkID))
+}
+
+// validGenesis reports whether b is exactly the block genesis describes.
+func validGenesis(b *Block, genesis GenesisConfig) bool {
+	return b.merkleRoot == merkleRoot(b.transactions) &&
+		b.Hash() == genesis.Block().Hash()
+}
+
+// storedBlock reports whether b is already part of our chain.
+func (bc *Blockchain) storedBlock(b *Block) bool {
+	bc.muxChain.RLock()
+	defer bc.muxChain.RUnlock()
+	return b.height >= 0 && b.height < len(bc.chain) && bc.chain[b.height].Hash() == b.Hash()
+}
+func (bc *Blockchain) validBlock(b *Block) bool {
+	if err := bc.checkBlock(b); err != nil {
+		slog.Warn("invalid block", "height", b.height, "error", err)
+		return false
 	}
 	return true
 }
+
+// checkBlock checks what a block proves on its own: its size, a supported
+// version, a merkle root matching its transactions and its proof of work.
+func (bc *Blockchain) checkBlock(b *Block) error {
+	if size := b.serializedSize(); bc.maxBlockBytes > 0 && size > bc.maxBlockBytes {
+		return fmt.Errorf("block is %d bytes, over the %d byte limit", size, bc.maxBlockBytes)
+	}
+	return b.VerifySalted(b.difficulty, bc.genesis.PowSalt)
+}
 func (t *Transaction) UnmarshalJSON(data []byte) error {
 	v := &struct {
-		Sender    *string  `json:"sender_blockchain_address"'`
+		Sender    *string  `json:"sender_blockchain_address"`
 		Recipient *string  `json:"recipient_blockchain_address"`
 		Value     *float32 `json:"value"`
+		Fee       *float32 `json:"fee"`
+		Locktime  *int64   `json:"locktime"`
+		Sequence  *uint64  `json:"sequence"`
 	}{
 		Sender:    &t.senderBlockchainAddress,
 		Recipient: &t.recipientBlockchainAddress,
 		Value:     &t.value,
+		Fee:       &t.fee,
+		Locktime:  &t.locktime,
+		Sequence:  &t.sequence,
 	}
 	if err := json.Unmarshal(data, &v); err != nil {
 		return err
@@ -341,30 +1860,113 @@ type Transaction struct {
 	senderBlockchainAddress    string
 	recipientBlockchainAddress string
 	value                      float32
+	fee                        float32
+	locktime                   int64
+	sequence                   uint64
+	senderPublicKey            *ecdsa.PublicKey
+	signature                  *utils.Signature
+	// pooledAt is when the transaction entered our pool; it is local state
+	// and not part of the hash or the wire format.
+	pooledAt time.Time
 }
 
-func NewTransaction(sender string, recipient string, value float32) *Transaction {
+func NewTransaction(sender string, recipient string, value float32, fee float32, locktime int64, sequence uint64) *Transaction {
 	return &Transaction{
 		senderBlockchainAddress:    sender,
 		recipientBlockchainAddress: recipient,
 		value:                      value,
+		fee:                        fee,
+		locktime:                   locktime,
+		sequence:                   sequence,
+	}
+}
+
+// newCoinbase pays a block's reward and fees to recipient. A coinbase has
+// no sender sequence, so it carries the block height there instead, which
+// keeps its id unique across blocks.
+func newCoinbase(recipient string, value float32, height int) *Transaction {
+	return NewTransaction(MiningSender, recipient, value, 0, 0, uint64(height))
+}
+func (t *Transaction) Fee() float32 {
+	return t.fee
+}
+
+// cost is what the sender pays: the value plus the fee that goes to the miner.
+func (t *Transaction) cost() float32 {
+	return t.value + t.fee
+}
+func (t *Transaction) Locktime() int64 {
+	return t.locktime
+}
+
+// Sequence numbers a sender's transactions 0, 1, 2, ... so that a signed
+// transaction can't be replayed once it has been used.
+func (t *Transaction) Sequence() uint64 {
+	return t.sequence
+}
+func (t *Transaction) IsFinal(height int, now time.Time) bool {
+	if t.locktime == 0 {
+		return true
 	}
+	if t.locktime < LocktimeThreshold {
+		return int64(height) >= t.locktime
+	}
+	return now.Unix() >= t.locktime
 }
 func (t *Transaction) Print() {
 	fmt.Printf("%s\n", strings.Repeat("-", 40))
 	fmt.Printf("sender_blockchain_address 	%s\n", t.senderBlockchainAddress)
 	fmt.Printf("recipient_blockchain_address %s\n", t.recipientBlockchainAddress)
 	fmt.Printf("value 						%.1f\n", t.value)
+	fmt.Printf("fee 						%.3f\n", t.fee)
+	fmt.Printf("locktime 					%d\n", t.locktime)
+	fmt.Printf("sequence 					%d\n", t.sequence)
 }
-func (t *Transaction) MarshaJSON() ([]byte, error) {
-	return json.Marshal(struct {
+
+// payload is the canonical encoding of the signed fields. It must stay
+// byte-for-byte identical to wallet.Transaction's JSON. A zero sequence is
+// left out so transactions from before sequences keep their hashes.
+func (t *Transaction) payload() []byte {
+	m, _ := json.Marshal(struct {
 		Sender    string  `json:"sender_blockchain_address"`
 		Recipient string  `json:"recipient_blockchain_address"`
 		Value     float32 `json:"value"`
+		Fee       float32 `json:"fee"`
+		Locktime  int64   `json:"locktime"`
+		Sequence  uint64  `json:"sequence,omitempty"`
 	}{
 		Sender:    t.senderBlockchainAddress,
 		Recipient: t.recipientBlockchainAddress,
 		Value:     t.value,
+		Fee:       t.fee,
+		Locktime:  t.locktime,
+		Sequence:  t.sequence,
+	})
+	return m
+}
+func (t *Transaction) Hash() [32]byte {
+	return sha256.Sum256(t.payload())
+}
+func (t *Transaction) TransactionId() string {
+	return fmt.Sprintf("%x", t.Hash())
+}
+func (t *Transaction) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		TransactionId string  `json:"transaction_id"`
+		Sender        string  `json:"sender_blockchain_address"`
+		Recipient     string  `json:"recipient_blockchain_address"`
+		Value         float32 `json:"value"`
+		Fee           float32 `json:"fee"`
+		Locktime      int64   `json:"locktime"`
+		Sequence      uint64  `json:"sequence"`
+	}{
+		TransactionId: t.TransactionId(),
+		Sender:        t.senderBlockchainAddress,
+		Recipient:     t.recipientBlockchainAddress,
+		Value:         t.value,
+		Fee:           t.fee,
+		Locktime:      t.locktime,
+		Sequence:      t.sequence,
 	})
 }
 
@@ -374,6 +1976,9 @@ type TransactionRequest struct {
 	SenderPublicKey            *string  `json:"sender_public_key"`
 	Value                      *float32 `json:"value"`
 	Signature                  *string  `json:"signature"`
+	Fee                        *float32 `json:"fee,omitempty"`
+	Locktime                   *int64   `json:"locktime,omitempty"`
+	Sequence                   *uint64  `json:"sequence,omitempty"`
 }
 
 func (tr *TransactionRequest) Validate() bool {
@@ -384,8 +1989,47 @@ func (tr *TransactionRequest) Validate() bool {
 		tr.SenderPublicKey == nil {
 		return false
 	}
+	if tr.Fee != nil && *tr.Fee < 0 {
+		return false
+	}
+	if !utils.ValidateAddress(*tr.RecipientBlockchainAddress) {
+		return false
+	}
 	return true
 }
+func (tr *TransactionRequest) Transaction() *Transaction {
+	var fee float32
+	if tr.Fee != nil {
+		fee = *tr.Fee
+	}
+	var locktime int64
+	if tr.Locktime != nil {
+		locktime = *tr.Locktime
+	}
+	var sequence uint64
+	if tr.Sequence != nil {
+		sequence = *tr.Sequence
+	}
+	return NewTransaction(*tr.SenderBlockchainAddress, *tr.RecipientBlockchainAddress, *tr.Value, fee, locktime, sequence)
+}
+
+type PoolAuditResult struct {
+	Hash   [32]byte
+	Valid  bool
+	Reason string
+}
+
+func (r PoolAuditResult) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Hash   string `json:"hash"`
+		Valid  bool   `json:"valid"`
+		Reason string `json:"reason,omitempty"`
+	}{
+		Hash:   fmt.Sprintf("%x", r.Hash),
+		Valid:  r.Valid,
+		Reason: r.Reason,
+	})
+}
 
 type AmountResponse struct {
 	Amount float32 `json:"amount"`
@@ -398,3 +2042,8 @@ func (ar *AmountResponse) MarshalJSON() ([]byte, error) {
 		Amount: ar.Amount,
 	})
 }
+
+type ThroughputStats struct {
+	AvgTxPerBlock float64 `json:"avg_tx_per_block"`
+	TxPerSecond   float64 `json:"tx_per_second"`
+}
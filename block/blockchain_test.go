@@ -0,0 +1,291 @@
+package block
+
+import (
+	"context"
+	"encoding/json"
+	"goblockchain/utils"
+	"goblockchain/wallet"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMiningAnnouncesBlock(t *testing.T) {
+	type request struct {
+		method, path string
+		body         []byte
+	}
+	var mu sync.Mutex
+	var requests []request
+	neighbor := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		mu.Lock()
+		requests = append(requests, request{req.Method, req.URL.Path, body})
+		mu.Unlock()
+	}))
+	defer neighbor.Close()
+	alice, bob := newTestWallet(t), newTestWallet(t)
+	bc := newTestChain(t, alice)
+	if err := addTransaction(bc, signedTransaction(alice, bob, 1, 0.1, 0)); err != nil {
+		t.Fatal(err)
+	}
+	bc.neighbors = []string{strings.TrimPrefix(neighbor.URL, "http://")}
+	if !bc.Mining() {
+		t.Fatal("nothing mined")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(requests) != 1 || requests[0].method != http.MethodPost || requests[0].path != "/block" {
+		t.Fatalf("neighbor got %v, want one POST /block", requests)
+	}
+	var b Block
+	if err := json.Unmarshal(requests[0].body, &b); err != nil {
+		t.Fatal(err)
+	}
+	if b.Hash() != bc.LastBlock().Hash() {
+		t.Fatal("announced block is not the mined one")
+	}
+}
+func TestThroughput(t *testing.T) {
+	alice, bob := newTestWallet(t), newTestWallet(t)
+	start := time.Unix(1700000000, 0)
+	bc := NewBlockchainWithGenesis(testMiner, 5000, "", GenesisConfig{
+		Timestamp:   start.UnixNano(),
+		Allocations: map[string]float32{alice.BlockchainAddress(): 100},
+	})
+	if got := bc.Throughput(); got.AvgTxPerBlock != 1 || got.TxPerSecond != 0 {
+		t.Fatalf("genesis only: got %+v, want 1 transaction per block and no rate", got)
+	}
+	for i := 0; i < 2; i++ {
+		now := start.Add(time.Duration(i+1) * 10 * time.Second)
+		bc.SetClock(func() time.Time { return now })
+		if err := addTransaction(bc, signedTransaction(alice, bob, 1, 0.1, uint64(i))); err != nil {
+			t.Fatal(err)
+		}
+		if !bc.Mining() {
+			t.Fatal("nothing mined")
+		}
+	}
+	// Genesis has one allocation; each mined block a transfer and a coinbase.
+	got := bc.Throughput()
+	if want := 5.0 / 3; got.AvgTxPerBlock != want {
+		t.Errorf("AvgTxPerBlock %v, want %v", got.AvgTxPerBlock, want)
+	}
+	if want := 5.0 / 20; got.TxPerSecond != want {
+		t.Errorf("TxPerSecond %v, want %v", got.TxPerSecond, want)
+	}
+}
+func TestSerializedSize(t *testing.T) {
+	alice, bob := newTestWallet(t), newTestWallet(t)
+	bc := newTestChain(t, alice)
+	marshaledSize := func() int {
+		m, err := json.Marshal(&Blockchain{chain: bc.Chain()})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(m)
+	}
+	before := bc.SerializedSize()
+	if want := marshaledSize(); before != want {
+		t.Fatalf("genesis only: size %d, serialized %d", before, want)
+	}
+	if err := addTransaction(bc, signedTransaction(alice, bob, 1, 0.1, 0)); err != nil {
+		t.Fatal(err)
+	}
+	if !bc.Mining() {
+		t.Fatal("nothing mined")
+	}
+	after := bc.SerializedSize()
+	if after <= before {
+		t.Fatalf("size %d after mining, was %d", after, before)
+	}
+	if want := marshaledSize(); after != want {
+		t.Fatalf("size %d, serialized %d", after, want)
+	}
+}
+func TestNeighborEndpointScheme(t *testing.T) {
+	for _, c := range []struct {
+		scheme, want string
+	}{
+		{"", "http://127.0.0.1:5001/chain"},
+		{"http", "http://127.0.0.1:5001/chain"},
+		{"https", "https://127.0.0.1:5001/chain"},
+	} {
+		bc := NewBlockchain(testMiner, 5000, c.scheme)
+		if got := bc.neighborEndpoint("127.0.0.1:5001", "/chain"); got != c.want {
+			t.Errorf("scheme %q: endpoint %s, want %s", c.scheme, got, c.want)
+		}
+	}
+}
+
+// longChain mines n blocks of one transaction each. Blocks are a minute
+// apart on the chain's clock, so the difficulty falls to 1 and mining stays
+// cheap.
+func longChain(tb testing.TB, n int) *Blockchain {
+	tb.Helper()
+	alice, err := wallet.NewWallet()
+	if err != nil {
+		tb.Fatal(err)
+	}
+	bob, err := wallet.NewWallet()
+	if err != nil {
+		tb.Fatal(err)
+	}
+	bc := NewBlockchainWithGenesis(testMiner, 5000, "", GenesisConfig{
+		Allocations: map[string]float32{alice.BlockchainAddress(): 1000},
+	})
+	now := time.Unix(0, DefaultGenesisTimestamp)
+	bc.SetClock(func() time.Time { return now })
+	for i := 0; i < n; i++ {
+		now = now.Add(time.Minute)
+		if err := addTransaction(bc, signedTransaction(alice, bob, 0.5, 0, uint64(i))); err != nil {
+			tb.Fatal(err)
+		}
+		if !bc.Mining() {
+			tb.Fatal("nothing mined")
+		}
+	}
+	return bc
+}
+func TestCachedHash(t *testing.T) {
+	bc := longChain(t, 3)
+	for _, b := range bc.Chain() {
+		if b.Hash() != b.Header().Hash() {
+			t.Fatalf("block %d: cached hash differs from its header hash", b.Height())
+		}
+	}
+	b := bc.LastBlock()
+	cached := b.Hash()
+	m, err := json.Marshal(bc.Chain()[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var reused Block
+	reused.Hash()
+	if err := json.Unmarshal(m, &reused); err != nil {
+		t.Fatal(err)
+	}
+	if reused.Hash() != bc.Chain()[1].Hash() {
+		t.Fatal("decoding kept a stale cached hash")
+	}
+	if b.Hash() != cached {
+		t.Fatal("hash changed between calls")
+	}
+}
+func benchmarkValidChain(b *testing.B, cached bool) {
+	bc := longChain(b, 1000)
+	chain := bc.Chain()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if !cached {
+			for _, block := range chain {
+				block.invalidateHash()
+			}
+		}
+		if !bc.ValidChain(chain) {
+			b.Fatal("invalid chain")
+		}
+	}
+}
+func BenchmarkValidChainCachedHashes(b *testing.B) {
+	benchmarkValidChain(b, true)
+}
+func BenchmarkValidChainUncachedHashes(b *testing.B) {
+	benchmarkValidChain(b, false)
+}
+
+// mineSpaced mines n blocks, each with one transfer, spacing their
+// timestamps so the difficulty rises (short spacing) or falls (long).
+func mineSpaced(t *testing.T, bc *Blockchain, from, to *wallet.Wallet, n int, spacing time.Duration) {
+	t.Helper()
+	now := time.Unix(0, DefaultGenesisTimestamp)
+	bc.SetClock(func() time.Time { return now })
+	for i := 0; i < n; i++ {
+		now = now.Add(spacing)
+		if err := addTransaction(bc, signedTransaction(from, to, 1, 0, uint64(i))); err != nil {
+			t.Fatal(err)
+		}
+		if !bc.Mining() {
+			t.Fatal("nothing mined")
+		}
+	}
+	bc.SetClock(time.Now)
+}
+func TestResolveConflictsPrefersMostWork(t *testing.T) {
+	alice, bob := newTestWallet(t), newTestWallet(t)
+	heavy := newTestChain(t, alice)
+	mineSpaced(t, heavy, alice, bob, 21, time.Second)
+	long := newTestChain(t, alice)
+	mineSpaced(t, long, alice, bob, 22, time.Minute)
+	if len(heavy.Chain()) >= len(long.Chain()) {
+		t.Fatal("heavy chain is not the shorter one")
+	}
+	if heavy.LastBlock().Difficulty() <= long.LastBlock().Difficulty() {
+		t.Fatalf("difficulty %d on the heavy chain, %d on the long one", heavy.LastBlock().Difficulty(), long.LastBlock().Difficulty())
+	}
+	if chainWork(heavy.Chain()).Cmp(chainWork(long.Chain())) <= 0 {
+		t.Fatal("heavy chain has no more work")
+	}
+	heavyData, err := heavy.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	longData, err := long.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	bc := newTestChain(t, alice)
+	bc.neighbors = []string{servePeer(t, longData), servePeer(t, heavyData)}
+	if !bc.ResolveConflicts(context.Background()) {
+		t.Fatal("no chain adopted")
+	}
+	if bc.LastBlock().Hash() != heavy.LastBlock().Hash() {
+		t.Fatal("adopted the longer chain over the one with more work")
+	}
+	long.neighbors = []string{servePeer(t, heavyData)}
+	if !long.ResolveConflicts(context.Background()) {
+		t.Fatal("long chain not replaced by the heavier one")
+	}
+	heavy.neighbors = []string{servePeer(t, longData)}
+	if heavy.ResolveConflicts(context.Background()) {
+		t.Fatal("heavy chain replaced by one with less work")
+	}
+}
+func TestClockSetsBlockTimestamp(t *testing.T) {
+	alice, bob := newTestWallet(t), newTestWallet(t)
+	bc := newTestChain(t, alice)
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	bc.SetClock(func() time.Time { return now })
+	if err := addTransaction(bc, signedTransaction(alice, bob, 1, 0.1, 0)); err != nil {
+		t.Fatal(err)
+	}
+	if !bc.Mining() {
+		t.Fatal("nothing mined")
+	}
+	if got := bc.LastBlock().timestamp; got != now.UnixNano() {
+		t.Fatalf("mined block timestamp %d, want %d", got, now.UnixNano())
+	}
+	now = now.Add(time.Minute)
+	if got := bc.CreateBlock(0, bc.LastBlock().Hash()).timestamp; got != now.UnixNano() {
+		t.Fatalf("created block timestamp %d, want %d", got, now.UnixNano())
+	}
+}
+func TestRegisterNeighborRejectsSelf(t *testing.T) {
+	bc := newTestChain(t)
+	for _, address := range []string{"127.0.0.1:5000", "localhost:5000", net.JoinHostPort(utils.GetHost(), "5000")} {
+		if err := bc.RegisterNeighbor(address); err == nil {
+			t.Errorf("registered own address %s", address)
+		}
+	}
+	if err := bc.RegisterNeighbor("127.0.0.1:5001"); err != nil {
+		t.Fatal(err)
+	}
+	if neighbors := bc.Neighbors(); len(neighbors) != 1 || neighbors[0] != "127.0.0.1:5001" {
+		t.Fatalf("neighbors %v, want 127.0.0.1:5001", neighbors)
+	}
+}
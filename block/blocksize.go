@@ -0,0 +1,41 @@
+package block
+
+import (
+	"encoding/json"
+	"math"
+)
+
+// SetMaxBlockBytes caps the serialized size of a block, both for blocks we
+// mine and blocks we accept. Zero or less removes the cap.
+func (bc *Blockchain) SetMaxBlockBytes(n int) {
+	bc.maxBlockBytes = n
+}
+
+// fitBlockBytes keeps the longest prefix of transactions that fits in
+// maxBlockBytes along with the coinbase Mining appends. Stopping at the
+// first transaction that doesn't fit keeps each sender's sequence intact;
+// the rest stay in the pool.
+func (bc *Blockchain) fitBlockBytes(height int, transactions []*Transaction) []*Transaction {
+	if bc.maxBlockBytes <= 0 {
+		return transactions
+	}
+	// The nonce, timestamp and coinbase value aren't known yet, so size the
+	// block with the widest values they can take.
+	skeleton := &Block{
+		version:      BlockVersion,
+		height:       height,
+		timestamp:    math.MaxInt64,
+		nonce:        math.MinInt64,
+		difficulty:   bc.difficulty,
+		transactions: []*Transaction{newCoinbase(bc.blockchainAddress, math.MaxFloat32, height)},
+	}
+	size := skeleton.serializedSize()
+	for i, t := range transactions {
+		m, _ := json.Marshal(t)
+		// Each further array element adds a comma.
+		if size += len(m) + 1; size > bc.maxBlockBytes {
+			return transactions[:i]
+		}
+	}
+	return transactions
+}
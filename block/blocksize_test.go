@@ -0,0 +1,78 @@
+package block
+
+import (
+	"errors"
+	"goblockchain/wallet"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestMaxBlockBytes(t *testing.T) {
+	wallets := make([]*wallet.Wallet, 5)
+	for i := range wallets {
+		wallets[i] = newTestWallet(t)
+	}
+	bob := newTestWallet(t)
+	bc := newTestChain(t, wallets...)
+	for _, w := range wallets {
+		if err := addTransaction(bc, signedTransaction(w, bob, 1, 0.1, 0)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fits := func(limit int) int {
+		bc.SetMaxBlockBytes(limit)
+		return len(bc.fitBlockBytes(len(bc.Chain()), bc.TransactionPool()))
+	}
+	// The smallest cap that fits two transactions, and one byte less.
+	limit := sort.Search(1<<16, func(n int) bool { return fits(n) >= 2 })
+	if got := fits(limit - 1); got != 1 {
+		t.Fatalf("%d bytes fit %d transactions, want 1", limit-1, got)
+	}
+	bc.SetMaxBlockBytes(limit)
+	if !bc.Mining() {
+		t.Fatal("nothing mined")
+	}
+	b := bc.LastBlock()
+	if n := len(b.Transactions()); n != 3 {
+		t.Fatalf("block has %d transactions, want 2 and the coinbase", n)
+	}
+	if size := b.serializedSize(); size > limit {
+		t.Fatalf("block is %d bytes, over the %d byte cap", size, limit)
+	}
+	if n := len(bc.TransactionPool()); n != 3 {
+		t.Fatalf("%d transactions left in the pool, want 3", n)
+	}
+	if got := fits(0); got != 3 {
+		t.Fatalf("uncapped: %d of 3 transactions fit", got)
+	}
+}
+func TestOversizedBlockRejected(t *testing.T) {
+	alice, bob := newTestWallet(t), newTestWallet(t)
+	bc := newTestChain(t, alice)
+	peer := newTestChain(t, alice)
+	for i := 0; i < 3; i++ {
+		if err := addTransaction(peer, signedTransaction(alice, bob, 1, 0.1, uint64(i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !peer.Mining() {
+		t.Fatal("nothing mined")
+	}
+	b := peer.LastBlock()
+	bc.SetMaxBlockBytes(b.serializedSize() - 1)
+	err := bc.checkBlock(b)
+	if err == nil || !strings.Contains(err.Error(), "byte limit") {
+		t.Fatalf("got %v, want a size error", err)
+	}
+	if bc.ValidChain(peer.Chain()) {
+		t.Fatal("chain with an oversized block accepted")
+	}
+	if err := bc.AcceptBlock(b); !errors.Is(err, ErrInvalidBlock) {
+		t.Fatalf("got %v, want %v", err, ErrInvalidBlock)
+	}
+	bc.SetMaxBlockBytes(b.serializedSize())
+	if err := bc.AcceptBlock(b); err != nil {
+		t.Fatalf("block at the cap: %v", err)
+	}
+}
@@ -0,0 +1,79 @@
+package block
+
+import (
+	"sync"
+	"time"
+)
+
+type EventType int
+
+const (
+	EventBlockMined EventType = iota
+	EventTransactionAdded
+	EventPoolCleared
+	EventReorg
+	EventBlockAccepted
+)
+
+func (et EventType) String() string {
+	switch et {
+	case EventBlockMined:
+		return "block_mined"
+	case EventTransactionAdded:
+		return "transaction_added"
+	case EventPoolCleared:
+		return "pool_cleared"
+	case EventReorg:
+		return "reorg"
+	case EventBlockAccepted:
+		return "block_accepted"
+	default:
+		return "unknown"
+	}
+}
+
+type Event struct {
+	Type        EventType
+	Block       *Block
+	Transaction *Transaction
+	// Duration is how long proof of work took, set for EventBlockMined.
+	Duration time.Duration
+}
+
+const eventBufferSize = 64
+
+type eventBus struct {
+	mux         sync.Mutex
+	subscribers map[chan Event]struct{}
+}
+
+// Subscribe returns a channel receiving every event emitted after the call
+// and a function that unsubscribes and closes it. Events are dropped for
+// subscribers that let their buffer fill up.
+func (bc *Blockchain) Subscribe() (<-chan Event, func()) {
+	ch := make(chan Event, eventBufferSize)
+	bc.events.mux.Lock()
+	defer bc.events.mux.Unlock()
+	if bc.events.subscribers == nil {
+		bc.events.subscribers = make(map[chan Event]struct{})
+	}
+	bc.events.subscribers[ch] = struct{}{}
+	return ch, func() {
+		bc.events.mux.Lock()
+		defer bc.events.mux.Unlock()
+		if _, ok := bc.events.subscribers[ch]; ok {
+			delete(bc.events.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+func (bc *Blockchain) emit(e Event) {
+	bc.events.mux.Lock()
+	defer bc.events.mux.Unlock()
+	for ch := range bc.events.subscribers {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package block
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// drain returns how many events of each type are waiting on events.
+func drain(events <-chan Event) map[EventType]int {
+	counts := make(map[EventType]int)
+	for {
+		select {
+		case e := <-events:
+			counts[e.Type]++
+		default:
+			return counts
+		}
+	}
+}
+func TestCoreActionsEmitOnce(t *testing.T) {
+	alice, bob := newTestWallet(t), newTestWallet(t)
+	genesis := GenesisConfig{
+		Timestamp:   time.Unix(1700000000, 0).UnixNano(),
+		Allocations: map[string]float32{alice.BlockchainAddress(): 100},
+	}
+	bc := NewBlockchainWithGenesis(testMiner, 5000, "", genesis)
+	events, unsubscribe := bc.Subscribe()
+	defer unsubscribe()
+	expect := func(action string, want EventType) {
+		t.Helper()
+		counts := drain(events)
+		if counts[want] != 1 || len(counts) != 1 {
+			t.Fatalf("%s emitted %v, want one %v", action, counts, want)
+		}
+	}
+	if err := addTransaction(bc, signedTransaction(alice, bob, 1, 0.1, 0)); err != nil {
+		t.Fatal(err)
+	}
+	expect("AddTransaction", EventTransactionAdded)
+	if !bc.Mining() {
+		t.Fatal("nothing mined")
+	}
+	expect("Mining", EventBlockMined)
+	if err := addTransaction(bc, signedTransaction(alice, bob, 1, 0.1, 1)); err != nil {
+		t.Fatal(err)
+	}
+	drain(events)
+	bc.ClearTransactionPool()
+	expect("ClearTransactionPool", EventPoolCleared)
+	other := NewBlockchainWithGenesis(testMiner, 5000, "", genesis)
+	for i := 0; i < 2; i++ {
+		if err := addTransaction(other, signedTransaction(alice, bob, 2, 0.1, uint64(i))); err != nil {
+			t.Fatal(err)
+		}
+		other.Mining()
+	}
+	data, err := other.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	bc.neighbors = []string{servePeer(t, data)}
+	if !bc.ResolveConflicts(context.Background()) {
+		t.Fatal("heavier chain not adopted")
+	}
+	expect("ResolveConflicts", EventReorg)
+	unsubscribe()
+	if _, ok := <-events; ok {
+		t.Fatal("events still delivered after unsubscribing")
+	}
+}
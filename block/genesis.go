@@ -0,0 +1,84 @@
+package block
+
+import (
+	"encoding/json"
+	"fmt"
+	"goblockchain/utils"
+	"os"
+	"sort"
+)
+
+// DefaultNetworkID is used when a GenesisConfig leaves NetworkID empty.
+const DefaultNetworkID = "mainnet"
+
+// DefaultGenesisTimestamp (2023-01-01T00:00:00Z) is used when a
+// GenesisConfig leaves Timestamp zero, so that nodes agree on the genesis
+// block without configuring one.
+const DefaultGenesisTimestamp int64 = 1672531200000000000
+
+type GenesisConfig struct {
+	// PowSalt is mixed into every proof-of-work hash so blocks mined for
+	// one network never validate on another.
+	PowSalt string `json:"pow_salt,omitempty"`
+	// NetworkID names the network; peers on a different one are ignored.
+	NetworkID string `json:"network_id,omitempty"`
+	// Timestamp is the genesis block time in Unix nanoseconds.
+	Timestamp int64 `json:"timestamp,omitempty"`
+	// Allocations credits addresses in the genesis block. They are paid
+	// like coinbase outputs but can be spent right away.
+	Allocations map[string]float32 `json:"allocations,omitempty"`
+}
+
+// LoadGenesisConfig reads a GenesisConfig from a JSON file.
+func LoadGenesisConfig(path string) (GenesisConfig, error) {
+	var g GenesisConfig
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return g, err
+	}
+	if err := json.Unmarshal(data, &g); err != nil {
+		return g, err
+	}
+	return g, g.Validate()
+}
+
+// Validate checks that every allocation pays a positive amount to a valid
+// blockchain address.
+func (g GenesisConfig) Validate() error {
+	for address, value := range g.Allocations {
+		if !utils.ValidateAddress(address) {
+			return fmt.Errorf("genesis allocation to invalid address %q", address)
+		}
+		if value <= 0 {
+			return fmt.Errorf("genesis allocation to %s must be positive", address)
+		}
+	}
+	return nil
+}
+func (g GenesisConfig) withDefaults() GenesisConfig {
+	if g.NetworkID == "" {
+		g.NetworkID = DefaultNetworkID
+	}
+	if g.Timestamp == 0 {
+		g.Timestamp = DefaultGenesisTimestamp
+	}
+	return g
+}
+
+// Block builds the genesis block described by g. Nodes with the same
+// config always build the same block.
+func (g GenesisConfig) Block() *Block {
+	g = g.withDefaults()
+	addresses := make([]string, 0, len(g.Allocations))
+	for address := range g.Allocations {
+		addresses = append(addresses, address)
+	}
+	sort.Strings(addresses)
+	transactions := make([]*Transaction, 0, len(addresses))
+	for _, address := range addresses {
+		transactions = append(transactions, NewTransaction(MiningSender, address, g.Allocations[address], 0, 0, 0))
+	}
+	b := NewBlock(0, genesisPreviousHash(g.NetworkID), transactions)
+	b.timestamp = g.Timestamp
+	return b
+}
@@ -0,0 +1,109 @@
+package block
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGenesisDeterministic(t *testing.T) {
+	alice, bob := newTestWallet(t), newTestWallet(t)
+	config := GenesisConfig{
+		NetworkID: "testnet",
+		Timestamp: 1700000000000000000,
+		Allocations: map[string]float32{
+			alice.BlockchainAddress(): 100,
+			bob.BlockchainAddress():   50,
+		},
+	}
+	// The same allocations added in another order.
+	same := config
+	same.Allocations = map[string]float32{bob.BlockchainAddress(): 50}
+	same.Allocations[alice.BlockchainAddress()] = 100
+	first := NewBlockchainWithGenesis(testMiner, 5000, "", config).LastBlock()
+	second := NewBlockchainWithGenesis("another miner", 5001, "https", same).LastBlock()
+	if first.Hash() != second.Hash() {
+		t.Fatal("identical configs built different genesis blocks")
+	}
+	if config.Block().Hash() != first.Hash() {
+		t.Fatal("config's block differs from the chain's genesis")
+	}
+	if (GenesisConfig{}).Block().Hash() != (GenesisConfig{NetworkID: DefaultNetworkID, Timestamp: DefaultGenesisTimestamp}).Block().Hash() {
+		t.Fatal("empty config does not default")
+	}
+	for name, change := range map[string]func(*GenesisConfig){
+		"network id": func(g *GenesisConfig) { g.NetworkID = "mainnet" },
+		"timestamp":  func(g *GenesisConfig) { g.Timestamp++ },
+		"allocation": func(g *GenesisConfig) {
+			g.Allocations = map[string]float32{alice.BlockchainAddress(): 100, bob.BlockchainAddress(): 51}
+		},
+		"no allocations": func(g *GenesisConfig) { g.Allocations = nil },
+	} {
+		changed := config
+		change(&changed)
+		if changed.Block().Hash() == first.Hash() {
+			t.Errorf("changing the %s leaves the genesis hash unchanged", name)
+		}
+	}
+}
+func TestGenesisAllocation(t *testing.T) {
+	alice, bob, carol := newTestWallet(t), newTestWallet(t), newTestWallet(t)
+	bc := NewBlockchainWithGenesis(testMiner, 5000, "", GenesisConfig{
+		Allocations: map[string]float32{alice.BlockchainAddress(): 250, bob.BlockchainAddress(): 0.5},
+	})
+	for _, c := range []struct {
+		address string
+		want    float32
+	}{
+		{alice.BlockchainAddress(), 250},
+		{bob.BlockchainAddress(), 0.5},
+		{carol.BlockchainAddress(), 0},
+	} {
+		if got := bc.CalculateTotalAmount(c.address); got != c.want {
+			t.Errorf("%s: scanned balance %v, want %v", c.address, got, c.want)
+		}
+		if got := bc.Balance(c.address); got != c.want {
+			t.Errorf("%s: indexed balance %v, want %v", c.address, got, c.want)
+		}
+	}
+	// Allocations are spendable right away, unlike mined coinbases.
+	if err := addTransaction(bc, signedTransaction(alice, carol, 200, 0.1, 0)); err != nil {
+		t.Fatalf("spending an allocation: %v", err)
+	}
+}
+func TestGenesisConfigValidate(t *testing.T) {
+	alice := newTestWallet(t)
+	if err := (GenesisConfig{Allocations: map[string]float32{alice.BlockchainAddress(): 1}}).Validate(); err != nil {
+		t.Fatal(err)
+	}
+	for name, allocations := range map[string]map[string]float32{
+		"invalid address": {"not an address": 1},
+		"zero value":      {alice.BlockchainAddress(): 0},
+		"negative value":  {alice.BlockchainAddress(): -5},
+	} {
+		if err := (GenesisConfig{Allocations: allocations}).Validate(); err == nil {
+			t.Errorf("%s accepted", name)
+		}
+	}
+}
+func TestLoadGenesisConfig(t *testing.T) {
+	alice := newTestWallet(t)
+	path := filepath.Join(t.TempDir(), "genesis.json")
+	data := `{"network_id":"testnet","timestamp":5,"allocations":{"` + alice.BlockchainAddress() + `":42}}`
+	if err := os.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+	g, err := LoadGenesisConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g.NetworkID != "testnet" || g.Timestamp != 5 || g.Allocations[alice.BlockchainAddress()] != 42 {
+		t.Fatalf("loaded %+v", g)
+	}
+	if err := os.WriteFile(path, []byte(`{"allocations":{"x":1}}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadGenesisConfig(path); err == nil {
+		t.Fatal("invalid allocation loaded")
+	}
+}
@@ -0,0 +1,120 @@
+package block
+
+import (
+	"container/list"
+	"context"
+	"crypto/ecdsa"
+	"encoding/json"
+	"fmt"
+	"goblockchain/utils"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+)
+
+// SeenTransactionsSize is how many transaction ids a node remembers for
+// relay deduplication.
+const SeenTransactionsSize = 10000
+
+// RelayFromHeader carries the host:port of the node that relayed a request,
+// so the receiver doesn't send it straight back.
+const RelayFromHeader = "X-Relay-From"
+
+// seenSet is a bounded set that forgets the least recently added id first.
+type seenSet struct {
+	mux   sync.Mutex
+	size  int
+	order *list.List
+	ids   map[string]*list.Element
+}
+
+func newSeenSet(size int) *seenSet {
+	return &seenSet{size: size, order: list.New(), ids: make(map[string]*list.Element)}
+}
+
+// add records id and reports whether it was new.
+func (s *seenSet) add(id string) bool {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if e, ok := s.ids[id]; ok {
+		s.order.MoveToFront(e)
+		return false
+	}
+	s.ids[id] = s.order.PushFront(id)
+	if s.order.Len() > s.size {
+		oldest := s.order.Back()
+		s.order.Remove(oldest)
+		delete(s.ids, oldest.Value.(string))
+	}
+	return true
+}
+
+// has reports whether id has been added.
+func (s *seenSet) has(id string) bool {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	_, ok := s.ids[id]
+	return ok
+}
+
+// RelayTransaction adds a transaction received from the neighbor at from,
+// or from a client when from is empty, and passes it on to every other
+// neighbor, giving up on neighbors once ctx is done. A transaction id is
+// only relayed once, so gossip dies out instead of bouncing around the
+// network. Rejected transactions are not remembered: one that arrived too
+// early, ahead of its predecessor, is accepted when it is sent again.
+func (bc *Blockchain) RelayTransaction(ctx context.Context, t *Transaction, senderPublicKey *ecdsa.PublicKey, s *utils.Signature, from string) error {
+	if bc.seen.has(t.TransactionId()) {
+		return ErrDuplicateTransaction
+	}
+	if err := bc.AddTransaction(t, senderPublicKey, s); err != nil {
+		return err
+	}
+	bc.seen.add(t.TransactionId())
+	m, _ := json.Marshal(transactionRequest(t))
+	bc.broadcast(ctx, http.MethodPut, "/transactions", m, from)
+	return nil
+}
+
+// transactionRequest is a pooled transaction as neighbors and saved pools
+// carry it, with its sender's public key and signature.
+func transactionRequest(t *Transaction) *TransactionRequest {
+	publicKeyStr := fmt.Sprintf("%064x%064x", t.senderPublicKey.X.Bytes(), t.senderPublicKey.Y.Bytes())
+	signturaStr := t.signature.String()
+	return &TransactionRequest{
+		SenderBlockchainAddress:    &t.senderBlockchainAddress,
+		RecipientBlockchainAddress: &t.recipientBlockchainAddress,
+		SenderPublicKey:            &publicKeyStr,
+		Value:                      &t.value,
+		Signature:                  &signturaStr,
+		Fee:                        &t.fee,
+		Locktime:                   &t.locktime,
+		Sequence:                   &t.sequence,
+	}
+}
+
+// selfAddress is the host:port neighbors know this node by.
+func (bc *Blockchain) selfAddress() string {
+	return net.JoinHostPort(utils.GetHost(), strconv.Itoa(int(bc.port)))
+}
+
+// sameNode reports whether two host:port addresses reach the same node.
+func sameNode(a string, b string) bool {
+	if a == b {
+		return true
+	}
+	aHost, aPort, err := net.SplitHostPort(a)
+	if err != nil {
+		return false
+	}
+	bHost, bPort, err := net.SplitHostPort(b)
+	if err != nil || aPort != bPort {
+		return false
+	}
+	port, err := strconv.ParseUint(aPort, 10, 16)
+	if err != nil {
+		return false
+	}
+	return utils.IsSelf(aHost, uint16(port), bHost, uint16(port))
+}
@@ -0,0 +1,244 @@
+package block
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRelayTransactionRetriesRejected(t *testing.T) {
+	alice, bob := newTestWallet(t), newTestWallet(t)
+	bc := newTestChain(t, alice)
+	first := signedTransaction(alice, bob, 1, 0.1, 0)
+	second := signedTransaction(alice, bob, 1, 0.1, 1)
+	if err := bc.RelayTransaction(context.Background(), second, second.senderPublicKey, second.signature, ""); !errors.Is(err, ErrSequenceGap) {
+		t.Fatalf("early transaction: got %v, want %v", err, ErrSequenceGap)
+	}
+	if err := bc.RelayTransaction(context.Background(), first, first.senderPublicKey, first.signature, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := bc.RelayTransaction(context.Background(), second, second.senderPublicKey, second.signature, ""); err != nil {
+		t.Fatalf("resent transaction: %v", err)
+	}
+	if err := bc.RelayTransaction(context.Background(), second, second.senderPublicKey, second.signature, ""); !errors.Is(err, ErrDuplicateTransaction) {
+		t.Fatalf("relayed twice: got %v, want %v", err, ErrDuplicateTransaction)
+	}
+}
+func TestSeenSetForgetsOldest(t *testing.T) {
+	s := newSeenSet(2)
+	for _, id := range []string{"a", "b", "c"} {
+		if !s.add(id) {
+			t.Fatalf("%s reported as seen", id)
+		}
+	}
+	if s.has("a") {
+		t.Fatal("oldest id still remembered")
+	}
+	if !s.has("b") || !s.has("c") || s.add("c") {
+		t.Fatal("recent ids forgotten")
+	}
+}
+func TestRelayTransactionStopsWithContext(t *testing.T) {
+	release := make(chan struct{})
+	neighbor := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		select {
+		case <-release:
+		case <-req.Context().Done():
+		}
+	}))
+	defer neighbor.Close()
+	defer close(release)
+	alice, bob := newTestWallet(t), newTestWallet(t)
+	bc := newTestChain(t, alice)
+	bc.neighbors = []string{strings.TrimPrefix(neighbor.URL, "http://")}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	tx := signedTransaction(alice, bob, 1, 0.1, 0)
+	start := time.Now()
+	if err := bc.RelayTransaction(ctx, tx, tx.senderPublicKey, tx.signature, ""); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("relay took %v after its context was done", elapsed)
+	}
+}
+func TestRelayTransactionBroadcastsOnce(t *testing.T) {
+	var mu sync.Mutex
+	relayed := 0
+	neighbor := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		relayed++
+		mu.Unlock()
+	}))
+	defer neighbor.Close()
+	alice, bob := newTestWallet(t), newTestWallet(t)
+	bc := newTestChain(t, alice)
+	bc.neighbors = []string{strings.TrimPrefix(neighbor.URL, "http://")}
+	tx := signedTransaction(alice, bob, 1, 0.1, 0)
+	for i := 0; i < 2; i++ {
+		bc.RelayTransaction(context.Background(), tx, tx.senderPublicKey, tx.signature, "")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if relayed != 1 {
+		t.Fatalf("relayed %d times, want once", relayed)
+	}
+}
+func TestNeighborsMutatedWhileBroadcasting(t *testing.T) {
+	neighbor := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+	defer neighbor.Close()
+	bc := newTestChain(t)
+	bc.SetNeighborRetry(1, 0)
+	address := strings.TrimPrefix(neighbor.URL, "http://")
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			bc.RegisterNeighbor(address)
+			bc.RemoveNeighbor(address)
+		}
+	}()
+	for i := 0; i < 50; i++ {
+		bc.broadcast(context.Background(), http.MethodPost, "/transactions", []byte("{}"), "")
+		neighbors := bc.Neighbors()
+		if len(neighbors) > 0 {
+			// The snapshot is the caller's to change.
+			neighbors[0] = "changed"
+		}
+	}
+	close(done)
+	wg.Wait()
+	for _, n := range bc.Neighbors() {
+		if n == "changed" {
+			t.Fatal("changing a snapshot changed the neighbor list")
+		}
+	}
+}
+func TestUnreachableNeighbors(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closed := l.Addr().String()
+	l.Close()
+	release := make(chan struct{})
+	hanging := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		select {
+		case <-release:
+		case <-req.Context().Done():
+		}
+	}))
+	defer hanging.Close()
+	defer close(release)
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		http.Error(w, "down", http.StatusInternalServerError)
+	}))
+	defer failing.Close()
+	alice, bob := newTestWallet(t), newTestWallet(t)
+	bc := newTestChain(t, alice)
+	bc.SetNeighborTimeout(100 * time.Millisecond)
+	bc.SetNeighborRetry(1, 0)
+	bc.neighbors = []string{
+		closed,
+		strings.TrimPrefix(hanging.URL, "http://"),
+		strings.TrimPrefix(failing.URL, "http://"),
+	}
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		tx := signedTransaction(alice, bob, 1, 0.1, 0)
+		if err := bc.RelayTransaction(context.Background(), tx, tx.senderPublicKey, tx.signature, ""); err != nil {
+			t.Errorf("relay: %v", err)
+		}
+		if !bc.Mining() {
+			t.Error("nothing mined")
+		}
+		if bc.ResolveConflicts(context.Background()) {
+			t.Error("chain replaced with no reachable neighbor")
+		}
+	}()
+	select {
+	case <-finished:
+	case <-time.After(5 * time.Second):
+		t.Fatal("calls to unreachable neighbors did not complete")
+	}
+	if n := len(bc.Chain()); n != 2 {
+		t.Fatalf("chain has %d blocks, want 2", n)
+	}
+}
+
+// flakyNeighbor answers the first failures requests with status and the
+// rest with 200, counting them all.
+func flakyNeighbor(t *testing.T, failures int, status int) (address string, requests func() int) {
+	t.Helper()
+	var mu sync.Mutex
+	n := 0
+	neighbor := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		n++
+		fail := n <= failures
+		mu.Unlock()
+		if fail {
+			w.WriteHeader(status)
+		}
+	}))
+	t.Cleanup(neighbor.Close)
+	return strings.TrimPrefix(neighbor.URL, "http://"), func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return n
+	}
+}
+func TestBroadcastRetries(t *testing.T) {
+	for _, c := range []struct {
+		name     string
+		failures int
+		status   int
+		want     int
+	}{
+		{"lands after two failures", 2, http.StatusServiceUnavailable, 3},
+		{"throttled", 1, http.StatusTooManyRequests, 2},
+		{"gives up after the budget", 10, http.StatusInternalServerError, 4},
+		{"rejected is not retried", 10, http.StatusBadRequest, 1},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			address, requests := flakyNeighbor(t, c.failures, c.status)
+			bc := newTestChain(t)
+			bc.SetNeighborRetry(4, time.Millisecond)
+			bc.neighbors = []string{address}
+			bc.broadcast(context.Background(), http.MethodPut, "/transactions", []byte("{}"), "")
+			if got := requests(); got != c.want {
+				t.Fatalf("neighbor got %d requests, want %d", got, c.want)
+			}
+		})
+	}
+}
+func TestBroadcastRetryStopsWithContext(t *testing.T) {
+	address, requests := flakyNeighbor(t, 10, http.StatusServiceUnavailable)
+	bc := newTestChain(t)
+	bc.SetNeighborRetry(10, time.Hour)
+	bc.neighbors = []string{address}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	bc.broadcast(ctx, http.MethodPut, "/transactions", []byte("{}"), "")
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("broadcast took %v after its context was done", elapsed)
+	}
+	if got := requests(); got != 1 {
+		t.Fatalf("neighbor got %d requests, want 1", got)
+	}
+}
@@ -0,0 +1,159 @@
+package block
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// ProtocolVersion is bumped whenever nodes stop understanding each other.
+// Peers on a different version are dropped during neighbor sync.
+const ProtocolVersion = 2
+
+// NodeInfo is what a node reports about itself on GET /info.
+type NodeInfo struct {
+	NodeVersion       string `json:"node_version"`
+	ProtocolVersion   int    `json:"protocol_version"`
+	NetworkID         string `json:"network_id"`
+	Height            int    `json:"height"`
+	BlockchainAddress string `json:"blockchain_address"`
+}
+
+func (bc *Blockchain) NetworkID() string {
+	return bc.genesis.NetworkID
+}
+func (bc *Blockchain) BlockchainAddress() string {
+	return bc.blockchainAddress
+}
+
+// Info describes this node; the caller fills in NodeVersion.
+func (bc *Blockchain) Info() NodeInfo {
+	return NodeInfo{
+		ProtocolVersion:   ProtocolVersion,
+		NetworkID:         bc.NetworkID(),
+		Height:            len(bc.Chain()) - 1,
+		BlockchainAddress: bc.blockchainAddress,
+	}
+}
+
+// handshake fetches a neighbor's /info and checks that it speaks our
+// protocol version on our network.
+func (bc *Blockchain) handshake(ctx context.Context, neighbor string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, bc.neighborEndpoint(neighbor, "/info"), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := bc.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET /info: %s", resp.Status)
+	}
+	var info NodeInfo
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		return err
+	}
+	if info.NetworkID != bc.NetworkID() {
+		return fmt.Errorf("network id %q, want %q", info.NetworkID, bc.NetworkID())
+	}
+	if info.ProtocolVersion != ProtocolVersion {
+		return fmt.Errorf("protocol version %d, want %d", info.ProtocolVersion, ProtocolVersion)
+	}
+	return nil
+}
+
+// compatibleNeighbors keeps the neighbors that pass the handshake.
+func (bc *Blockchain) compatibleNeighbors(ctx context.Context, neighbors []string) []string {
+	compatible := make([]string, 0, len(neighbors))
+	for _, n := range neighbors {
+		if err := bc.handshake(ctx, n); err != nil {
+			slog.Warn("ignoring incompatible neighbor", "neighbor", n, "error", err)
+			continue
+		}
+		compatible = append(compatible, n)
+	}
+	return compatible
+}
+
+// Neighbors are pinged every PeerHealthInterval. After a failed ping the
+// next one waits twice as long, and a neighbor is dropped after
+// PeerMaxFailures failures in a row. A later neighbor sync that finds it
+// alive adds it back.
+const (
+	PeerHealthInterval = 5 * time.Second
+	PeerMaxFailures    = 3
+)
+
+type peerHealth struct {
+	failures int
+	nextPing time.Time
+}
+
+func (bc *Blockchain) SetPeerHealthCheck(interval time.Duration, maxFailures int) {
+	if interval <= 0 {
+		interval = PeerHealthInterval
+	}
+	if maxFailures < 1 {
+		maxFailures = 1
+	}
+	bc.healthInterval = interval
+	bc.maxPeerFailures = maxFailures
+}
+
+// CheckNeighbors pings the neighbors that are due and drops those that
+// have failed too often. It returns the neighbors it dropped.
+func (bc *Blockchain) CheckNeighbors(ctx context.Context) []string {
+	now := bc.now()
+	dropped := make([]string, 0)
+	for _, n := range bc.Neighbors() {
+		if ctx.Err() != nil {
+			break
+		}
+		bc.muxNeighbors.RLock()
+		h := bc.peerHealth[n]
+		bc.muxNeighbors.RUnlock()
+		if h != nil && now.Before(h.nextPing) {
+			continue
+		}
+		err := bc.handshake(ctx, n)
+		bc.muxNeighbors.Lock()
+		if err == nil {
+			delete(bc.peerHealth, n)
+			bc.muxNeighbors.Unlock()
+			continue
+		}
+		if h = bc.peerHealth[n]; h == nil {
+			h = &peerHealth{}
+			bc.peerHealth[n] = h
+		}
+		h.failures++
+		h.nextPing = now.Add(bc.healthInterval << uint(h.failures-1))
+		if h.failures >= bc.maxPeerFailures {
+			bc.neighbors, _ = removeNeighbor(bc.neighbors, n)
+			delete(bc.peerHealth, n)
+			dropped = append(dropped, n)
+			slog.Warn("neighbor dropped", "neighbor", n, "failures", h.failures, "error", err)
+		}
+		bc.muxNeighbors.Unlock()
+	}
+	return dropped
+}
+func (bc *Blockchain) healthCheckLoop(ctx context.Context) {
+	ticker := time.NewTicker(bc.healthInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-bc.stop:
+			return
+		case <-ticker.C:
+			bc.CheckNeighbors(ctx)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package block
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// infoPeer serves info on /info and returns the peer's host:port.
+func infoPeer(t *testing.T, info NodeInfo) string {
+	t.Helper()
+	peer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/info" {
+			http.NotFound(w, req)
+			return
+		}
+		json.NewEncoder(w).Encode(info)
+	}))
+	t.Cleanup(peer.Close)
+	return strings.TrimPrefix(peer.URL, "http://")
+}
+func TestSyncDropsIncompatibleNeighbors(t *testing.T) {
+	bc := NewBlockchainWithGenesis(testMiner, 5000, "", GenesisConfig{NetworkID: "testnet"})
+	compatible := infoPeer(t, NodeInfo{ProtocolVersion: ProtocolVersion, NetworkID: "testnet"})
+	for _, address := range []string{
+		compatible,
+		infoPeer(t, NodeInfo{ProtocolVersion: ProtocolVersion, NetworkID: "mainnet"}),
+		infoPeer(t, NodeInfo{ProtocolVersion: ProtocolVersion + 1, NetworkID: "testnet"}),
+	} {
+		if err := bc.RegisterNeighbor(address); err != nil {
+			t.Fatal(err)
+		}
+	}
+	bc.SyncNeighbors(context.Background())
+	if neighbors := bc.Neighbors(); len(neighbors) != 1 || neighbors[0] != compatible {
+		t.Fatalf("neighbors %v, want only %s", neighbors, compatible)
+	}
+}
+func TestInfo(t *testing.T) {
+	bc := NewBlockchainWithGenesis(testMiner, 5000, "", GenesisConfig{NetworkID: "testnet"})
+	info := bc.Info()
+	if info.ProtocolVersion != ProtocolVersion || info.NetworkID != "testnet" || info.Height != 0 || info.BlockchainAddress != testMiner {
+		t.Fatalf("info %+v", info)
+	}
+	if err := bc.handshake(context.Background(), infoPeer(t, info)); err != nil {
+		t.Fatalf("handshake with a node like us: %v", err)
+	}
+}
+func TestDeadNeighborDropped(t *testing.T) {
+	var down atomic.Bool
+	peer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if down.Load() {
+			http.Error(w, "down", http.StatusServiceUnavailable)
+			return
+		}
+		json.NewEncoder(w).Encode(NodeInfo{ProtocolVersion: ProtocolVersion, NetworkID: DefaultNetworkID})
+	}))
+	defer peer.Close()
+	address := strings.TrimPrefix(peer.URL, "http://")
+	bc := newTestChain(t)
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	bc.SetClock(func() time.Time { return now })
+	bc.SetPeerHealthCheck(time.Second, 3)
+	if err := bc.RegisterNeighbor(address); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if dropped := bc.CheckNeighbors(ctx); len(dropped) != 0 {
+		t.Fatalf("live neighbor dropped: %v", dropped)
+	}
+	if h := bc.peerHealth[address]; h != nil {
+		t.Fatalf("live neighbor has %d failures", h.failures)
+	}
+	down.Store(true)
+	// Failures come at 0s, 1s and 3s, each wait twice the one before.
+	for _, step := range []struct {
+		after   time.Duration
+		dropped bool
+	}{
+		{0, false},
+		{500 * time.Millisecond, false},
+		{500 * time.Millisecond, false},
+		{time.Second, false},
+		{time.Second, true},
+	} {
+		now = now.Add(step.after)
+		dropped := bc.CheckNeighbors(ctx)
+		if step.dropped != (len(dropped) == 1) {
+			t.Fatalf("at %v: dropped %v", now, dropped)
+		}
+	}
+	if neighbors := bc.Neighbors(); len(neighbors) != 0 {
+		t.Fatalf("neighbors %v after the peer died", neighbors)
+	}
+	// A later sync that finds it alive adds it back.
+	down.Store(false)
+	bc.SyncNeighbors(ctx)
+	if neighbors := bc.Neighbors(); len(neighbors) != 1 || neighbors[0] != address {
+		t.Fatalf("neighbors %v, want %s back", neighbors, address)
+	}
+}
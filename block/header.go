@@ -0,0 +1,86 @@
+package block
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+)
+
+// BlockHeader carries everything that goes into a block hash, so light
+// clients can check linkage and proof of work without transaction bodies.
+type BlockHeader struct {
+	Version      int
+	Height       int
+	Timestamp    int64
+	Nonce        int
+	Difficulty   int
+	PreviousHash [32]byte
+	MerkleRoot   [32]byte
+}
+
+func (h *BlockHeader) Hash() [32]byte {
+	return h.SaltedHash("")
+}
+func (h *BlockHeader) SaltedHash(salt string) [32]byte {
+	if h.Version < 2 {
+		return sha256.Sum256(append([]byte(salt), h.legacyBytes()...))
+	}
+	return sha256.Sum256(append([]byte(salt), h.bytes()...))
+}
+
+// headerSize is the length of the encoding produced by bytes.
+const headerSize = 5*8 + 2*32
+
+// bytes is the fixed-size encoding that is hashed: version, height,
+// timestamp, nonce and difficulty as big-endian 64-bit integers, then the
+// previous hash and the merkle root. It is independent of the JSON sent to
+// peers.
+func (h *BlockHeader) bytes() []byte {
+	buf := make([]byte, 0, headerSize)
+	buf = binary.BigEndian.AppendUint64(buf, uint64(h.Version))
+	buf = binary.BigEndian.AppendUint64(buf, uint64(h.Height))
+	buf = binary.BigEndian.AppendUint64(buf, uint64(h.Timestamp))
+	buf = binary.BigEndian.AppendUint64(buf, uint64(h.Nonce))
+	buf = binary.BigEndian.AppendUint64(buf, uint64(h.Difficulty))
+	buf = append(buf, h.PreviousHash[:]...)
+	return append(buf, h.MerkleRoot[:]...)
+}
+
+// legacyBytes is the JSON that version 1 blocks were hashed over. It leaves
+// out height and difficulty.
+func (h *BlockHeader) legacyBytes() []byte {
+	m, _ := json.Marshal(struct {
+		Version      int    `json:"version"`
+		Timestamp    int64  `json:"timestamp"`
+		Nonce        int    `json:"nonce"`
+		PreviousHash string `json:"previous_hash"`
+		MerkleRoot   string `json:"merkle_root"`
+	}{
+		Version:      h.Version,
+		Timestamp:    h.Timestamp,
+		Nonce:        h.Nonce,
+		PreviousHash: fmt.Sprintf("%x", h.PreviousHash),
+		MerkleRoot:   fmt.Sprintf("%x", h.MerkleRoot),
+	})
+	return m
+}
+func (h *BlockHeader) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Version      int    `json:"version"`
+		Height       int    `json:"height"`
+		Timestamp    int64  `json:"timestamp"`
+		Nonce        int    `json:"nonce"`
+		Difficulty   int    `json:"difficulty"`
+		PreviousHash string `json:"previous_hash"`
+		MerkleRoot   string `json:"merkle_root"`
+	}{
+		Version:      h.Version,
+		Height:       h.Height,
+		Timestamp:    h.Timestamp,
+		Nonce:        h.Nonce,
+		Difficulty:   h.Difficulty,
+		PreviousHash: fmt.Sprintf("%x", h.PreviousHash),
+		MerkleRoot:   fmt.Sprintf("%x", h.MerkleRoot),
+	})
+}
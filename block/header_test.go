@@ -0,0 +1,67 @@
+package block
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+func testHeader() *BlockHeader {
+	h := &BlockHeader{
+		Version:    2,
+		Height:     7,
+		Timestamp:  1700000000000000000,
+		Nonce:      4242,
+		Difficulty: 3,
+	}
+	for i := range h.PreviousHash {
+		h.PreviousHash[i] = byte(i)
+		h.MerkleRoot[i] = byte(0xff - i)
+	}
+	return h
+}
+func TestHeaderHashDeterministic(t *testing.T) {
+	h := testHeader()
+	if n := len(h.bytes()); n != headerSize {
+		t.Fatalf("encoding is %d bytes, want %d", n, headerSize)
+	}
+	// Fixed so that a change to the encoding, which would fork the chain,
+	// fails here rather than between nodes.
+	const want = "55927fcdcf45e576d7cb756be6a6f27a1174ae8630e19e236da80e7ee03c51a8"
+	if got := h.Hash(); hex.EncodeToString(got[:]) != want {
+		t.Fatalf("hash %x, want %s", got, want)
+	}
+	copied := *h
+	if copied.Hash() != h.Hash() {
+		t.Fatal("equal headers hash differently")
+	}
+	for name, change := range map[string]func(*BlockHeader){
+		"height":        func(h *BlockHeader) { h.Height++ },
+		"timestamp":     func(h *BlockHeader) { h.Timestamp++ },
+		"nonce":         func(h *BlockHeader) { h.Nonce++ },
+		"difficulty":    func(h *BlockHeader) { h.Difficulty++ },
+		"previous hash": func(h *BlockHeader) { h.PreviousHash[31]++ },
+		"merkle root":   func(h *BlockHeader) { h.MerkleRoot[0]++ },
+	} {
+		changed := *h
+		change(&changed)
+		if changed.Hash() == h.Hash() {
+			t.Errorf("changing the %s leaves the hash unchanged", name)
+		}
+	}
+	if h.SaltedHash("testnet") == h.Hash() {
+		t.Error("salt leaves the hash unchanged")
+	}
+}
+func BenchmarkHeaderHashBinary(b *testing.B) {
+	h := testHeader()
+	for i := 0; i < b.N; i++ {
+		h.Hash()
+	}
+}
+func BenchmarkHeaderHashJSON(b *testing.B) {
+	h := testHeader()
+	h.Version = 1
+	for i := 0; i < b.N; i++ {
+		h.Hash()
+	}
+}
@@ -0,0 +1,40 @@
+package block
+
+import (
+	"goblockchain/wallet"
+	"testing"
+)
+
+const testMiner = "miner"
+
+// newTestChain returns a chain whose genesis block credits each wallet
+// with 100.
+func newTestChain(t *testing.T, funded ...*wallet.Wallet) *Blockchain {
+	t.Helper()
+	allocations := make(map[string]float32)
+	for _, w := range funded {
+		allocations[w.BlockchainAddress()] = 100
+	}
+	return NewBlockchainWithGenesis(testMiner, 5000, "", GenesisConfig{Allocations: allocations})
+}
+func newTestWallet(t *testing.T) *wallet.Wallet {
+	t.Helper()
+	w, err := wallet.NewWallet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return w
+}
+
+// signedTransaction builds a transaction from one wallet to another and
+// signs it with the sender's key.
+func signedTransaction(from, to *wallet.Wallet, value, fee float32, sequence uint64) *Transaction {
+	wt := wallet.NewTransaction(from.PrivateKey(), from.PublicKey(), from.BlockchainAddress(), to.BlockchainAddress(), value, fee, 0, sequence)
+	t := NewTransaction(from.BlockchainAddress(), to.BlockchainAddress(), value, fee, 0, sequence)
+	t.senderPublicKey = from.PublicKey()
+	t.signature = wt.GenerateSignature()
+	return t
+}
+func addTransaction(bc *Blockchain, t *Transaction) error {
+	return bc.AddTransaction(t, t.senderPublicKey, t.signature)
+}
@@ -0,0 +1,62 @@
+package block
+
+// Directions of a transaction relative to the address whose history is
+// being read.
+const (
+	DirectionIn   = "in"
+	DirectionOut  = "out"
+	DirectionSelf = "self"
+)
+
+// Statuses of a transaction in a lookup or history.
+const (
+	StatusPending   = "pending"
+	StatusConfirmed = "confirmed"
+)
+
+// AddressTransaction is a transaction as seen by one address. Confirmations
+// counts the block holding it and every block since; a pending transaction
+// has height -1 and no confirmations.
+type AddressTransaction struct {
+	Transaction   *Transaction `json:"transaction"`
+	Height        int          `json:"height"`
+	Confirmations int          `json:"confirmations"`
+	Status        string       `json:"status"`
+	Direction     string       `json:"direction"`
+}
+
+// TransactionsForAddress returns every transaction the address sent or
+// received, genesis allocations and coinbase payouts included. Mined ones
+// are ordered by block height and then by position in the block, and are
+// followed by those still pending.
+func (bc *Blockchain) TransactionsForAddress(blockchainAddress string) []AddressTransaction {
+	history := make([]AddressTransaction, 0)
+	chain := bc.Chain()
+	for height, b := range chain {
+		for _, t := range b.transactions {
+			if direction, ok := directionFor(t, blockchainAddress); ok {
+				history = append(history, AddressTransaction{t, height, len(chain) - height, StatusConfirmed, direction})
+			}
+		}
+	}
+	for _, t := range bc.TransactionPool() {
+		if direction, ok := directionFor(t, blockchainAddress); ok {
+			history = append(history, AddressTransaction{t, -1, 0, StatusPending, direction})
+		}
+	}
+	return history
+}
+func directionFor(t *Transaction, blockchainAddress string) (string, bool) {
+	sent := t.senderBlockchainAddress == blockchainAddress
+	received := t.recipientBlockchainAddress == blockchainAddress
+	switch {
+	case sent && received:
+		return DirectionSelf, true
+	case sent:
+		return DirectionOut, true
+	case received:
+		return DirectionIn, true
+	default:
+		return "", false
+	}
+}
@@ -0,0 +1,51 @@
+package block
+
+import "testing"
+
+func TestConfirmations(t *testing.T) {
+	alice, bob := newTestWallet(t), newTestWallet(t)
+	bc := newTestChain(t, alice)
+	older := signedTransaction(alice, bob, 1, 0.1, 0)
+	fresh := signedTransaction(alice, bob, 1, 0.1, 1)
+	for _, tx := range []*Transaction{older, fresh} {
+		if err := addTransaction(bc, tx); err != nil {
+			t.Fatal(err)
+		}
+		if !bc.Mining() {
+			t.Fatal("nothing mined")
+		}
+	}
+	pending := signedTransaction(alice, bob, 1, 0.1, 2)
+	if err := addTransaction(bc, pending); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct {
+		name          string
+		tx            *Transaction
+		height        int
+		confirmations int
+	}{
+		{"older", older, 1, 2},
+		{"fresh", fresh, 2, 1},
+		{"pending", pending, -1, 0},
+	} {
+		_, height, confirmations, ok := bc.GetTransaction(c.tx.TransactionId())
+		if !ok || height != c.height || confirmations != c.confirmations {
+			t.Errorf("%s: found %v at height %d with %d confirmations, want height %d with %d", c.name, ok, height, confirmations, c.height, c.confirmations)
+		}
+	}
+	if _, _, _, ok := bc.GetTransaction("unknown"); ok {
+		t.Error("unknown transaction found")
+	}
+	history := bc.TransactionsForAddress(bob.BlockchainAddress())
+	if len(history) != 3 {
+		t.Fatalf("%d transactions in history, want 3", len(history))
+	}
+	last := history[len(history)-1]
+	if last.Status != StatusPending || last.Confirmations != 0 || last.Height != -1 {
+		t.Fatalf("pending transaction in history %+v", last)
+	}
+	if newest := history[1]; newest.Status != StatusConfirmed || newest.Confirmations != 1 {
+		t.Fatalf("newest mined transaction in history %+v, want 1 confirmation", newest)
+	}
+}
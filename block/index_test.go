@@ -0,0 +1,194 @@
+package block
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestApplyRevertBlockSymmetric(t *testing.T) {
+	alice, bob, carol := newTestWallet(t), newTestWallet(t), newTestWallet(t)
+	bc := newTestChain(t, alice, bob)
+	for i, tx := range []*Transaction{
+		signedTransaction(alice, bob, 10, 0.5, 0),
+		signedTransaction(alice, carol, 2.5, 0.25, 1),
+		signedTransaction(bob, carol, 7, 0.1, 0),
+	} {
+		if err := addTransaction(bc, tx); err != nil {
+			t.Fatalf("transaction %d: %v", i, err)
+		}
+	}
+	before := bc.chainIndex.clone()
+	if !bc.Mining() {
+		t.Fatal("nothing mined")
+	}
+	b := bc.LastBlock()
+	if len(b.Transactions()) != 4 {
+		t.Fatalf("block has %d transactions, want 4", len(b.Transactions()))
+	}
+	after := bc.chainIndex.clone()
+	x := after.clone()
+	x.revertBlock(b)
+	if !reflect.DeepEqual(x, before) {
+		t.Fatalf("revert left %+v, want %+v", x, before)
+	}
+	x.applyBlock(b)
+	if !reflect.DeepEqual(x, after) {
+		t.Fatalf("reapply left %+v, want %+v", x, after)
+	}
+}
+func TestSpentIndex(t *testing.T) {
+	alice, bob := newTestWallet(t), newTestWallet(t)
+	bc := newTestChain(t, alice)
+	other := newTestChain(t, alice)
+	tx := signedTransaction(alice, bob, 1, 0.1, 0)
+	if err := addTransaction(bc, tx); err != nil {
+		t.Fatal(err)
+	}
+	if bc.IsSpent(tx.Hash()) {
+		t.Fatal("pending transaction marked spent")
+	}
+	bc.Mining()
+	if !bc.IsSpent(tx.Hash()) {
+		t.Fatal("mined transaction not marked spent")
+	}
+	if err := addTransaction(bc, tx); err == nil {
+		t.Fatal("mined transaction accepted again")
+	}
+	// A heavier chain without tx replaces ours.
+	for i := 0; i < 2; i++ {
+		addTransaction(other, signedTransaction(alice, bob, 2, 0.1, uint64(i)))
+		other.Mining()
+	}
+	bc.replaceChain(other.Chain(), nil)
+	if bc.IsSpent(tx.Hash()) {
+		t.Fatal("transaction still spent after a reorg dropped it")
+	}
+	for _, b := range other.Chain()[1:] {
+		for _, mined := range b.Transactions() {
+			if !bc.IsSpent(mined.Hash()) {
+				t.Fatalf("transaction %s of the new chain not spent", mined.TransactionId())
+			}
+		}
+	}
+}
+func TestRevertBlocksToGenesis(t *testing.T) {
+	alice, bob := newTestWallet(t), newTestWallet(t)
+	bc := newTestChain(t, alice)
+	states := []*chainIndex{bc.chainIndex.clone()}
+	for i := 0; i < 3; i++ {
+		if err := addTransaction(bc, signedTransaction(alice, bob, float32(i+1), 0.1, uint64(i))); err != nil {
+			t.Fatal(err)
+		}
+		if !bc.Mining() {
+			t.Fatal("nothing mined")
+		}
+		states = append(states, bc.chainIndex.clone())
+	}
+	x := bc.chainIndex.clone()
+	chain := bc.Chain()
+	for height := len(chain) - 1; height > 0; height-- {
+		x.revertBlock(chain[height])
+		if !reflect.DeepEqual(x, states[height-1]) {
+			t.Fatalf("reverting block %d left %+v, want %+v", height, x, states[height-1])
+		}
+	}
+}
+func TestBalanceIndexMatchesScan(t *testing.T) {
+	alice, bob, carol := newTestWallet(t), newTestWallet(t), newTestWallet(t)
+	bc := newTestChain(t, alice, bob)
+	bc.SetCoinbaseMaturity(2)
+	other := newTestChain(t, alice, bob)
+	for i := 0; i < 3; i++ {
+		for _, tx := range []*Transaction{
+			signedTransaction(alice, bob, 3, 0.1, uint64(i)),
+			signedTransaction(bob, carol, 1.5, 0.2, uint64(i)),
+		} {
+			if err := addTransaction(bc, tx); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if !bc.Mining() {
+			t.Fatal("nothing mined")
+		}
+	}
+	check := func(when string) {
+		t.Helper()
+		for _, address := range []string{alice.BlockchainAddress(), bob.BlockchainAddress(), carol.BlockchainAddress(), testMiner} {
+			// The index sums in float64, the scan in float32.
+			if indexed, scanned := bc.Balance(address), bc.CalculateTotalAmount(address); math.Abs(float64(indexed-scanned)) > 1e-4 {
+				t.Errorf("%s: %s indexed %v, scanned %v", when, address, indexed, scanned)
+			}
+		}
+	}
+	check("after mining")
+	for i := 0; i < 4; i++ {
+		if err := addTransaction(other, signedTransaction(alice, carol, 2, 0.1, uint64(i))); err != nil {
+			t.Fatal(err)
+		}
+		other.Mining()
+	}
+	bc.replaceChain(other.Chain(), nil)
+	check("after a reorg")
+}
+func benchmarkBalance(b *testing.B, balance func(*Blockchain, string) float32) {
+	bc := longChain(b, 1000)
+	address := bc.LastBlock().Transactions()[0].recipientBlockchainAddress
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		balance(bc, address)
+	}
+}
+func BenchmarkBalanceIndexed(b *testing.B) {
+	benchmarkBalance(b, (*Blockchain).Balance)
+}
+func BenchmarkBalanceScan(b *testing.B) {
+	benchmarkBalance(b, (*Blockchain).CalculateTotalAmount)
+}
+func TestAllBalances(t *testing.T) {
+	alice, bob, carol := newTestWallet(t), newTestWallet(t), newTestWallet(t)
+	bc := newTestChain(t, alice, bob)
+	// Balance leaves out immature coinbases, AllBalances does not.
+	bc.SetCoinbaseMaturity(1)
+	for i := 0; i < 3; i++ {
+		for _, tx := range []*Transaction{
+			signedTransaction(alice, carol, 4, 0.2, uint64(i)),
+			signedTransaction(bob, alice, 1.5, 0.1, uint64(i)),
+		} {
+			if err := addTransaction(bc, tx); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if !bc.Mining() {
+			t.Fatal("nothing mined")
+		}
+	}
+	balances := bc.AllBalances()
+	want := map[string]float32{
+		alice.BlockchainAddress(): 100 - 3*4.2 + 3*1.5,
+		bob.BlockchainAddress():   100 - 3*1.6,
+		carol.BlockchainAddress(): 3 * 4,
+		testMiner:                 3*bc.BlockReward(1) + 3*0.3,
+	}
+	if len(balances) != len(want) {
+		t.Fatalf("balances of %d addresses, want %d: %v", len(balances), len(want), balances)
+	}
+	var total float64
+	for address, balance := range balances {
+		if math.Abs(float64(balance-want[address])) > 1e-4 {
+			t.Errorf("%s: balance %v, want %v", address, balance, want[address])
+		}
+		if indexed := bc.Balance(address); math.Abs(float64(balance-indexed)) > 1e-4 {
+			t.Errorf("%s: balance %v, indexed %v", address, balance, indexed)
+		}
+		total += float64(balance)
+	}
+	// Fees move coins, only allocations and rewards create them.
+	issued := 200.0
+	for height := 1; height < len(bc.Chain()); height++ {
+		issued += float64(bc.BlockReward(height))
+	}
+	if math.Abs(total-issued) > 1e-3 {
+		t.Fatalf("balances sum to %v, want the %v issued", total, issued)
+	}
+}
@@ -0,0 +1,72 @@
+package block
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestBlockJSONRoundTrip(t *testing.T) {
+	alice, bob := newTestWallet(t), newTestWallet(t)
+	bc := newTestChain(t, alice)
+	if err := addTransaction(bc, signedTransaction(alice, bob, 1.5, 0.1, 0)); err != nil {
+		t.Fatal(err)
+	}
+	if !bc.Mining() {
+		t.Fatal("nothing mined")
+	}
+	b := bc.LastBlock()
+	m, err := json.Marshal(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded Block
+	if err := json.Unmarshal(m, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.PreviousHash() != b.PreviousHash() || decoded.PreviousHash() == [32]byte{} {
+		t.Fatalf("previous hash %x, want %x", decoded.PreviousHash(), b.PreviousHash())
+	}
+	if decoded.Hash() != b.Hash() {
+		t.Fatal("decoded block hashes differently")
+	}
+	if len(decoded.Transactions()) != len(b.Transactions()) {
+		t.Fatalf("%d transactions, want %d", len(decoded.Transactions()), len(b.Transactions()))
+	}
+	for i, tx := range decoded.Transactions() {
+		if tx.Hash() != b.Transactions()[i].Hash() {
+			t.Fatalf("transaction %d changed in the round trip", i)
+		}
+	}
+}
+func TestBlockchainJSONRoundTrip(t *testing.T) {
+	alice, bob := newTestWallet(t), newTestWallet(t)
+	bc := newTestChain(t, alice)
+	for i := 0; i < 2; i++ {
+		if err := addTransaction(bc, signedTransaction(alice, bob, 1, 0.1, uint64(i))); err != nil {
+			t.Fatal(err)
+		}
+		if !bc.Mining() {
+			t.Fatal("nothing mined")
+		}
+	}
+	m, err := json.Marshal(bc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded Blockchain
+	if err := json.Unmarshal(m, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	chain := bc.Chain()
+	if len(decoded.chain) != 3 {
+		t.Fatalf("decoded %d blocks, want 3", len(decoded.chain))
+	}
+	for i, b := range decoded.chain {
+		if b.Hash() != chain[i].Hash() {
+			t.Fatalf("block %d hashes differently", i)
+		}
+	}
+	if !bc.ValidChain(decoded.chain) {
+		t.Fatal("decoded chain invalid")
+	}
+}
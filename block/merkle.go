@@ -0,0 +1,81 @@
+package block
+
+import (
+	"crypto/sha256"
+	"fmt"
+)
+
+type MerkleProofStep struct {
+	Hash [32]byte
+	// Left reports whether Hash is the left-hand sibling.
+	Left bool
+}
+
+func merkleLeaves(transactions []*Transaction) [][32]byte {
+	leaves := make([][32]byte, 0, len(transactions))
+	for _, t := range transactions {
+		leaves = append(leaves, t.Hash())
+	}
+	return leaves
+}
+
+// merkleParents hashes a level pairwise, duplicating the last node when
+// the level has an odd length.
+func merkleParents(level [][32]byte) [][32]byte {
+	parents := make([][32]byte, 0, (len(level)+1)/2)
+	for i := 0; i < len(level); i += 2 {
+		right := level[i]
+		if i+1 < len(level) {
+			right = level[i+1]
+		}
+		parents = append(parents, hashPair(level[i], right))
+	}
+	return parents
+}
+func hashPair(left [32]byte, right [32]byte) [32]byte {
+	return sha256.Sum256(append(left[:], right[:]...))
+}
+func merkleRoot(transactions []*Transaction) [32]byte {
+	if len(transactions) == 0 {
+		return [32]byte{}
+	}
+	level := merkleLeaves(transactions)
+	for len(level) > 1 {
+		level = merkleParents(level)
+	}
+	return level[0]
+}
+func (b *Block) MerkleRoot() [32]byte {
+	return b.merkleRoot
+}
+func (b *Block) MerkleProof(txIndex int) ([]MerkleProofStep, error) {
+	if txIndex < 0 || txIndex >= len(b.transactions) {
+		return nil, fmt.Errorf("transaction index %d out of range", txIndex)
+	}
+	proof := make([]MerkleProofStep, 0)
+	level := merkleLeaves(b.transactions)
+	for index := txIndex; len(level) > 1; index /= 2 {
+		if index%2 == 0 {
+			sibling := level[index]
+			if index+1 < len(level) {
+				sibling = level[index+1]
+			}
+			proof = append(proof, MerkleProofStep{Hash: sibling, Left: false})
+		} else {
+			proof = append(proof, MerkleProofStep{Hash: level[index-1], Left: true})
+		}
+		level = merkleParents(level)
+	}
+	return proof, nil
+}
+func VerifyMerkleProof(leaf [32]byte, proof []MerkleProofStep, root [32]byte) bool {
+	h := leaf
+	for _, step := range proof {
+		if step.Left {
+			h = hashPair(step.Hash, h)
+		} else {
+			h = hashPair(h, step.Hash)
+		}
+	}
+	return h == root
+}
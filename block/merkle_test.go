@@ -0,0 +1,66 @@
+package block
+
+import (
+	"fmt"
+	"testing"
+)
+
+func testTransactions(n int) []*Transaction {
+	transactions := make([]*Transaction, 0, n)
+	for i := 0; i < n; i++ {
+		transactions = append(transactions, NewTransaction("sender", fmt.Sprintf("recipient%d", i), float32(i+1), 0, 0, uint64(i)))
+	}
+	return transactions
+}
+func TestMerkleRoot(t *testing.T) {
+	if got := NewBlock(0, [32]byte{}, nil).MerkleRoot(); got != ([32]byte{}) {
+		t.Fatalf("empty block root %x, want zero", got)
+	}
+	one := testTransactions(1)
+	if got := NewBlock(0, [32]byte{}, one).MerkleRoot(); got != one[0].Hash() {
+		t.Fatalf("single transaction root %x, want its hash", got)
+	}
+	three := testTransactions(3)
+	h := merkleLeaves(three)
+	want := hashPair(hashPair(h[0], h[1]), hashPair(h[2], h[2]))
+	if got := NewBlock(0, [32]byte{}, three).MerkleRoot(); got != want {
+		t.Fatalf("odd root %x, want %x", got, want)
+	}
+	changed := testTransactions(3)
+	changed[2].value++
+	if merkleRoot(changed) == want {
+		t.Fatal("root unchanged by a changed transaction")
+	}
+}
+func TestMerkleProof(t *testing.T) {
+	for _, n := range []int{1, 2, 3, 5, 8} {
+		b := NewBlock(0, [32]byte{}, testTransactions(n))
+		for i, tx := range b.Transactions() {
+			proof, err := b.MerkleProof(i)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !VerifyMerkleProof(tx.Hash(), proof, b.MerkleRoot()) {
+				t.Fatalf("%d transactions: proof of %d does not verify", n, i)
+			}
+			other := b.Transactions()[(i+1)%n]
+			if n > 1 && VerifyMerkleProof(other.Hash(), proof, b.MerkleRoot()) {
+				t.Fatalf("%d transactions: proof of %d verifies another transaction", n, i)
+			}
+		}
+		if _, err := b.MerkleProof(n); err == nil {
+			t.Fatalf("%d transactions: proof of index %d given", n, n)
+		}
+	}
+	if _, err := NewBlock(0, [32]byte{}, nil).MerkleProof(0); err == nil {
+		t.Fatal("proof given for an empty block")
+	}
+}
+func TestHashCoversMerkleRoot(t *testing.T) {
+	a := NewBlock(0, [32]byte{}, testTransactions(2))
+	b := NewBlock(0, [32]byte{}, testTransactions(3))
+	b.timestamp = a.timestamp
+	if a.Hash() == b.Hash() {
+		t.Fatal("blocks with different transactions hash the same")
+	}
+}
@@ -0,0 +1,200 @@
+package block
+
+import (
+	"context"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// minedWithin reports whether a block is mined within d.
+func minedWithin(events <-chan Event, d time.Duration) bool {
+	timeout := time.After(d)
+	for {
+		select {
+		case e := <-events:
+			if e.Type == EventBlockMined {
+				return true
+			}
+		case <-timeout:
+			return false
+		}
+	}
+}
+func TestMiningThreshold(t *testing.T) {
+	alice, bob := newTestWallet(t), newTestWallet(t)
+	bc := newTestChain(t, alice)
+	bc.SetMiningThreshold(2, time.Hour)
+	events, unsubscribe := bc.Subscribe()
+	defer unsubscribe()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	bc.StartMining(ctx)
+	if err := addTransaction(bc, signedTransaction(alice, bob, 1, 0.1, 0)); err != nil {
+		t.Fatal(err)
+	}
+	if minedWithin(events, 200*time.Millisecond) {
+		t.Fatal("mined below the threshold")
+	}
+	if err := addTransaction(bc, signedTransaction(alice, bob, 1, 0.1, 1)); err != nil {
+		t.Fatal(err)
+	}
+	if !minedWithin(events, 5*time.Second) {
+		t.Fatal("nothing mined at the threshold")
+	}
+	if n := len(bc.LastBlock().transactions); n != 3 {
+		t.Fatalf("mined %d transactions, want both and the coinbase", n)
+	}
+}
+func TestMiningMaxWait(t *testing.T) {
+	alice, bob := newTestWallet(t), newTestWallet(t)
+	bc := newTestChain(t, alice)
+	bc.SetMiningThreshold(10, 100*time.Millisecond)
+	events, unsubscribe := bc.Subscribe()
+	defer unsubscribe()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	bc.StartMining(ctx)
+	if err := addTransaction(bc, signedTransaction(alice, bob, 1, 0.1, 0)); err != nil {
+		t.Fatal(err)
+	}
+	if !minedWithin(events, 5*time.Second) {
+		t.Fatal("nothing mined after the max wait")
+	}
+	if len(bc.TransactionPool()) != 0 {
+		t.Fatal("pooled transaction not mined")
+	}
+}
+func TestStartMiningTwiceRunsOneLoop(t *testing.T) {
+	alice, bob := newTestWallet(t), newTestWallet(t)
+	bc := newTestChain(t, alice)
+	bc.SetMiningThreshold(1, time.Hour)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	bc.StartMining(ctx)
+	bc.StartMining(ctx)
+	if loops := subscribers(bc); loops != 1 {
+		t.Fatalf("%d mining loops, want 1", loops)
+	}
+	events, unsubscribe := bc.Subscribe()
+	defer unsubscribe()
+	if err := addTransaction(bc, signedTransaction(alice, bob, 1, 0.1, 0)); err != nil {
+		t.Fatal(err)
+	}
+	if !minedWithin(events, 5*time.Second) {
+		t.Fatal("nothing mined")
+	}
+	if minedWithin(events, 200*time.Millisecond) {
+		t.Fatal("one transaction mined into two blocks")
+	}
+	bc.Stop()
+	if bc.MiningActive() {
+		t.Fatal("mining still active after Stop")
+	}
+	// The loop unsubscribes as it exits, leaving only the test's channel.
+	for deadline := time.Now().Add(5 * time.Second); subscribers(bc) != 1; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("mining loop still running after Stop")
+		}
+	}
+}
+func subscribers(bc *Blockchain) int {
+	bc.events.mux.Lock()
+	defer bc.events.mux.Unlock()
+	return len(bc.events.subscribers)
+}
+func TestProofOfWorkCancelled(t *testing.T) {
+	bc := newTestChain(t)
+	// No nonce is found at this difficulty in the time the test allows.
+	h := BlockHeader{Version: BlockVersion, Height: 1, Timestamp: 1, Difficulty: 32}
+	for _, workers := range []int{1, 4} {
+		bc.SetMiningWorkers(workers)
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		start := time.Now()
+		_, ok := bc.proofOfWork(ctx, h)
+		cancel()
+		if ok {
+			t.Fatalf("%d workers: found a nonce at difficulty 32", workers)
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Fatalf("%d workers: returned %v after cancellation", workers, elapsed)
+		}
+	}
+}
+func TestReplaceChainCancelsMining(t *testing.T) {
+	alice, bob := newTestWallet(t), newTestWallet(t)
+	bc := newTestChain(t, alice)
+	other := newTestChain(t, alice)
+	if err := addTransaction(other, signedTransaction(alice, bob, 2, 0.1, 0)); err != nil {
+		t.Fatal(err)
+	}
+	if !other.Mining() {
+		t.Fatal("nothing mined")
+	}
+	if err := addTransaction(bc, signedTransaction(alice, bob, 1, 0.1, 0)); err != nil {
+		t.Fatal(err)
+	}
+	bc.difficulty = 32
+	done := make(chan bool)
+	go func() { done <- bc.Mining() }()
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(time.Millisecond) {
+		bc.muxMining.Lock()
+		mining := bc.miningCancel != nil
+		bc.muxMining.Unlock()
+		if mining {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("mining never started")
+		}
+	}
+	data, err := other.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	bc.neighbors = []string{servePeer(t, data)}
+	if !bc.ResolveConflicts(context.Background()) {
+		t.Fatal("longer chain not adopted")
+	}
+	select {
+	case mined := <-done:
+		if mined {
+			t.Fatal("stale block mined")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("mining not cancelled by the new chain")
+	}
+}
+func TestParallelProofOfWork(t *testing.T) {
+	bc := newTestChain(t)
+	for _, workers := range []int{1, 2, runtime.NumCPU()} {
+		bc.SetMiningWorkers(workers)
+		for height := 1; height <= 5; height++ {
+			h := BlockHeader{Version: BlockVersion, Height: height, Timestamp: int64(height), Difficulty: 3}
+			nonce, ok := bc.proofOfWork(context.Background(), h)
+			if !ok {
+				t.Fatalf("%d workers: no nonce found", workers)
+			}
+			h.Nonce = nonce
+			if !bc.ValidProof(&h) {
+				t.Fatalf("%d workers: nonce %d does not satisfy the proof", workers, nonce)
+			}
+		}
+	}
+}
+func benchmarkProofOfWork(b *testing.B, workers int) {
+	bc := NewBlockchain(testMiner, 5000, "")
+	bc.SetMiningWorkers(workers)
+	for i := 0; i < b.N; i++ {
+		h := BlockHeader{Version: BlockVersion, Height: 1, Timestamp: int64(i), Difficulty: 4}
+		if _, ok := bc.proofOfWork(context.Background(), h); !ok {
+			b.Fatal("no nonce found")
+		}
+	}
+}
+func BenchmarkProofOfWorkSingle(b *testing.B) {
+	benchmarkProofOfWork(b, 1)
+}
+func BenchmarkProofOfWorkParallel(b *testing.B) {
+	benchmarkProofOfWork(b, runtime.NumCPU())
+}
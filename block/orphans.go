@@ -0,0 +1,127 @@
+package block
+
+import (
+	"fmt"
+	"log/slog"
+	"sync"
+)
+
+// MaxOrphanBlocks bounds how many blocks with an unknown parent are held
+// while waiting for that parent to arrive.
+const MaxOrphanBlocks = 64
+
+// orphanPool buffers blocks whose parent we haven't seen, keyed by the
+// parent hash. When full the oldest orphan is dropped.
+type orphanPool struct {
+	mux      sync.Mutex
+	size     int
+	byParent map[[32]byte][]*Block
+	order    []*Block
+}
+
+func newOrphanPool(size int) *orphanPool {
+	return &orphanPool{size: size, byParent: make(map[[32]byte][]*Block)}
+}
+
+// add buffers b and reports whether it wasn't already buffered.
+func (p *orphanPool) add(b *Block) bool {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	h := b.Hash()
+	for _, o := range p.byParent[b.previousHash] {
+		if o.Hash() == h {
+			return false
+		}
+	}
+	if len(p.order) >= p.size {
+		p.remove(p.order[0])
+	}
+	p.byParent[b.previousHash] = append(p.byParent[b.previousHash], b)
+	p.order = append(p.order, b)
+	return true
+}
+
+// take removes and returns the orphans waiting for parent.
+func (p *orphanPool) take(parent [32]byte) []*Block {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	children := p.byParent[parent]
+	for _, c := range children {
+		p.remove(c)
+	}
+	return children
+}
+
+// remove drops b. The caller holds mux.
+func (p *orphanPool) remove(b *Block) {
+	siblings := p.byParent[b.previousHash]
+	for i, o := range siblings {
+		if o == b {
+			siblings = append(siblings[:i], siblings[i+1:]...)
+			break
+		}
+	}
+	if len(siblings) == 0 {
+		delete(p.byParent, b.previousHash)
+	} else {
+		p.byParent[b.previousHash] = siblings
+	}
+	for i, o := range p.order {
+		if o == b {
+			p.order = append(p.order[:i], p.order[i+1:]...)
+			break
+		}
+	}
+}
+func (p *orphanPool) len() int {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	return len(p.order)
+}
+
+// OrphanCount returns how many blocks are waiting for their parent.
+func (bc *Blockchain) OrphanCount() int {
+	return bc.orphans.len()
+}
+
+// addOrphan buffers a block whose parent is unknown, as long as it is
+// well formed on its own. Its difficulty can't be checked against a parent
+// we don't have, so it must be at least what our next block needs; a block
+// claiming less would be too cheap to flood the buffer with. It reports
+// whether b is now held, either buffered here or earlier.
+func (bc *Blockchain) addOrphan(b *Block) bool {
+	if want := nextDifficulty(bc.Chain()); b.difficulty < want {
+		slog.Warn("orphan block below difficulty", "height", b.height, "difficulty", b.difficulty, "want", want)
+		return false
+	}
+	if !bc.validBlock(b) {
+		return false
+	}
+	if bc.orphans.add(b) {
+		slog.Info("orphan block buffered", "height", b.height, "parent", fmt.Sprintf("%x", b.previousHash))
+	}
+	return true
+}
+
+// connectOrphans accepts the buffered descendants of a block that was just
+// added to the chain, breadth first.
+func (bc *Blockchain) connectOrphans(parent *Block) {
+	queue := []*Block{parent}
+	for len(queue) > 0 {
+		p := queue[0]
+		queue = queue[1:]
+		for _, child := range bc.orphans.take(p.Hash()) {
+			if err := bc.acceptBlock(child); err != nil {
+				slog.Warn("orphan block rejected", "hash", fmt.Sprintf("%x", child.Hash()), "error", err)
+				continue
+			}
+			queue = append(queue, child)
+		}
+	}
+}
+
+// knownBlock reports whether a block with this hash is in the chain.
+func (bc *Blockchain) knownBlock(hash [32]byte) bool {
+	_, ok := bc.BlockByHash(fmt.Sprintf("%x", hash))
+	return ok
+}
@@ -0,0 +1,45 @@
+package block
+
+import (
+	"testing"
+)
+
+func TestOrphanBufferedUntilParentArrives(t *testing.T) {
+	alice, bob := newTestWallet(t), newTestWallet(t)
+	source := newTestChain(t, alice)
+	for i := 0; i < 2; i++ {
+		if err := addTransaction(source, signedTransaction(alice, bob, 1, 0.1, uint64(i))); err != nil {
+			t.Fatal(err)
+		}
+		if !source.Mining() {
+			t.Fatal("nothing mined")
+		}
+	}
+	chain := source.Chain()
+	bc := newTestChain(t, alice)
+	if err := bc.AcceptBlock(chain[2]); err != ErrUnknownAncestor {
+		t.Fatalf("got %v, want %v", err, ErrUnknownAncestor)
+	}
+	if got := bc.OrphanCount(); got != 1 {
+		t.Fatalf("%d orphans buffered, want 1", got)
+	}
+	if err := bc.AcceptBlock(chain[1]); err != nil {
+		t.Fatal(err)
+	}
+	if got := len(bc.Chain()); got != 3 || bc.OrphanCount() != 0 {
+		t.Fatalf("chain has %d blocks and %d orphans, want 3 and 0", got, bc.OrphanCount())
+	}
+}
+func TestOrphanBelowDifficultyDropped(t *testing.T) {
+	bc := newTestChain(t)
+	b := NewBlock(0, [32]byte{1}, []*Transaction{newCoinbase(testMiner, MiningReward, 5)})
+	b.height = 5
+	b.difficulty = 0
+	b.invalidateHash()
+	if err := bc.AcceptBlock(b); err != ErrInvalidBlock {
+		t.Fatalf("got %v, want %v", err, ErrInvalidBlock)
+	}
+	if got := bc.OrphanCount(); got != 0 {
+		t.Fatalf("%d orphans buffered, want 0", got)
+	}
+}
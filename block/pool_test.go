@@ -0,0 +1,443 @@
+package block
+
+import (
+	"context"
+	"errors"
+	"goblockchain/wallet"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestAddTransactionConcurrentSameSequence(t *testing.T) {
+	alice, bob := newTestWallet(t), newTestWallet(t)
+	bc := newTestChain(t, alice)
+	const n = 20
+	var accepted int32
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		tx := signedTransaction(alice, bob, float32(60+i), 0.1, 0)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if addTransaction(bc, tx) == nil {
+				mu.Lock()
+				accepted++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if accepted != 1 {
+		t.Fatalf("accepted %d transactions with sequence 0, want 1", accepted)
+	}
+	if got := len(bc.TransactionPool()); got != 1 {
+		t.Fatalf("pool has %d transactions, want 1", got)
+	}
+}
+func TestPoolAccessorsConcurrent(t *testing.T) {
+	alice, bob := newTestWallet(t), newTestWallet(t)
+	bc := newTestChain(t, alice)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 10; i++ {
+			addTransaction(bc, signedTransaction(alice, bob, 1, 0.1, uint64(i)))
+		}
+	}()
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				bc.TransactionPool()
+				bc.CopyTransactionPool()
+				bc.NextSequence(alice.BlockchainAddress())
+				bc.EstimateFee(1)
+				bc.AuditPool()
+				bc.ExpireTransactions()
+			}
+		}()
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		bc.Mining()
+	}()
+	wg.Wait()
+	var spent float32
+	for _, tx := range bc.TransactionPool() {
+		spent += tx.cost()
+	}
+	for _, b := range bc.Chain()[1:] {
+		for _, tx := range b.Transactions() {
+			if tx.senderBlockchainAddress == alice.BlockchainAddress() {
+				spent += tx.cost()
+			}
+		}
+	}
+	if spent > 100 {
+		t.Fatalf("alice spent %v of 100", spent)
+	}
+}
+func TestChainAccessConcurrent(t *testing.T) {
+	alice, bob, carol := newTestWallet(t), newTestWallet(t), newTestWallet(t)
+	peer := newTestChain(t, alice, carol)
+	for i := 0; i < 6; i++ {
+		if err := addTransaction(peer, signedTransaction(carol, bob, 1, 0.1, uint64(i))); err != nil {
+			t.Fatal(err)
+		}
+		if !peer.Mining() {
+			t.Fatal("nothing mined")
+		}
+	}
+	data, err := peer.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	bc := newTestChain(t, alice, carol)
+	bc.neighbors = []string{servePeer(t, data)}
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 3; i++ {
+			addTransaction(bc, signedTransaction(alice, bob, 1, 0.1, bc.NextSequence(alice.BlockchainAddress())))
+			bc.Mining()
+		}
+	}()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 3; i++ {
+			bc.ResolveConflicts(context.Background())
+		}
+	}()
+	var readers sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				chain := bc.Chain()
+				if last := bc.LastBlock(); last.Height() < chain[len(chain)-1].Height() {
+					t.Errorf("last block at height %d behind a chain of %d", last.Height(), len(chain))
+				}
+				bc.Headers()
+				bc.CalculateTotalAmount(bob.BlockchainAddress())
+				bc.SerializedSize()
+				bc.ValidChain(chain)
+			}
+		}()
+	}
+	wg.Wait()
+	close(done)
+	readers.Wait()
+	if err := bc.Validate(); err != nil {
+		t.Fatalf("chain after concurrent mining and sync: %v", err)
+	}
+}
+func TestClearTransactionPoolStopsMining(t *testing.T) {
+	alice, bob := newTestWallet(t), newTestWallet(t)
+	bc := newTestChain(t, alice)
+	if err := addTransaction(bc, signedTransaction(alice, bob, 1, 0.1, 0)); err != nil {
+		t.Fatal(err)
+	}
+	bc.difficulty = 8
+	mined := make(chan bool)
+	go func() { mined <- bc.Mining() }()
+	for {
+		bc.muxMining.Lock()
+		started := bc.miningCancel != nil
+		bc.muxMining.Unlock()
+		if started {
+			break
+		}
+		runtime.Gosched()
+	}
+	bc.ClearTransactionPool()
+	if <-mined {
+		t.Fatal("mined a block from a cleared pool")
+	}
+	if got := len(bc.Chain()); got != 1 {
+		t.Fatalf("chain has %d blocks, want 1", got)
+	}
+}
+func TestAuditPool(t *testing.T) {
+	alice, bob := newTestWallet(t), newTestWallet(t)
+	bc := newTestChain(t, alice)
+	good := signedTransaction(alice, bob, 1, 0.1, 0)
+	if err := addTransaction(bc, good); err != nil {
+		t.Fatal(err)
+	}
+	// Slip in a transaction whose signature covers a different value.
+	forged := signedTransaction(alice, bob, 1, 0.1, 1)
+	forged.value = 50
+	bc.transactionPool = append(bc.transactionPool, forged)
+	results := bc.AuditPool()
+	if len(results) != 2 {
+		t.Fatalf("%d results, want 2", len(results))
+	}
+	if !results[0].Valid || results[0].Hash != good.Hash() {
+		t.Errorf("valid transaction flagged: %+v", results[0])
+	}
+	if results[1].Valid || results[1].Reason != "invalid signature" {
+		t.Errorf("forged transaction passed: %+v", results[1])
+	}
+	if got := len(bc.TransactionPool()); got != 2 {
+		t.Fatalf("audit changed the pool to %d transactions", got)
+	}
+	if removed := bc.PurgeInvalidPool(); removed != 1 {
+		t.Fatalf("purged %d, want 1", removed)
+	}
+	if pool := bc.TransactionPool(); len(pool) != 1 || pool[0] != good {
+		t.Fatal("purge kept the wrong transactions")
+	}
+}
+func TestEstimateFee(t *testing.T) {
+	alice, bob := newTestWallet(t), newTestWallet(t)
+	bc := newTestChain(t, alice)
+	if got := bc.EstimateFee(1); got != MinimumFee {
+		t.Fatalf("empty pool: %v, want the floor %v", got, MinimumFee)
+	}
+	bc.SetMaxTransactionsPerBlock(2)
+	for i, fee := range []float32{0.05, 0.5, 0.01, 0.2, 0.3, 0.02} {
+		if err := addTransaction(bc, signedTransaction(alice, bob, 1, fee, uint64(i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	soon, later := bc.EstimateFee(1), bc.EstimateFee(10)
+	if soon <= later {
+		t.Fatalf("estimate for 1 block %v not above the estimate for 10 blocks %v", soon, later)
+	}
+	// Two slots per block: outbid the second highest fee.
+	if want := float32(0.3) + MinimumFee; soon != want {
+		t.Fatalf("estimate for 1 block %v, want %v", soon, want)
+	}
+}
+func TestAddTransactionBalance(t *testing.T) {
+	alice, bob := newTestWallet(t), newTestWallet(t)
+	bc := newTestChain(t, alice)
+	if err := addTransaction(bc, signedTransaction(alice, bob, 150, 0, 0)); !errors.Is(err, ErrInsufficientBalance) {
+		t.Fatalf("overspend: got %v, want %v", err, ErrInsufficientBalance)
+	}
+	if err := addTransaction(bc, signedTransaction(alice, bob, 60, 0.1, 0)); err != nil {
+		t.Fatalf("covered spend: %v", err)
+	}
+	// Together with the pending 60.1 this is more than alice has.
+	if err := addTransaction(bc, signedTransaction(alice, bob, 40, 0, 1)); !errors.Is(err, ErrInsufficientBalance) {
+		t.Fatalf("pending overspend: got %v, want %v", err, ErrInsufficientBalance)
+	}
+	if err := addTransaction(bc, signedTransaction(alice, bob, 39.5, 0, 1)); err != nil {
+		t.Fatalf("spend of the rest: %v", err)
+	}
+	if err := addTransaction(bc, signedTransaction(bob, alice, 1, 0, 0)); !errors.Is(err, ErrInsufficientBalance) {
+		t.Fatalf("spend of pending income: got %v, want %v", err, ErrInsufficientBalance)
+	}
+}
+func TestDuplicateTransactionRejected(t *testing.T) {
+	alice, bob := newTestWallet(t), newTestWallet(t)
+	bc := newTestChain(t, alice)
+	tx := signedTransaction(alice, bob, 1, 0.1, 0)
+	if err := addTransaction(bc, tx); err != nil {
+		t.Fatal(err)
+	}
+	if err := addTransaction(bc, signedTransaction(alice, bob, 1, 0.1, 0)); err == nil {
+		t.Fatal("pooled transaction accepted again")
+	}
+	if n := len(bc.TransactionPool()); n != 1 {
+		t.Fatalf("%d pooled transactions, want 1", n)
+	}
+	if !bc.knowsTransaction(tx) {
+		t.Fatal("pooled transaction not known")
+	}
+	if !bc.Mining() {
+		t.Fatal("nothing mined")
+	}
+	if err := addTransaction(bc, signedTransaction(alice, bob, 1, 0.1, 0)); err == nil {
+		t.Fatal("mined transaction accepted again")
+	}
+	if n := len(bc.TransactionPool()); n != 0 {
+		t.Fatalf("%d pooled transactions, want none", n)
+	}
+	if !bc.knowsTransaction(tx) {
+		t.Fatal("mined transaction not known")
+	}
+}
+func TestMiningPrefersHigherFees(t *testing.T) {
+	wallets := make([]*wallet.Wallet, 4)
+	for i := range wallets {
+		wallets[i] = newTestWallet(t)
+	}
+	bob := newTestWallet(t)
+	bc := newTestChain(t, wallets...)
+	bc.SetMaxTransactionsPerBlock(2)
+	fees := []float32{0.1, 0.4, 0.2, 0.3}
+	for i, w := range wallets {
+		if err := addTransaction(bc, signedTransaction(w, bob, 1, fees[i], 0)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !bc.Mining() {
+		t.Fatal("nothing mined")
+	}
+	mined := make(map[float32]bool)
+	for _, tx := range bc.LastBlock().Transactions() {
+		if tx.senderBlockchainAddress != MiningSender {
+			mined[tx.fee] = true
+		}
+	}
+	if len(mined) != 2 || !mined[0.4] || !mined[0.3] {
+		t.Fatalf("mined fees %v, want 0.4 and 0.3", mined)
+	}
+	pool := bc.TransactionPool()
+	if len(pool) != 2 {
+		t.Fatalf("%d pooled transactions left, want 2", len(pool))
+	}
+	if !bc.Mining() {
+		t.Fatal("nothing mined")
+	}
+	if len(bc.TransactionPool()) != 0 {
+		t.Fatal("lower-fee transactions not mined in the next block")
+	}
+}
+func TestMempoolCap(t *testing.T) {
+	wallets := make([]*wallet.Wallet, 4)
+	for i := range wallets {
+		wallets[i] = newTestWallet(t)
+	}
+	bob := newTestWallet(t)
+	bc := newTestChain(t, wallets...)
+	bc.SetMaxMempoolSize(3)
+	fees := []float32{0.2, 0.1, 0.3}
+	for i, fee := range fees {
+		if err := addTransaction(bc, signedTransaction(wallets[i], bob, 1, fee, 0)); err != nil {
+			t.Fatalf("transaction %d under capacity: %v", i, err)
+		}
+	}
+	for _, fee := range []float32{0.05, 0.1} {
+		if err := addTransaction(bc, signedTransaction(wallets[3], bob, 1, fee, 0)); !errors.Is(err, ErrMempoolFull) {
+			t.Fatalf("fee %v into a full pool: got %v, want %v", fee, err, ErrMempoolFull)
+		}
+	}
+	if n := len(bc.TransactionPool()); n != 3 {
+		t.Fatalf("%d pooled transactions after rejections, want 3", n)
+	}
+	if err := addTransaction(bc, signedTransaction(wallets[3], bob, 1, 0.15, 0)); err != nil {
+		t.Fatalf("higher fee into a full pool: %v", err)
+	}
+	pool := bc.TransactionPool()
+	if len(pool) != 3 {
+		t.Fatalf("%d pooled transactions after eviction, want 3", len(pool))
+	}
+	for _, tx := range pool {
+		if tx.fee == 0.1 {
+			t.Fatal("lowest-fee transaction not evicted")
+		}
+	}
+	// The evicted sequence is free for its sender to use again.
+	if got := bc.NextSequence(wallets[1].BlockchainAddress()); got != 0 {
+		t.Fatalf("evicted sender's next sequence %d, want 0", got)
+	}
+	bc.SetMaxMempoolSize(0)
+	if err := addTransaction(bc, signedTransaction(wallets[1], bob, 1, 0.01, 0)); err != nil {
+		t.Fatalf("uncapped pool: %v", err)
+	}
+}
+func TestExpireTransactions(t *testing.T) {
+	alice, bob, carol := newTestWallet(t), newTestWallet(t), newTestWallet(t)
+	bc := newTestChain(t, alice, bob)
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	bc.SetClock(func() time.Time { return now })
+	bc.SetTransactionTTL(time.Hour)
+	stale := signedTransaction(alice, carol, 1, 0.1, 0)
+	if err := addTransaction(bc, stale); err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(30 * time.Minute)
+	fresh := signedTransaction(bob, carol, 1, 0.1, 0)
+	if err := addTransaction(bc, fresh); err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(30 * time.Minute)
+	if n := bc.ExpireTransactions(); n != 0 {
+		t.Fatalf("%d expired at exactly the TTL, want none", n)
+	}
+	now = now.Add(time.Second)
+	if n := bc.ExpireTransactions(); n != 1 {
+		t.Fatalf("%d expired past the TTL, want 1", n)
+	}
+	pool := bc.TransactionPool()
+	if len(pool) != 1 || pool[0].Hash() != fresh.Hash() {
+		t.Fatalf("pool %v, want only the fresh transaction", pool)
+	}
+	// Mining sweeps the pool first.
+	now = now.Add(time.Hour)
+	if bc.Mining() {
+		t.Fatal("mined a block of expired transactions")
+	}
+	if n := len(bc.TransactionPool()); n != 0 {
+		t.Fatalf("%d pooled transactions after mining swept, want none", n)
+	}
+	bc.SetTransactionTTL(0)
+	if err := addTransaction(bc, signedTransaction(alice, carol, 1, 0.1, 0)); err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(1000 * time.Hour)
+	if n := bc.ExpireTransactions(); n != 0 {
+		t.Fatalf("%d expired without a TTL, want none", n)
+	}
+}
+func TestRemoveTransactionWhileMining(t *testing.T) {
+	for _, c := range []struct {
+		name  string
+		mined bool
+	}{
+		{"unrelated transaction", true},
+		{"transaction being mined", false},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			alice, bob, carol := newTestWallet(t), newTestWallet(t), newTestWallet(t)
+			bc := newTestChain(t, alice, carol)
+			mining := signedTransaction(alice, bob, 1, 0.1, 0)
+			if err := addTransaction(bc, mining); err != nil {
+				t.Fatal(err)
+			}
+			bc.difficulty = 5
+			mined := make(chan bool)
+			go func() { mined <- bc.Mining() }()
+			for {
+				bc.muxMining.Lock()
+				started := bc.miningCancel != nil
+				bc.muxMining.Unlock()
+				if started {
+					break
+				}
+				runtime.Gosched()
+			}
+			removed := mining
+			if c.mined {
+				// Arrives after the block was assembled, so it is not in it.
+				removed = signedTransaction(carol, bob, 1, 0.1, 0)
+				if err := addTransaction(bc, removed); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if !bc.RemoveTransaction(removed.TransactionId()) {
+				t.Fatal("transaction not in the pool")
+			}
+			if got := <-mined; got != c.mined {
+				t.Fatalf("mined %v, want %v", got, c.mined)
+			}
+		})
+	}
+}
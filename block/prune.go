@@ -0,0 +1,228 @@
+package block
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// SetPruning keeps full blocks only for the last keep heights and drops the
+// transactions of older blocks, keeping their headers. Balances, sequences
+// and the spent index are kept up to date regardless. Blocks within the
+// coinbase maturity window are always kept in full. Zero or less turns
+// pruning off, but blocks already pruned stay pruned.
+func (bc *Blockchain) SetPruning(keep int) {
+	bc.muxChain.Lock()
+	defer bc.muxChain.Unlock()
+	bc.keepBlocks = keep
+	bc.pruneChain()
+}
+
+// PruneHeight is the height of the lowest block that is still kept in
+// full. Blocks between genesis and it are header-only.
+func (bc *Blockchain) PruneHeight() int {
+	bc.muxChain.RLock()
+	defer bc.muxChain.RUnlock()
+	return bc.pruned.height
+}
+
+// Pruned reports whether the block's transactions have been dropped.
+func (b *Block) Pruned() bool {
+	return b.pruned
+}
+
+// withoutBody returns a header-only copy of b. Blocks are shared once in a
+// chain, so b itself is left alone.
+func (b *Block) withoutBody() *Block {
+	return &Block{
+		version:      b.version,
+		height:       b.height,
+		timestamp:    b.timestamp,
+		nonce:        b.nonce,
+		difficulty:   b.difficulty,
+		previousHash: b.previousHash,
+		merkleRoot:   b.merkleRoot,
+		pruned:       true,
+	}
+}
+
+// headersBelow returns chain with the blocks between genesis and height
+// header-only, copying chain if any of them is still full.
+func headersBelow(chain []*Block, height int) []*Block {
+	for i := 1; i < height; i++ {
+		if chain[i].pruned {
+			continue
+		}
+		stripped := make([]*Block, len(chain))
+		copy(stripped, chain)
+		for ; i < height; i++ {
+			if !stripped[i].pruned {
+				stripped[i] = stripped[i].withoutBody()
+			}
+		}
+		return stripped
+	}
+	return chain
+}
+
+// pruneChain moves the blocks that have fallen out of the keep window into
+// the pruned index and replaces them with header-only copies. Genesis is
+// never pruned. The caller holds muxChain.
+func (bc *Blockchain) pruneChain() {
+	if bc.keepBlocks <= 0 {
+		return
+	}
+	keep := bc.keepBlocks
+	if keep < bc.coinbaseMaturity {
+		keep = bc.coinbaseMaturity
+	}
+	target := len(bc.chain) - keep
+	if target <= 1 || target <= bc.pruned.height {
+		return
+	}
+	// Readers may hold the old chain or pruned index; build new ones.
+	chain := make([]*Block, len(bc.chain))
+	copy(chain, bc.chain)
+	pruned := bc.pruned.clone()
+	for height := pruned.height; height < target; height++ {
+		pruned.applyBlock(chain[height])
+		if height > 0 {
+			b := chain[height].withoutBody()
+			bc.blockBytes += b.serializedSize() - chain[height].serializedSize()
+			chain[height] = b
+		}
+	}
+	bc.chain = chain
+	bc.pruned = pruned
+}
+
+// prunedHeight returns the height of the lowest full block in chain, or 1
+// if no block is pruned.
+func prunedHeight(chain []*Block) int {
+	n := 1
+	for n < len(chain) && chain[n].pruned {
+		n++
+	}
+	return n
+}
+
+// describes reports whether x is the index of the pruned blocks of chain.
+func (x *chainIndex) describes(chain []*Block) bool {
+	n := prunedHeight(chain)
+	return x != nil && x.height == n && chain[n-1].Hash() == x.tip
+}
+
+// prunedBase returns the index to replay chain from. A chain without pruned
+// blocks is replayed from scratch. What pruned blocks left can't be checked
+// against their headers, so they must be blocks we hold and the index the
+// one we built for them; saved is the index Load read from our own storage
+// along with chain, and is used if it describes chain.
+func (bc *Blockchain) prunedBase(chain []*Block, saved *chainIndex) (*chainIndex, error) {
+	n := prunedHeight(chain)
+	for i := n; i < len(chain); i++ {
+		if chain[i].pruned {
+			return nil, &ChainError{i, errors.New("pruned block above full blocks")}
+		}
+	}
+	if n == 1 {
+		return newChainIndex(), nil
+	}
+	if saved.describes(chain) {
+		return saved, nil
+	}
+	bc.muxChain.RLock()
+	base, ok := bc.ownIndex(chain[:n])
+	bc.muxChain.RUnlock()
+	if !ok {
+		return nil, &ChainError{n - 1, errors.New("pruned blocks are not in our chain")}
+	}
+	return base, nil
+}
+
+// ownIndex returns the index of prefix if it is also how our chain starts,
+// built from our pruned index and the full blocks above it. The blocks are
+// linked by hash, so matching the last is enough. The caller holds
+// muxChain.
+func (bc *Blockchain) ownIndex(prefix []*Block) (*chainIndex, bool) {
+	n := len(prefix)
+	if n > len(bc.chain) || n < bc.pruned.height || bc.chain[n-1].Hash() != prefix[n-1].Hash() {
+		return nil, false
+	}
+	x := bc.pruned
+	if x.height < n {
+		x = x.clone()
+		for height := x.height; height < n; height++ {
+			x.applyBlock(bc.chain[height])
+		}
+	}
+	return x, true
+}
+func (x *chainIndex) MarshalJSON() ([]byte, error) {
+	spent := make(map[string]int, len(x.spent))
+	for h, n := range x.spent {
+		spent[hex.EncodeToString(h[:])] = n
+	}
+	return json.Marshal(struct {
+		Height           int                `json:"height"`
+		Tip              string             `json:"tip"`
+		Spent            map[string]int     `json:"spent"`
+		Balances         map[string]float64 `json:"balances"`
+		AddressRefs      map[string]int     `json:"address_refs"`
+		Sequences        map[string]uint64  `json:"sequences"`
+		BlockBytes       int                `json:"block_bytes"`
+		TransactionCount int                `json:"transaction_count"`
+	}{
+		Height:           x.height,
+		Tip:              fmt.Sprintf("%x", x.tip),
+		Spent:            spent,
+		Balances:         x.balances,
+		AddressRefs:      x.addressRefs,
+		Sequences:        x.sequences,
+		BlockBytes:       x.blockBytes,
+		TransactionCount: x.transactionCount,
+	})
+}
+func (x *chainIndex) UnmarshalJSON(data []byte) error {
+	*x = *newChainIndex()
+	var tip string
+	var spent map[string]int
+	v := &struct {
+		Height           *int                `json:"height"`
+		Tip              *string             `json:"tip"`
+		Spent            *map[string]int     `json:"spent"`
+		Balances         *map[string]float64 `json:"balances"`
+		AddressRefs      *map[string]int     `json:"address_refs"`
+		Sequences        *map[string]uint64  `json:"sequences"`
+		BlockBytes       *int                `json:"block_bytes"`
+		TransactionCount *int                `json:"transaction_count"`
+	}{
+		Height:           &x.height,
+		Tip:              &tip,
+		Spent:            &spent,
+		Balances:         &x.balances,
+		AddressRefs:      &x.addressRefs,
+		Sequences:        &x.sequences,
+		BlockBytes:       &x.blockBytes,
+		TransactionCount: &x.transactionCount,
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	if x.balances == nil || x.addressRefs == nil || x.sequences == nil {
+		return errors.New("pruned index is missing balances, address_refs or sequences")
+	}
+	t, err := hex.DecodeString(tip)
+	if err != nil || len(t) != len(x.tip) {
+		return fmt.Errorf("invalid pruned tip %q", tip)
+	}
+	copy(x.tip[:], t)
+	for s, n := range spent {
+		h, err := hex.DecodeString(s)
+		if err != nil || len(h) != 32 {
+			return fmt.Errorf("invalid spent hash %q", s)
+		}
+		x.spent[[32]byte(h)] = n
+	}
+	return nil
+}
@@ -0,0 +1,170 @@
+package block
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"goblockchain/wallet"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newPrunedChain mines eight blocks, each paying bob, and prunes all but
+// the last three.
+func newPrunedChain(t *testing.T, alice, bob *wallet.Wallet) (pruned, full *Blockchain) {
+	t.Helper()
+	pruned = newTestChain(t, alice)
+	pruned.SetCoinbaseMaturity(2)
+	for i := 0; i < 8; i++ {
+		if err := addTransaction(pruned, signedTransaction(alice, bob, 1, 0.5, uint64(i))); err != nil {
+			t.Fatal(err)
+		}
+		if !pruned.Mining() {
+			t.Fatal("nothing mined")
+		}
+	}
+	full = newTestChain(t, alice)
+	full.SetCoinbaseMaturity(2)
+	full.replaceChain(pruned.Chain(), nil)
+	pruned.SetPruning(3)
+	return pruned, full
+}
+func TestPruningKeepsState(t *testing.T) {
+	alice, bob := newTestWallet(t), newTestWallet(t)
+	bc, full := newPrunedChain(t, alice, bob)
+	if got := bc.PruneHeight(); got != 6 {
+		t.Fatalf("prune height %d, want 6", got)
+	}
+	for i, b := range bc.Chain() {
+		if want := i > 0 && i < 6; b.Pruned() != want {
+			t.Errorf("block %d pruned: %v, want %v", i, b.Pruned(), want)
+		}
+	}
+	if err := bc.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	for _, address := range []string{alice.BlockchainAddress(), bob.BlockchainAddress(), testMiner} {
+		if got, want := bc.Balance(address), full.Balance(address); got != want {
+			t.Errorf("balance of %s: %v, want %v", address, got, want)
+		}
+		if got, want := bc.NextSequence(address), full.NextSequence(address); got != want {
+			t.Errorf("next sequence of %s: %d, want %d", address, got, want)
+		}
+	}
+	if err := addTransaction(bc, signedTransaction(alice, bob, 1, 0.5, 0)); err == nil {
+		t.Fatal("replayed a pruned transaction")
+	}
+}
+func TestPrunedChainSaveLoad(t *testing.T) {
+	alice, bob := newTestWallet(t), newTestWallet(t)
+	bc, _ := newPrunedChain(t, alice, bob)
+	path := filepath.Join(t.TempDir(), "chain.json")
+	if err := bc.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	loaded := newTestChain(t, alice)
+	loaded.SetCoinbaseMaturity(2)
+	if err := loaded.Load(path); err != nil {
+		t.Fatal(err)
+	}
+	if loaded.PruneHeight() != bc.PruneHeight() || loaded.Balance(bob.BlockchainAddress()) != bc.Balance(bob.BlockchainAddress()) {
+		t.Fatal("loaded chain differs from the saved one")
+	}
+}
+
+// servePeer answers GET /chain with data.
+func servePeer(t *testing.T, data []byte) string {
+	t.Helper()
+	peer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write(data)
+	}))
+	t.Cleanup(peer.Close)
+	return strings.TrimPrefix(peer.URL, "http://")
+}
+func TestSyncFromPrunedPeer(t *testing.T) {
+	alice, bob := newTestWallet(t), newTestWallet(t)
+	bc, full := newPrunedChain(t, alice, bob)
+	data, err := bc.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The peer has pruned blocks 1 to 5; a node holding them catches up.
+	follower := newTestChain(t, alice)
+	follower.SetCoinbaseMaturity(2)
+	follower.replaceChain(full.Chain()[:7], nil)
+	follower.neighbors = []string{servePeer(t, data)}
+	if !follower.ResolveConflicts(context.Background()) {
+		t.Fatal("pruned peer chain not adopted")
+	}
+	if got := follower.PruneHeight(); got != bc.PruneHeight() {
+		t.Fatalf("prune height %d, want %d", got, bc.PruneHeight())
+	}
+	if got, want := follower.Balance(bob.BlockchainAddress()), bc.Balance(bob.BlockchainAddress()); got != want {
+		t.Fatalf("balance %v, want %v", got, want)
+	}
+	if err := follower.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	// Nodes missing the pruned blocks can't check what they left.
+	for name, held := range map[string]int{"fresh": 1, "behind": 4} {
+		lagging := newTestChain(t, alice)
+		lagging.SetCoinbaseMaturity(2)
+		lagging.replaceChain(full.Chain()[:held], nil)
+		lagging.neighbors = []string{servePeer(t, data)}
+		if lagging.ResolveConflicts(context.Background()) {
+			t.Errorf("%s: pruned peer chain adopted", name)
+		}
+		if got := len(lagging.Chain()); got != held {
+			t.Errorf("%s: chain has %d blocks, want %d", name, got, held)
+		}
+	}
+}
+func TestPrunedPeerChecked(t *testing.T) {
+	alice, bob := newTestWallet(t), newTestWallet(t)
+	bc, full := newPrunedChain(t, alice, bob)
+	data, _ := bc.MarshalJSON()
+	for name, height := range map[string]int{"pruned header": 3, "full block": 7} {
+		var v map[string]any
+		d := json.NewDecoder(bytes.NewReader(data))
+		d.UseNumber()
+		d.Decode(&v)
+		b := v["chain"].([]any)[height].(map[string]any)
+		b["nonce"] = json.Number(b["nonce"].(json.Number).String() + "1")
+		m, _ := json.Marshal(v)
+		follower := newTestChain(t, alice)
+		follower.SetCoinbaseMaturity(2)
+		follower.replaceChain(full.Chain()[:7], nil)
+		follower.neighbors = []string{servePeer(t, m)}
+		if follower.ResolveConflicts(context.Background()) {
+			t.Errorf("%s: tampered chain adopted", name)
+		}
+	}
+}
+func TestPrunedPeerForgedBalances(t *testing.T) {
+	alice, bob, mallory := newTestWallet(t), newTestWallet(t), newTestWallet(t)
+	bc, full := newPrunedChain(t, alice, bob)
+	// Honest headers, an index crediting mallory and one block spending it.
+	forged := bc.pruned.clone()
+	forged.balances[mallory.BlockchainAddress()] = 1000
+	forged.addressRefs[mallory.BlockchainAddress()] = 1
+	spend := forgedBlock(t, bc, signedTransaction(mallory, bob, 500, 0.1, 0))
+	data, err := (&Blockchain{chain: append(bc.Chain(), spend), pruned: forged}).MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, held := range map[string]int{"fresh": 1, "holding the pruned blocks": len(full.Chain())} {
+		victim := newTestChain(t, alice)
+		victim.SetCoinbaseMaturity(2)
+		victim.replaceChain(full.Chain()[:held], nil)
+		victim.neighbors = []string{servePeer(t, data)}
+		if victim.ResolveConflicts(context.Background()) {
+			t.Errorf("%s: chain with forged balances adopted", name)
+		}
+		if got := victim.Balance(mallory.BlockchainAddress()); got != 0 {
+			t.Errorf("%s: mallory has %v", name, got)
+		}
+	}
+}
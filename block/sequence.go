@@ -0,0 +1,94 @@
+package block
+
+import (
+	"fmt"
+)
+
+// NextSequence returns the sequence the sender's next transaction must
+// carry: one past its last confirmed transaction and the pending ones that
+// follow it without a gap. Pending transactions stranded behind a gap, left
+// when one before them was evicted or removed, don't count, so the sender
+// can fill the gap.
+func (bc *Blockchain) NextSequence(blockchainAddress string) uint64 {
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+	return bc.nextSequence(blockchainAddress)
+}
+
+// nextSequence is NextSequence for callers holding bc.mux.
+func (bc *Blockchain) nextSequence(blockchainAddress string) uint64 {
+	bc.muxChain.RLock()
+	next := bc.sequences[blockchainAddress]
+	bc.muxChain.RUnlock()
+	pending := make(map[uint64]bool)
+	for _, t := range bc.transactionPool {
+		if t.senderBlockchainAddress == blockchainAddress {
+			pending[t.sequence] = true
+		}
+	}
+	for pending[next] {
+		next++
+	}
+	return next
+}
+
+// confirmedSequences returns the next confirmed sequence of every sender
+// in b.
+func (bc *Blockchain) confirmedSequences(b *Block) map[string]uint64 {
+	bc.muxChain.RLock()
+	defer bc.muxChain.RUnlock()
+	next := make(map[string]uint64)
+	for _, t := range b.transactions {
+		next[t.senderBlockchainAddress] = bc.sequences[t.senderBlockchainAddress]
+	}
+	return next
+}
+
+// checkSequences checks that every sender's transactions in b carry
+// consecutive sequences starting at next[sender], and advances next past
+// them.
+func checkSequences(b *Block, next map[string]uint64) error {
+	for _, t := range b.transactions {
+		if t.senderBlockchainAddress == MiningSender {
+			continue
+		}
+		if want := next[t.senderBlockchainAddress]; t.sequence != want {
+			return fmt.Errorf("%s sent sequence %d, expected %d", t.senderBlockchainAddress, t.sequence, want)
+		}
+		next[t.senderBlockchainAddress]++
+	}
+	return nil
+}
+
+// inSequence orders transactions so each sender's come in sequence after
+// its confirmed ones, otherwise keeping their order. A transaction whose
+// predecessor is missing is left out.
+func (bc *Blockchain) inSequence(transactions []*Transaction) []*Transaction {
+	bc.muxChain.RLock()
+	next := make(map[string]uint64)
+	for _, t := range transactions {
+		next[t.senderBlockchainAddress] = bc.sequences[t.senderBlockchainAddress]
+	}
+	bc.muxChain.RUnlock()
+	ordered := make([]*Transaction, 0, len(transactions))
+	remaining := transactions
+	for progress := true; progress; {
+		progress = false
+		deferred := make([]*Transaction, 0)
+		for _, t := range remaining {
+			switch {
+			case t.senderBlockchainAddress == MiningSender:
+				ordered = append(ordered, t)
+				progress = true
+			case t.sequence == next[t.senderBlockchainAddress]:
+				ordered = append(ordered, t)
+				next[t.senderBlockchainAddress]++
+				progress = true
+			default:
+				deferred = append(deferred, t)
+			}
+		}
+		remaining = deferred
+	}
+	return ordered
+}
@@ -0,0 +1,53 @@
+package block
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNextSequenceSkipsStrandedTransactions(t *testing.T) {
+	alice, bob := newTestWallet(t), newTestWallet(t)
+	bc := newTestChain(t, alice)
+	var pooled []*Transaction
+	for i := 0; i < 3; i++ {
+		tx := signedTransaction(alice, bob, 1, 0.1, uint64(i))
+		if err := addTransaction(bc, tx); err != nil {
+			t.Fatal(err)
+		}
+		pooled = append(pooled, tx)
+	}
+	if got := bc.NextSequence(alice.BlockchainAddress()); got != 3 {
+		t.Fatalf("next sequence %d, want 3", got)
+	}
+	bc.RemoveTransaction(pooled[1].TransactionId())
+	if got := bc.NextSequence(alice.BlockchainAddress()); got != 1 {
+		t.Fatalf("next sequence after removing 1: %d, want 1", got)
+	}
+	refill := signedTransaction(alice, bob, 2, 0.1, 1)
+	if err := addTransaction(bc, refill); err != nil {
+		t.Fatalf("filling the gap: %v", err)
+	}
+	if got := bc.NextSequence(alice.BlockchainAddress()); got != 3 {
+		t.Fatalf("next sequence after refill %d, want 3", got)
+	}
+	if !bc.Mining() {
+		t.Fatal("nothing mined")
+	}
+	if got := bc.NextSequence(alice.BlockchainAddress()); got != 3 {
+		t.Fatalf("next sequence after mining %d, want 3", got)
+	}
+}
+func TestAddTransactionSequence(t *testing.T) {
+	alice, bob := newTestWallet(t), newTestWallet(t)
+	bc := newTestChain(t, alice)
+	if err := addTransaction(bc, signedTransaction(alice, bob, 1, 0.1, 1)); !errors.Is(err, ErrSequenceGap) {
+		t.Fatalf("skipping ahead: got %v, want %v", err, ErrSequenceGap)
+	}
+	if err := addTransaction(bc, signedTransaction(alice, bob, 1, 0.1, 0)); err != nil {
+		t.Fatal(err)
+	}
+	bc.Mining()
+	if err := addTransaction(bc, signedTransaction(alice, bob, 3, 0.1, 0)); !errors.Is(err, ErrReplayedTransaction) {
+		t.Fatalf("replay: got %v, want %v", err, ErrReplayedTransaction)
+	}
+}
@@ -0,0 +1,62 @@
+package block
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// SnapshotVersion is the envelope version ExportChain writes. ImportChain
+// rejects snapshots without a version or from a newer one.
+const SnapshotVersion = 1
+
+// snapshot wraps a saved chain with what an importing node needs to check
+// before trusting it.
+type snapshot struct {
+	Version   int    `json:"version"`
+	NetworkID string `json:"network_id"`
+	chainFile
+}
+
+// ExportChain writes the whole chain and the transaction pool to w as a
+// single versioned JSON document, for backups or moving a node.
+func (bc *Blockchain) ExportChain(w io.Writer) error {
+	bc.mux.Lock()
+	v := bc.chainFile()
+	bc.mux.Unlock()
+	return json.NewEncoder(w).Encode(&snapshot{
+		Version:   SnapshotVersion,
+		NetworkID: bc.NetworkID(),
+		chainFile: v,
+	})
+}
+
+// ImportChain replaces the chain and the transaction pool with a snapshot
+// written by ExportChain. The snapshot must be from our network and its
+// chain must pass Validate; otherwise nothing is changed. The index a
+// pruning node exports for its pruned blocks can't be checked against
+// their headers, so it is ignored: a pruned snapshot only imports onto a
+// node that already holds those blocks.
+func (bc *Blockchain) ImportChain(r io.Reader) error {
+	var v snapshot
+	if err := json.NewDecoder(r).Decode(&v); err != nil {
+		return err
+	}
+	if v.Version < 1 || v.Version > SnapshotVersion {
+		return fmt.Errorf("unsupported snapshot version %d", v.Version)
+	}
+	if v.NetworkID != bc.NetworkID() {
+		return fmt.Errorf("snapshot is from network %q, want %q", v.NetworkID, bc.NetworkID())
+	}
+	v.Pruned = nil
+	// The block being mined builds on the tip we are about to replace.
+	bc.cancelMining()
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+	if err := bc.restore(&v.chainFile); err != nil {
+		return err
+	}
+	bc.emit(Event{Type: EventReorg, Block: bc.LastBlock()})
+	bc.autosave()
+	return nil
+}
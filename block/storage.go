@@ -0,0 +1,124 @@
+package block
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"goblockchain/utils"
+	"log/slog"
+	"os"
+)
+
+// chainFile is what Save writes. The pool is saved signed, so each
+// transaction can be checked again when it is loaded. Pruned is the index
+// of the pruned blocks, which can't be rebuilt from their headers; it is
+// left out if nothing was pruned.
+type chainFile struct {
+	Chain           []*Block              `json:"chain"`
+	TransactionPool []*TransactionRequest `json:"transaction_pool"`
+	Pruned          *chainIndex           `json:"pruned,omitempty"`
+}
+
+// chainFile collects what Save writes. The caller holds bc.mux.
+func (bc *Blockchain) chainFile() chainFile {
+	bc.muxChain.RLock()
+	v := chainFile{
+		Chain:           bc.chain[:len(bc.chain):len(bc.chain)],
+		TransactionPool: make([]*TransactionRequest, 0, len(bc.transactionPool)),
+	}
+	for _, t := range bc.transactionPool {
+		v.TransactionPool = append(v.TransactionPool, transactionRequest(t))
+	}
+	if bc.pruned.height > 0 {
+		v.Pruned = bc.pruned
+	}
+	bc.muxChain.RUnlock()
+	return v
+}
+func (bc *Blockchain) Save(path string) error {
+	bc.mux.Lock()
+	v := bc.chainFile()
+	bc.mux.Unlock()
+	return writeChainFile(path, &v)
+}
+func writeChainFile(path string, v *chainFile) error {
+	m, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	// Write then rename so a crash never leaves a half-written file behind.
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, m, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+func (bc *Blockchain) Load(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var v chainFile
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+	if err := bc.restore(&v); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+// restore validates a saved chain and adopts it together with its
+// transaction pool and the index of its pruned blocks. The caller holds
+// bc.mux.
+func (bc *Blockchain) restore(v *chainFile) error {
+	if len(v.Chain) == 0 {
+		return errors.New("no blocks")
+	}
+	if err := bc.validateChain(v.Chain, v.Pruned); err != nil {
+		return err
+	}
+	pruned, err := bc.prunedBase(v.Chain, v.Pruned)
+	if err != nil {
+		return err
+	}
+	bc.replaceChain(v.Chain, pruned)
+	// Saved transactions go through the same checks as new ones, against
+	// the chain just adopted; those that fail are dropped. Arrival times are
+	// not saved, so the TTL restarts.
+	bc.transactionPool = []*Transaction{}
+	for _, r := range v.TransactionPool {
+		if err := bc.readmitTransaction(r); err != nil {
+			slog.Warn("saved transaction dropped", "error", err)
+		}
+	}
+	return nil
+}
+func (bc *Blockchain) readmitTransaction(r *TransactionRequest) error {
+	if !r.Validate() {
+		return errors.New("missing or invalid field(s)")
+	}
+	publicKey, err := utils.PublicKeyFromString(*r.SenderPublicKey)
+	if err != nil {
+		return err
+	}
+	signature, err := utils.SignatureFromString(*r.Signature)
+	if err != nil {
+		return err
+	}
+	return bc.addTransaction(r.Transaction(), publicKey, signature)
+}
+func (bc *Blockchain) SetAutosave(path string) {
+	bc.autosavePath = path
+}
+func (bc *Blockchain) autosave() {
+	if bc.autosavePath == "" {
+		return
+	}
+	v := bc.chainFile()
+	if err := writeChainFile(bc.autosavePath, &v); err != nil {
+		slog.Error("autosave failed", "path", bc.autosavePath, "error", err)
+	}
+}
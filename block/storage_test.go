@@ -0,0 +1,270 @@
+package block
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSaveLoadReadmitsPool(t *testing.T) {
+	alice, bob := newTestWallet(t), newTestWallet(t)
+	bc := newTestChain(t, alice)
+	for i := 0; i < 2; i++ {
+		if err := addTransaction(bc, signedTransaction(alice, bob, 1, 0.1, uint64(i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	path := filepath.Join(t.TempDir(), "chain.json")
+	if err := bc.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	loaded := newTestChain(t, alice)
+	if err := loaded.Load(path); err != nil {
+		t.Fatal(err)
+	}
+	if got := len(loaded.TransactionPool()); got != 2 {
+		t.Fatalf("loaded %d pooled transactions, want 2", got)
+	}
+	// Raise the second transaction's value; its signature no longer matches.
+	data, _ := os.ReadFile(path)
+	var v map[string]json.RawMessage
+	json.Unmarshal(data, &v)
+	var pool []map[string]any
+	json.Unmarshal(v["transaction_pool"], &pool)
+	pool[1]["value"] = 50
+	v["transaction_pool"], _ = json.Marshal(pool)
+	data, _ = json.Marshal(v)
+	os.WriteFile(path, data, 0600)
+	tampered := newTestChain(t, alice)
+	if err := tampered.Load(path); err != nil {
+		t.Fatal(err)
+	}
+	if got := len(tampered.TransactionPool()); got != 1 {
+		t.Fatalf("loaded %d pooled transactions, want 1", got)
+	}
+}
+func TestImportChainDropsUnsignedPool(t *testing.T) {
+	alice, bob := newTestWallet(t), newTestWallet(t)
+	bc := newTestChain(t, alice)
+	var buf bytes.Buffer
+	if err := bc.ExportChain(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var v map[string]json.RawMessage
+	json.Unmarshal(buf.Bytes(), &v)
+	unsigned := NewTransaction(alice.BlockchainAddress(), bob.BlockchainAddress(), 99, 0.1, 0, 0)
+	v["transaction_pool"], _ = json.Marshal([]*Transaction{unsigned})
+	data, _ := json.Marshal(v)
+	if err := bc.ImportChain(bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	if got := len(bc.TransactionPool()); got != 0 {
+		t.Fatalf("imported %d unsigned transactions", got)
+	}
+}
+func TestSaveLoadChain(t *testing.T) {
+	alice, bob := newTestWallet(t), newTestWallet(t)
+	bc := newTestChain(t, alice)
+	for i := 0; i < 2; i++ {
+		if err := addTransaction(bc, signedTransaction(alice, bob, 1, 0.1, uint64(i))); err != nil {
+			t.Fatal(err)
+		}
+		if !bc.Mining() {
+			t.Fatal("nothing mined")
+		}
+	}
+	path := filepath.Join(t.TempDir(), "chain.json")
+	if err := bc.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	loaded := newTestChain(t, alice)
+	if err := loaded.Load(path); err != nil {
+		t.Fatal(err)
+	}
+	want, got := bc.Chain(), loaded.Chain()
+	if len(got) != len(want) {
+		t.Fatalf("loaded %d blocks, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i].Hash() != want[i].Hash() {
+			t.Fatalf("block %d differs after loading", i)
+		}
+	}
+	if got, want := loaded.Balance(bob.BlockchainAddress()), bc.Balance(bob.BlockchainAddress()); got != want {
+		t.Fatalf("balance %v after loading, want %v", got, want)
+	}
+	os.WriteFile(path, []byte("{"), 0600)
+	if err := loaded.Load(path); err == nil {
+		t.Fatal("loaded a corrupt file")
+	}
+	if len(loaded.Chain()) != len(want) {
+		t.Fatal("failed load changed the chain")
+	}
+}
+func TestAutosaveAfterMining(t *testing.T) {
+	alice, bob := newTestWallet(t), newTestWallet(t)
+	bc := newTestChain(t, alice)
+	path := filepath.Join(t.TempDir(), "chain.json")
+	bc.SetAutosave(path)
+	if err := addTransaction(bc, signedTransaction(alice, bob, 1, 0.1, 0)); err != nil {
+		t.Fatal(err)
+	}
+	if !bc.Mining() {
+		t.Fatal("nothing mined")
+	}
+	loaded := newTestChain(t, alice)
+	if err := loaded.Load(path); err != nil {
+		t.Fatal(err)
+	}
+	if loaded.LastBlock().Hash() != bc.LastBlock().Hash() {
+		t.Fatal("autosaved chain is missing the mined block")
+	}
+}
+func TestLoadRejectsBrokenLink(t *testing.T) {
+	alice, bob := newTestWallet(t), newTestWallet(t)
+	bc := newTestChain(t, alice)
+	for i := 0; i < 3; i++ {
+		if err := addTransaction(bc, signedTransaction(alice, bob, 1, 0.1, uint64(i))); err != nil {
+			t.Fatal(err)
+		}
+		if !bc.Mining() {
+			t.Fatal("nothing mined")
+		}
+	}
+	v := chainFile{Chain: decodedChain(t, bc)}
+	v.Chain[2].previousHash[0] ^= 1
+	v.Chain[2].invalidateHash()
+	path := filepath.Join(t.TempDir(), "chain.json")
+	if err := writeChainFile(path, &v); err != nil {
+		t.Fatal(err)
+	}
+	loaded := newTestChain(t, alice)
+	err := loaded.Load(path)
+	var chainErr *ChainError
+	if !errors.As(err, &chainErr) || chainErr.Height != 2 {
+		t.Fatalf("got %v, want an error at block 2", err)
+	}
+	if !strings.Contains(err.Error(), path) {
+		t.Fatalf("error %q does not name the file", err)
+	}
+	if len(loaded.Chain()) != 1 {
+		t.Fatal("broken chain loaded")
+	}
+}
+func TestExportImportChain(t *testing.T) {
+	alice, bob := newTestWallet(t), newTestWallet(t)
+	bc := newTestChain(t, alice)
+	for i := 0; i < 2; i++ {
+		if err := addTransaction(bc, signedTransaction(alice, bob, 1, 0.1, uint64(i))); err != nil {
+			t.Fatal(err)
+		}
+		if !bc.Mining() {
+			t.Fatal("nothing mined")
+		}
+	}
+	if err := addTransaction(bc, signedTransaction(alice, bob, 1, 0.1, 2)); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := bc.ExportChain(&buf); err != nil {
+		t.Fatal(err)
+	}
+	imported := newTestChain(t, alice)
+	if err := imported.ImportChain(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if imported.LastBlock().Hash() != bc.LastBlock().Hash() {
+		t.Fatal("imported chain differs")
+	}
+	if got := len(imported.TransactionPool()); got != 1 {
+		t.Fatalf("imported %d pooled transactions, want 1", got)
+	}
+	if got, want := imported.Balance(bob.BlockchainAddress()), bc.Balance(bob.BlockchainAddress()); got != want {
+		t.Fatalf("imported balance %v, want %v", got, want)
+	}
+}
+
+// snapshotOf exports bc and decodes the snapshot for a test to change.
+func snapshotOf(t *testing.T, bc *Blockchain) map[string]any {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := bc.ExportChain(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var v map[string]any
+	d := json.NewDecoder(&buf)
+	d.UseNumber()
+	if err := d.Decode(&v); err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+func TestImportChainRejected(t *testing.T) {
+	alice, bob := newTestWallet(t), newTestWallet(t)
+	bc := newTestChain(t, alice)
+	for i := 0; i < 2; i++ {
+		if err := addTransaction(bc, signedTransaction(alice, bob, 1, 0.1, uint64(i))); err != nil {
+			t.Fatal(err)
+		}
+		if !bc.Mining() {
+			t.Fatal("nothing mined")
+		}
+	}
+	for name, c := range map[string]struct {
+		tamper func(v map[string]any)
+		want   string
+	}{
+		"no version":    {func(v map[string]any) { delete(v, "version") }, "unsupported snapshot version"},
+		"newer version": {func(v map[string]any) { v["version"] = SnapshotVersion + 1 }, "unsupported snapshot version"},
+		"network":       {func(v map[string]any) { v["network_id"] = "testnet" }, `from network "testnet"`},
+		"invalid chain": {func(v map[string]any) {
+			b := v["chain"].([]any)[2].(map[string]any)
+			b["previous_hash"] = strings.Repeat("00", 32)
+		}, "block 2"},
+	} {
+		v := snapshotOf(t, bc)
+		c.tamper(v)
+		data, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fresh := newTestChain(t, alice)
+		if err := fresh.ImportChain(bytes.NewReader(data)); err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("%s: got %v, want %q", name, err, c.want)
+		}
+		if len(fresh.Chain()) != 1 {
+			t.Errorf("%s: chain replaced", name)
+		}
+	}
+}
+func TestImportPrunedSnapshot(t *testing.T) {
+	alice, bob := newTestWallet(t), newTestWallet(t)
+	bc, _ := newPrunedChain(t, alice, bob)
+	v := snapshotOf(t, bc)
+	// Forged balances in the exported index must not be believed.
+	v["pruned"].(map[string]any)["balances"].(map[string]any)[bob.BlockchainAddress()] = 1000
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fresh := newTestChain(t, alice)
+	fresh.SetCoinbaseMaturity(2)
+	if err := fresh.ImportChain(bytes.NewReader(data)); err == nil {
+		t.Fatal("pruned snapshot imported onto a node without its blocks")
+	}
+	if len(fresh.Chain()) != 1 {
+		t.Fatal("chain replaced")
+	}
+	// A node restoring its own backup already has the pruned blocks.
+	want := bc.Balance(bob.BlockchainAddress())
+	if err := bc.ImportChain(bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	if got := bc.Balance(bob.BlockchainAddress()); got != want {
+		t.Fatalf("balance %v after import, want %v", got, want)
+	}
+}
@@ -0,0 +1,249 @@
+package block
+
+import (
+	"encoding/json"
+	"errors"
+	"goblockchain/wallet"
+	"testing"
+	"time"
+)
+
+func lockedTransaction(from, to *wallet.Wallet, value, fee float32, locktime int64, sequence uint64) *Transaction {
+	wt := wallet.NewTransaction(from.PrivateKey(), from.PublicKey(), from.BlockchainAddress(), to.BlockchainAddress(), value, fee, locktime, sequence)
+	t := NewTransaction(from.BlockchainAddress(), to.BlockchainAddress(), value, fee, locktime, sequence)
+	t.senderPublicKey = from.PublicKey()
+	t.signature = wt.GenerateSignature()
+	return t
+}
+func contains(b *Block, t *Transaction) bool {
+	for _, mined := range b.Transactions() {
+		if mined.Hash() == t.Hash() {
+			return true
+		}
+	}
+	return false
+}
+func TestHeightLockedTransaction(t *testing.T) {
+	alice, bob := newTestWallet(t), newTestWallet(t)
+	bc := newTestChain(t, alice, bob)
+	locked := lockedTransaction(alice, bob, 1, 0.1, 2, 0)
+	if err := addTransaction(bc, locked); err != nil {
+		t.Fatal(err)
+	}
+	if bc.Mining() {
+		t.Fatal("mined a block of only locked transactions")
+	}
+	if err := addTransaction(bc, signedTransaction(bob, alice, 1, 0.1, 0)); err != nil {
+		t.Fatal(err)
+	}
+	if !bc.Mining() {
+		t.Fatal("nothing mined")
+	}
+	if contains(bc.LastBlock(), locked) {
+		t.Fatal("locked transaction mined at height 1")
+	}
+	if n := len(bc.TransactionPool()); n != 1 {
+		t.Fatalf("%d pooled transactions, want the locked one", n)
+	}
+	if !bc.Mining() {
+		t.Fatal("nothing mined at the locktime height")
+	}
+	if !contains(bc.LastBlock(), locked) {
+		t.Fatal("locked transaction not mined at its height")
+	}
+}
+func TestIsFinal(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	for _, c := range []struct {
+		locktime int64
+		height   int
+		want     bool
+	}{
+		{0, 0, true},
+		{5, 4, false},
+		{5, 5, true},
+		{now.Unix() + 1, 1 << 30, false},
+		{now.Unix(), 0, true},
+	} {
+		tx := NewTransaction("a", "b", 1, 0, c.locktime, 0)
+		if got := tx.IsFinal(c.height, now); got != c.want {
+			t.Errorf("locktime %d at height %d: IsFinal %v, want %v", c.locktime, c.height, got, c.want)
+		}
+	}
+}
+func TestLocktimeIsSigned(t *testing.T) {
+	alice, bob := newTestWallet(t), newTestWallet(t)
+	bc := newTestChain(t, alice)
+	tx := lockedTransaction(alice, bob, 1, 0.1, 100, 0)
+	tx.locktime = 0
+	if err := addTransaction(bc, tx); err == nil {
+		t.Fatal("accepted a transaction whose locktime was changed after signing")
+	}
+}
+func TestPayloadMatchesWallet(t *testing.T) {
+	alice, bob := newTestWallet(t), newTestWallet(t)
+	for _, sequence := range []uint64{0, 3} {
+		wt := wallet.NewTransaction(alice.PrivateKey(), alice.PublicKey(), alice.BlockchainAddress(), bob.BlockchainAddress(), 1.5, 0.1, 0, sequence)
+		m, err := json.Marshal(wt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tx := NewTransaction(alice.BlockchainAddress(), bob.BlockchainAddress(), 1.5, 0.1, 0, sequence)
+		if string(tx.payload()) != string(m) {
+			t.Fatalf("payload %s, wallet signs %s", tx.payload(), m)
+		}
+	}
+	one := NewTransaction(alice.BlockchainAddress(), bob.BlockchainAddress(), 1, 0, 0, 0)
+	two := NewTransaction(alice.BlockchainAddress(), bob.BlockchainAddress(), 2, 0, 0, 0)
+	if one.Hash() == two.Hash() {
+		t.Fatal("transactions with different values hash the same")
+	}
+}
+func TestFeesPayTheMiner(t *testing.T) {
+	alice, bob, carol := newTestWallet(t), newTestWallet(t), newTestWallet(t)
+	bc := newTestChain(t, alice, bob)
+	for _, tx := range []*Transaction{
+		signedTransaction(alice, bob, 10, 0.5, 0),
+		signedTransaction(bob, carol, 5, 0.25, 0),
+	} {
+		if err := addTransaction(bc, tx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !bc.Mining() {
+		t.Fatal("nothing mined")
+	}
+	var coinbase *Transaction
+	for _, tx := range bc.LastBlock().Transactions() {
+		if tx.senderBlockchainAddress == MiningSender {
+			coinbase = tx
+		}
+	}
+	if coinbase == nil {
+		t.Fatal("no coinbase")
+	}
+	if want := bc.BlockReward(1) + 0.75; coinbase.value != want {
+		t.Fatalf("coinbase %v, want reward plus fees %v", coinbase.value, want)
+	}
+	for _, c := range []struct {
+		w    string
+		want float32
+	}{
+		{alice.BlockchainAddress(), 89.5},
+		{bob.BlockchainAddress(), 104.75},
+		{carol.BlockchainAddress(), 5},
+	} {
+		if got := bc.CalculateTotalAmount(c.w); got != c.want {
+			t.Errorf("%s: total amount %v, want %v", c.w, got, c.want)
+		}
+		if got := bc.Balance(c.w); got != c.want {
+			t.Errorf("%s: balance %v, want %v", c.w, got, c.want)
+		}
+	}
+}
+func TestNegativeFeeRejected(t *testing.T) {
+	alice, bob := newTestWallet(t), newTestWallet(t)
+	bc := newTestChain(t, alice)
+	if err := addTransaction(bc, signedTransaction(alice, bob, 1, -0.5, 0)); !errors.Is(err, ErrNegativeFee) {
+		t.Fatalf("got %v, want %v", err, ErrNegativeFee)
+	}
+}
+func TestInvalidRecipientRejected(t *testing.T) {
+	alice, bob := newTestWallet(t), newTestWallet(t)
+	bc := newTestChain(t, alice)
+	// Change the last character, as a typo would; the checksum catches it.
+	address := []byte(bob.BlockchainAddress())
+	if address[len(address)-1] == '2' {
+		address[len(address)-1] = '3'
+	} else {
+		address[len(address)-1] = '2'
+	}
+	typo := string(address)
+	wt := wallet.NewTransaction(alice.PrivateKey(), alice.PublicKey(), alice.BlockchainAddress(), typo, 1, 0.1, 0, 0)
+	tx := NewTransaction(alice.BlockchainAddress(), typo, 1, 0.1, 0, 0)
+	if err := bc.AddTransaction(tx, alice.PublicKey(), wt.GenerateSignature()); !errors.Is(err, ErrInvalidRecipient) {
+		t.Fatalf("got %v, want %v", err, ErrInvalidRecipient)
+	}
+	r := transactionRequest(signedTransaction(alice, bob, 1, 0.1, 0))
+	if !r.Validate() {
+		t.Fatal("valid request rejected")
+	}
+	r.RecipientBlockchainAddress = &typo
+	if r.Validate() {
+		t.Fatal("request to a mistyped address accepted")
+	}
+}
+func TestBlockRewardHalving(t *testing.T) {
+	bc := NewBlockchain(testMiner, 5000, "")
+	bc.SetHalvingInterval(10)
+	for _, c := range []struct {
+		height int
+		want   float32
+	}{
+		{0, MiningReward},
+		{9, MiningReward},
+		{10, MiningReward / 2},
+		{19, MiningReward / 2},
+		{20, MiningReward / 4},
+		{630, MiningReward / float32(uint64(1)<<63)},
+		{640, 0},
+		{1 << 30, 0},
+	} {
+		if got := bc.BlockReward(c.height); got != c.want {
+			t.Errorf("height %d: reward %v, want %v", c.height, got, c.want)
+		}
+	}
+}
+func TestMiningPaysHalvedReward(t *testing.T) {
+	alice, bob := newTestWallet(t), newTestWallet(t)
+	bc := newTestChain(t, alice)
+	bc.SetHalvingInterval(2)
+	for i := 0; i < 3; i++ {
+		if err := addTransaction(bc, signedTransaction(alice, bob, 1, 0, uint64(i))); err != nil {
+			t.Fatal(err)
+		}
+		if !bc.Mining() {
+			t.Fatal("nothing mined")
+		}
+		b := bc.LastBlock()
+		for _, tx := range b.Transactions() {
+			if tx.senderBlockchainAddress == MiningSender && tx.value != bc.BlockReward(b.Height()) {
+				t.Fatalf("height %d: coinbase %v, want %v", b.Height(), tx.value, bc.BlockReward(b.Height()))
+			}
+		}
+	}
+	if bc.BlockReward(2) != MiningReward/2 {
+		t.Fatal("reward at height 2 not halved")
+	}
+}
+func TestCoinbaseMaturity(t *testing.T) {
+	miner, alice, bob := newTestWallet(t), newTestWallet(t), newTestWallet(t)
+	bc := NewBlockchainWithGenesis(miner.BlockchainAddress(), 5000, "", GenesisConfig{
+		Allocations: map[string]float32{alice.BlockchainAddress(): 100},
+	})
+	bc.SetCoinbaseMaturity(3)
+	mine := func(sequence uint64) {
+		t.Helper()
+		if err := addTransaction(bc, signedTransaction(alice, bob, 1, 0, sequence)); err != nil {
+			t.Fatal(err)
+		}
+		if !bc.Mining() {
+			t.Fatal("nothing mined")
+		}
+	}
+	mine(0)
+	if got := bc.CalculateTotalAmount(miner.BlockchainAddress()); got != 0 {
+		t.Fatalf("immature reward counted: %v", got)
+	}
+	if err := addTransaction(bc, signedTransaction(miner, bob, 0.5, 0, 0)); !errors.Is(err, ErrInsufficientBalance) {
+		t.Fatalf("spend at height+1: got %v, want %v", err, ErrInsufficientBalance)
+	}
+	mine(1)
+	mine(2)
+	if got := bc.CalculateTotalAmount(miner.BlockchainAddress()); got != bc.BlockReward(1) {
+		t.Fatalf("matured balance %v, want the first reward %v", got, bc.BlockReward(1))
+	}
+	if err := addTransaction(bc, signedTransaction(miner, bob, 0.5, 0, 0)); err != nil {
+		t.Fatalf("spend after maturity: %v", err)
+	}
+}
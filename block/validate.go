@@ -0,0 +1,98 @@
+package block
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ChainError reports the first block of a chain that failed validation.
+type ChainError struct {
+	Height int
+	Err    error
+}
+
+func (e *ChainError) Error() string {
+	return fmt.Sprintf("block %d: %v", e.Height, e.Err)
+}
+func (e *ChainError) Unwrap() error {
+	return e.Err
+}
+
+// Validate checks the whole local chain: genesis, linkage, timestamps,
+// difficulty and proof of work of every block, and that no block lets an
+// address spend more than it had. The error names the first bad block.
+func (bc *Blockchain) Validate() error {
+	return bc.validateChain(bc.Chain(), nil)
+}
+
+// SetBalanceCheck turns the balance replay in ValidChain on or off. It is on
+// by default, so a chain where someone spends more than they had is
+// rejected even if it is well linked and mined.
+func (bc *Blockchain) SetBalanceCheck(enabled bool) {
+	bc.balanceCheck = enabled
+}
+func (bc *Blockchain) validateChain(chain []*Block, saved *chainIndex) error {
+	if err := bc.checkChain(chain, saved); err != nil {
+		return err
+	}
+	return bc.checkBalances(chain, saved)
+}
+
+// checkCoinbase checks that a mined block has exactly one coinbase
+// transaction, committing to the block height and paying no more than the
+// block reward for that height plus the fees of its other transactions.
+func (bc *Blockchain) checkCoinbase(b *Block) error {
+	var coinbase *Transaction
+	var fees float32
+	for _, t := range b.transactions {
+		if t.senderBlockchainAddress != MiningSender {
+			fees += t.fee
+			continue
+		}
+		if coinbase != nil {
+			return errors.New("more than one coinbase transaction")
+		}
+		coinbase = t
+	}
+	if coinbase == nil {
+		return errors.New("no coinbase transaction")
+	}
+	if coinbase.sequence != uint64(b.height) {
+		return fmt.Errorf("coinbase commits to height %d, not %d", coinbase.sequence, b.height)
+	}
+	if allowed := bc.BlockReward(b.height) + fees; coinbase.value > allowed {
+		return fmt.Errorf("coinbase pays %.8f, more than the %.8f reward and fees", coinbase.value, allowed)
+	}
+	return nil
+}
+
+// checkBalances replays chain and fails at the first block after which an
+// address's balance is negative. Coinbase transactions create coins and
+// are not checked. Replay starts after the chain's pruned blocks, from the
+// balances they left.
+func (bc *Blockchain) checkBalances(chain []*Block, saved *chainIndex) error {
+	base, err := bc.prunedBase(chain, saved)
+	if err != nil {
+		return err
+	}
+	balances := make(map[string]float64, len(base.balances))
+	for address, balance := range base.balances {
+		balances[address] = balance
+	}
+	for height := base.height; height < len(chain); height++ {
+		b := chain[height]
+		for _, t := range b.transactions {
+			balances[t.recipientBlockchainAddress] += float64(t.value)
+			if t.senderBlockchainAddress != MiningSender {
+				balances[t.senderBlockchainAddress] -= float64(t.cost())
+			}
+		}
+		for _, t := range b.transactions {
+			// Allow for float32 rounding in the amounts.
+			if balance := balances[t.senderBlockchainAddress]; t.senderBlockchainAddress != MiningSender && balance < -1e-6 {
+				return &ChainError{height, fmt.Errorf("%s overspends, balance %.8f", t.senderBlockchainAddress, balance)}
+			}
+		}
+	}
+	return nil
+}
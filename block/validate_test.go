@@ -0,0 +1,288 @@
+package block
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCoinbaseIdsAreUnique(t *testing.T) {
+	alice, bob := newTestWallet(t), newTestWallet(t)
+	bc := newTestChain(t, alice)
+	ids := make(map[string]int)
+	for i := 0; i < 3; i++ {
+		if err := addTransaction(bc, signedTransaction(alice, bob, 1, 0.1, uint64(i))); err != nil {
+			t.Fatal(err)
+		}
+		if !bc.Mining() {
+			t.Fatal("nothing mined")
+		}
+		b := bc.LastBlock()
+		for _, tx := range b.Transactions() {
+			if tx.senderBlockchainAddress != MiningSender {
+				continue
+			}
+			if height, ok := ids[tx.TransactionId()]; ok {
+				t.Fatalf("coinbase at height %d reuses the id from height %d", b.Height(), height)
+			}
+			ids[tx.TransactionId()] = b.Height()
+			if _, height, _, ok := bc.GetTransaction(tx.TransactionId()); !ok || height != b.Height() {
+				t.Fatalf("coinbase found at height %d, want %d", height, b.Height())
+			}
+		}
+	}
+}
+func TestCheckCoinbaseHeight(t *testing.T) {
+	bc := newTestChain(t)
+	b := NewBlock(0, bc.LastBlock().Hash(), []*Transaction{newCoinbase(testMiner, MiningReward, 2)})
+	b.height = 1
+	err := bc.checkCoinbase(b)
+	if err == nil || !strings.Contains(err.Error(), "height") {
+		t.Fatalf("got %v, want a height error", err)
+	}
+	b.transactions[0] = newCoinbase(testMiner, MiningReward, 1)
+	if err := bc.checkCoinbase(b); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// decodedChain returns an independent copy of bc's chain.
+func decodedChain(t *testing.T, bc *Blockchain) []*Block {
+	t.Helper()
+	m, err := bc.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded Blockchain
+	if err := json.Unmarshal(m, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	return decoded.chain
+}
+func TestCheckGenesis(t *testing.T) {
+	alice, bob := newTestWallet(t), newTestWallet(t)
+	bc := newTestChain(t, alice)
+	if err := addTransaction(bc, signedTransaction(alice, bob, 1, 0.1, 0)); err != nil {
+		t.Fatal(err)
+	}
+	if !bc.Mining() {
+		t.Fatal("nothing mined")
+	}
+	if err := bc.checkChain(decodedChain(t, bc), nil); err != nil {
+		t.Fatalf("valid chain rejected: %v", err)
+	}
+	for name, tamper := range map[string]func(b *Block){
+		"nonce":         func(b *Block) { b.nonce = 1 },
+		"previous hash": func(b *Block) { b.previousHash[0] ^= 1 },
+		"allocation":    func(b *Block) { b.transactions[0].value++ },
+		"transactions": func(b *Block) {
+			b.transactions = append(b.transactions, NewTransaction(MiningSender, bob.BlockchainAddress(), 1, 0, 0, 0))
+		},
+	} {
+		chain := decodedChain(t, bc)
+		tamper(chain[0])
+		chain[0].invalidateHash()
+		var chainErr *ChainError
+		if err := bc.checkChain(chain, nil); !errors.As(err, &chainErr) || chainErr.Height != 0 {
+			t.Errorf("tampered %s: got %v, want an error at the genesis block", name, err)
+		}
+	}
+}
+func TestCheckTimestamps(t *testing.T) {
+	alice, bob := newTestWallet(t), newTestWallet(t)
+	bc := newTestChain(t, alice)
+	for i := 0; i < 2; i++ {
+		if err := addTransaction(bc, signedTransaction(alice, bob, 1, 0.1, uint64(i))); err != nil {
+			t.Fatal(err)
+		}
+		if !bc.Mining() {
+			t.Fatal("nothing mined")
+		}
+	}
+	chain := decodedChain(t, bc)
+	chain[2].timestamp = chain[1].timestamp
+	chain[2].invalidateHash()
+	if err := bc.checkChain(chain, nil); err == nil || !strings.Contains(err.Error(), "block 2: not newer") {
+		t.Fatalf("out of order block: got %v", err)
+	}
+	chain = decodedChain(t, bc)
+	now := time.Unix(0, chain[2].timestamp).Add(-MaxClockDrift - time.Minute)
+	bc.SetClock(func() time.Time { return now })
+	if err := bc.checkChain(chain, nil); err == nil || !strings.Contains(err.Error(), "too far in the future") {
+		t.Fatalf("future block: got %v", err)
+	}
+	now = now.Add(2 * time.Minute)
+	if err := bc.checkChain(chain, nil); err != nil {
+		t.Fatalf("block within the drift rejected: %v", err)
+	}
+}
+func TestBlockHeights(t *testing.T) {
+	alice, bob := newTestWallet(t), newTestWallet(t)
+	bc := newTestChain(t, alice)
+	for i := 0; i < 2; i++ {
+		if err := addTransaction(bc, signedTransaction(alice, bob, 1, 0.1, uint64(i))); err != nil {
+			t.Fatal(err)
+		}
+		if !bc.Mining() {
+			t.Fatal("nothing mined")
+		}
+	}
+	for i, b := range bc.Chain() {
+		if b.Height() != i {
+			t.Fatalf("block %d has height %d", i, b.Height())
+		}
+	}
+	chain := decodedChain(t, bc)
+	chain[2].height = 3
+	chain[2].invalidateHash()
+	if err := bc.checkChain(chain, nil); err == nil || !strings.Contains(err.Error(), "block 2: height 3 does not follow") {
+		t.Fatalf("skipped height: got %v", err)
+	}
+}
+func TestForeignNetworkRefused(t *testing.T) {
+	alice, bob := newTestWallet(t), newTestWallet(t)
+	allocations := map[string]float32{alice.BlockchainAddress(): 100}
+	bc := NewBlockchainWithGenesis(testMiner, 5000, "", GenesisConfig{NetworkID: "testnet", Allocations: allocations})
+	foreign := NewBlockchainWithGenesis(testMiner, 5000, "", GenesisConfig{NetworkID: "mainnet", Allocations: allocations})
+	if bc.LastBlock().Hash() == foreign.LastBlock().Hash() {
+		t.Fatal("genesis blocks of two networks are equal")
+	}
+	for i := 0; i < 3; i++ {
+		if err := addTransaction(foreign, signedTransaction(alice, bob, 1, 0.1, uint64(i))); err != nil {
+			t.Fatal(err)
+		}
+		if !foreign.Mining() {
+			t.Fatal("nothing mined")
+		}
+	}
+	chain := decodedChain(t, foreign)
+	if bc.ValidChain(chain) {
+		t.Fatal("chain of another network valid")
+	}
+	data, err := foreign.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	bc.neighbors = []string{servePeer(t, data)}
+	if bc.ResolveConflicts(context.Background()) {
+		t.Fatal("replaced by a longer chain of another network")
+	}
+	if err := bc.AcceptBlock(chain[1]); !errors.Is(err, ErrUnknownAncestor) {
+		t.Fatalf("block of another network: got %v, want %v", err, ErrUnknownAncestor)
+	}
+	if n := len(bc.Chain()); n != 1 {
+		t.Fatalf("chain has %d blocks, want only genesis", n)
+	}
+}
+func TestValidate(t *testing.T) {
+	alice, bob := newTestWallet(t), newTestWallet(t)
+	bc := newTestChain(t, alice)
+	for i := 0; i < 3; i++ {
+		if err := addTransaction(bc, signedTransaction(alice, bob, 1, 0.1, uint64(i))); err != nil {
+			t.Fatal(err)
+		}
+		if !bc.Mining() {
+			t.Fatal("nothing mined")
+		}
+	}
+	if err := bc.Validate(); err != nil {
+		t.Fatalf("valid chain: %v", err)
+	}
+	for name, tamper := range map[string]func(b *Block){
+		"previous hash": func(b *Block) { b.previousHash[5] ^= 1 },
+		"difficulty":    func(b *Block) { b.difficulty++ },
+		"timestamp":     func(b *Block) { b.timestamp = bc.Chain()[0].timestamp - 1 },
+	} {
+		chain := decodedChain(t, bc)
+		tamper(chain[2])
+		chain[2].invalidateHash()
+		var chainErr *ChainError
+		if err := bc.validateChain(chain, nil); !errors.As(err, &chainErr) || chainErr.Height != 2 {
+			t.Errorf("tampered %s: got %v, want an error at block 2", name, err)
+		}
+	}
+}
+
+// forgedBlock mines a block on top of bc holding transactions and a
+// coinbase, without the checks the pool would apply to them.
+func forgedBlock(t *testing.T, bc *Blockchain, transactions ...*Transaction) *Block {
+	t.Helper()
+	height := len(bc.Chain())
+	var fees float32
+	for _, tx := range transactions {
+		fees += tx.fee
+	}
+	transactions = append(transactions, newCoinbase(testMiner, bc.BlockReward(height)+fees, height))
+	b := bc.blockTemplate(height, bc.LastBlock().Hash(), transactions)
+	nonce, ok := bc.proofOfWork(context.Background(), *b.Header())
+	if !ok {
+		t.Fatal("no proof of work found")
+	}
+	b.nonce = nonce
+	b.invalidateHash()
+	return b
+}
+func TestOverspendingChainRejected(t *testing.T) {
+	alice, bob := newTestWallet(t), newTestWallet(t)
+	bc := newTestChain(t, alice)
+	clean := append(bc.Chain(), forgedBlock(t, bc, signedTransaction(alice, bob, 99, 0.5, 0)))
+	if !bc.ValidChain(clean) {
+		t.Fatal("clean chain rejected")
+	}
+	overspent := append(bc.Chain(), forgedBlock(t, bc, signedTransaction(alice, bob, 500, 0.1, 0)))
+	if bc.ValidChain(overspent) {
+		t.Fatal("chain with an overspend accepted")
+	}
+	var chainErr *ChainError
+	if err := bc.validateChain(overspent, nil); !errors.As(err, &chainErr) || chainErr.Height != 1 || !strings.Contains(err.Error(), "overspends") {
+		t.Fatalf("got %v, want an overspend at block 1", err)
+	}
+	bc.SetBalanceCheck(false)
+	if !bc.ValidChain(overspent) {
+		t.Fatal("overspend rejected with the balance check off")
+	}
+}
+func TestCoinbaseChecked(t *testing.T) {
+	alice, bob := newTestWallet(t), newTestWallet(t)
+	bc := newTestChain(t, alice)
+	transfer := signedTransaction(alice, bob, 1, 0.5, 0)
+	if !bc.ValidChain(append(bc.Chain(), forgedBlock(t, bc, transfer))) {
+		t.Fatal("block with one coinbase rejected")
+	}
+	mined := func(transactions ...*Transaction) []*Block {
+		b := bc.blockTemplate(1, bc.LastBlock().Hash(), transactions)
+		nonce, ok := bc.proofOfWork(context.Background(), *b.Header())
+		if !ok {
+			t.Fatal("no proof of work found")
+		}
+		b.nonce = nonce
+		b.invalidateHash()
+		return append(bc.Chain(), b)
+	}
+	reward := bc.BlockReward(1)
+	for name, c := range map[string]struct {
+		chain []*Block
+		want  string
+	}{
+		"two coinbases": {
+			mined(transfer, newCoinbase(testMiner, reward, 1), newCoinbase(bob.BlockchainAddress(), 0.5, 1)),
+			"more than one coinbase",
+		},
+		"inflated reward": {
+			mined(transfer, newCoinbase(testMiner, reward+0.5+1, 1)),
+			"more than the",
+		},
+		"no coinbase": {mined(transfer), "no coinbase"},
+	} {
+		if bc.ValidChain(c.chain) {
+			t.Errorf("%s: chain accepted", name)
+		}
+		var chainErr *ChainError
+		if err := bc.validateChain(c.chain, nil); !errors.As(err, &chainErr) || chainErr.Height != 1 || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("%s: got %v, want %q at block 1", name, err, c.want)
+		}
+	}
+}
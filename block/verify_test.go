@@ -0,0 +1,174 @@
+package block
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestProofCoversHeightAndTimestamp(t *testing.T) {
+	alice, bob := newTestWallet(t), newTestWallet(t)
+	bc := newTestChain(t, alice)
+	if err := addTransaction(bc, signedTransaction(alice, bob, 1, 0.1, 0)); err != nil {
+		t.Fatal(err)
+	}
+	if !bc.Mining() {
+		t.Fatal("nothing mined")
+	}
+	mined := bc.LastBlock()
+	if err := mined.Verify(mined.Difficulty()); err != nil {
+		t.Fatalf("mined block: %v", err)
+	}
+	for name, tamper := range map[string]func(b *Block){
+		"timestamp": func(b *Block) { b.timestamp++ },
+		"height":    func(b *Block) { b.height++ },
+	} {
+		b := NewBlock(mined.nonce, mined.previousHash, mined.transactions)
+		b.height, b.timestamp, b.difficulty = mined.height, mined.timestamp, mined.difficulty
+		// One header in 16^difficulty passes by chance; try a few tweaks.
+		valid := 0
+		for i := 0; i < 4; i++ {
+			tamper(b)
+			b.invalidateHash()
+			if b.Verify(b.difficulty) == nil {
+				valid++
+			}
+		}
+		if valid == 4 {
+			t.Errorf("changing the %s keeps the proof of work valid", name)
+		}
+	}
+}
+func TestProofOfWorkSalt(t *testing.T) {
+	alice, bob := newTestWallet(t), newTestWallet(t)
+	genesis := func(salt string) GenesisConfig {
+		return GenesisConfig{PowSalt: salt, Allocations: map[string]float32{alice.BlockchainAddress(): 100}}
+	}
+	a := NewBlockchainWithGenesis(testMiner, 5000, "", genesis("salt-a"))
+	if err := addTransaction(a, signedTransaction(alice, bob, 1, 0.1, 0)); err != nil {
+		t.Fatal(err)
+	}
+	if !a.Mining() {
+		t.Fatal("nothing mined")
+	}
+	mined := a.LastBlock()
+	if err := mined.VerifySalted(mined.Difficulty(), "salt-a"); err != nil {
+		t.Fatalf("under its own salt: %v", err)
+	}
+	if !a.ValidChain(a.Chain()) {
+		t.Fatal("chain invalid under its own salt")
+	}
+	// One header in 16^difficulty passes under any salt by chance.
+	passes := 0
+	for _, salt := range []string{"salt-b", "salt-c", "salt-d"} {
+		if mined.VerifySalted(mined.Difficulty(), salt) == nil {
+			passes++
+			continue
+		}
+		if NewBlockchainWithGenesis(testMiner, 5000, "", genesis(salt)).ValidChain(a.Chain()) {
+			t.Fatalf("chain mined under salt-a validates under %s", salt)
+		}
+	}
+	if passes == 3 {
+		t.Fatal("block mined under salt-a validates under every other salt")
+	}
+}
+func TestBlockVersion(t *testing.T) {
+	alice, bob := newTestWallet(t), newTestWallet(t)
+	bc := newTestChain(t, alice)
+	if err := addTransaction(bc, signedTransaction(alice, bob, 1, 0.1, 0)); err != nil {
+		t.Fatal(err)
+	}
+	bc.Mining()
+	mined := bc.LastBlock()
+	if mined.Version() != BlockVersion {
+		t.Fatalf("mined version %d, want %d", mined.Version(), BlockVersion)
+	}
+	if !bc.ValidChain(bc.Chain()) {
+		t.Fatal("current version chain rejected")
+	}
+	future := NewBlock(mined.nonce, mined.previousHash, mined.transactions)
+	future.height, future.timestamp, future.difficulty = mined.height, mined.timestamp, mined.difficulty
+	future.version = BlockVersion + 1
+	future.invalidateHash()
+	err := future.Verify(future.difficulty)
+	if err == nil || !strings.Contains(err.Error(), "unsupported block version") {
+		t.Fatalf("got %v, want an unsupported version error", err)
+	}
+	chain := append(bc.Chain()[:1:1], future)
+	if bc.ValidChain(chain) {
+		t.Fatal("chain with an unknown block version accepted")
+	}
+}
+func TestVerify(t *testing.T) {
+	alice, bob := newTestWallet(t), newTestWallet(t)
+	bc := newTestChain(t, alice)
+	if err := addTransaction(bc, signedTransaction(alice, bob, 1, 0.1, 0)); err != nil {
+		t.Fatal(err)
+	}
+	if !bc.Mining() {
+		t.Fatal("nothing mined")
+	}
+	if err := bc.LastBlock().Verify(bc.LastBlock().Difficulty()); err != nil {
+		t.Fatalf("valid block: %v", err)
+	}
+	for name, c := range map[string]struct {
+		tamper func(b *Block)
+		want   string
+	}{
+		"transaction": {func(b *Block) { b.transactions[0].value++ }, "merkle root does not match"},
+		"timestamp":   {func(b *Block) { b.timestamp = 0 }, "missing timestamp"},
+		"version":     {func(b *Block) { b.version = 0 }, "unsupported block version"},
+	} {
+		b := decodedChain(t, bc)[1]
+		c.tamper(b)
+		b.invalidateHash()
+		if err := b.Verify(b.difficulty); err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("tampered %s: got %v, want %q", name, err, c.want)
+		}
+	}
+	// One nonce in 16^difficulty passes by chance; step to one that fails.
+	b := decodedChain(t, bc)[1]
+	for i := 0; i < 100; i++ {
+		b.nonce++
+		b.invalidateHash()
+		if err := b.Verify(b.difficulty); err != nil {
+			if !strings.Contains(err.Error(), "proof of work does not meet") {
+				t.Fatalf("bad nonce: got %v, want a proof of work error", err)
+			}
+			return
+		}
+	}
+	t.Fatal("every nonce meets the difficulty")
+}
+func TestLegacyVersionRejected(t *testing.T) {
+	alice, bob := newTestWallet(t), newTestWallet(t)
+	bc := newTestChain(t, alice)
+	b := forgedBlock(t, bc, signedTransaction(alice, bob, 1, 0.1, 0))
+	b.version = 1
+	nonce, ok := bc.proofOfWork(context.Background(), *b.Header())
+	if !ok {
+		t.Fatal("no proof of work found")
+	}
+	b.nonce = nonce
+	b.timestamp++
+	b.invalidateHash()
+	// The legacy proof ignores the timestamp, so the block checks out alone.
+	if err := b.Verify(b.difficulty); err != nil {
+		t.Fatalf("legacy block: %v", err)
+	}
+	chain := append(bc.Chain(), b)
+	var chainErr *ChainError
+	if err := bc.validateChain(chain, nil); !errors.As(err, &chainErr) || chainErr.Height != 1 || !strings.Contains(err.Error(), "version 1") {
+		t.Fatalf("got %v, want a version error at block 1", err)
+	}
+	if err := bc.AcceptBlock(b); !errors.Is(err, ErrInvalidBlock) {
+		t.Fatalf("accepting a fresh version 1 block: got %v, want %v", err, ErrInvalidBlock)
+	}
+	// Blocks already in the chain keep validating.
+	bc.replaceChain(chain, nil)
+	if err := bc.Validate(); err != nil {
+		t.Fatalf("stored version 1 block: %v", err)
+	}
+}
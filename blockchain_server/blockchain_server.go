@@ -1,128 +1,560 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"goblockchain/block"
 	"goblockchain/utils"
 	"goblockchain/wallet"
 	"io"
-	"log"
+	"log/slog"
+	"net"
 	"net/http"
+	"net/url"
+	"os"
+	"sort"
 	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const NodeVersion = "0.1.0"
+
+const (
+	DefaultChainPageLimit = 50
+	MaxChainPageLimit     = 500
 )
 
 var cache = make(map[string]*block.Blockchain)
 
+// Error codes returned in the "code" field of failed responses.
+const (
+	ErrCodeInternal = iota + 1
+	ErrCodeMethodNotAllowed
+	ErrCodeMalformedRequest
+	ErrCodeInvalidFields
+	ErrCodeInvalidParameter
+	ErrCodeNotFound
+	ErrCodeInvalidPublicKey
+	ErrCodeInvalidSignature
+	ErrCodeInvalidRecipient
+	ErrCodeInsufficientBalance
+	ErrCodeDuplicateTransaction
+	ErrCodeMiningFailed
+	ErrCodeRateLimited
+	ErrCodeMempoolFull
+	ErrCodeInvalidBlock
+	ErrCodeBlockConflict
+	ErrCodeFaucetDisabled
+	ErrCodeInvalidAddress
+	ErrCodeInvalidSequence
+)
+
+var errMultipleTransactions = errors.New("multiple transactions in one request, submit them one at a time")
+
+const ShutdownTimeout = 5 * time.Second
+
+const DefaultBindAddress = "127.0.0.1"
+
 type BlockchainServer struct {
-	port uint16
+	bindAddress string
+	port        uint16
+	dataPath    string
+	logRequests bool
+	certFile    string
+	keyFile     string
+	cors        *CORSConfig
+	started     time.Time
+	metrics     http.Handler
+	metricsOnce sync.Once
+	txLimiter   *ipRateLimiter
+	genesis     block.GenesisConfig
+	faucet      float32
+	minerWallet *wallet.Wallet
+	prune       int
+	server      *http.Server
+	ctx         context.Context
+	mux         sync.Mutex
+	resolving   atomic.Bool
+}
+
+func NewBlockchainServer(bindAddress string, port uint16, dataPath string) *BlockchainServer {
+	if bindAddress == "" {
+		bindAddress = DefaultBindAddress
+	}
+	return &BlockchainServer{
+		bindAddress: bindAddress,
+		port:        port,
+		dataPath:    dataPath,
+		logRequests: true,
+		started:     time.Now(),
+		txLimiter:   newIPRateLimiter(DefaultTransactionRate, DefaultTransactionBurst),
+	}
+}
+func (bcs *BlockchainServer) SetRequestLogging(enabled bool) {
+	bcs.logRequests = enabled
+}
+
+// SetTLS makes Run serve HTTPS with the given certificate and key files.
+// With either path empty the server stays on plain HTTP.
+func (bcs *BlockchainServer) SetTLS(certFile string, keyFile string) {
+	bcs.certFile = certFile
+	bcs.keyFile = keyFile
+}
+
+// SetCORS applies the given CORS policy to every route. A nil config, the
+// default, sets no CORS headers.
+func (bcs *BlockchainServer) SetCORS(c *CORSConfig) {
+	bcs.cors = c
+}
+
+// SetTransactionRateLimit caps how many transactions each client IP may POST,
+// refilling perSecond tokens up to burst.
+func (bcs *BlockchainServer) SetTransactionRateLimit(perSecond float64, burst int) {
+	bcs.txLimiter = newIPRateLimiter(perSecond, burst)
+}
+
+// SetNetworkID selects the network the node joins. It must be called before
+// the blockchain is first used.
+func (bcs *BlockchainServer) SetNetworkID(networkID string) {
+	bcs.genesis.NetworkID = networkID
 }
 
-func NewBlockchainServer(port uint16) *BlockchainServer {
-	return &BlockchainServer{port}
+// SetMinerWallet sets the wallet mining rewards are paid to, and the faucet
+// pays from. By default a new wallet is made on start. It must be called
+// before the blockchain is first used.
+func (bcs *BlockchainServer) SetMinerWallet(w *wallet.Wallet) {
+	bcs.minerWallet = w
+}
+
+// SetPruning keeps the transactions of only the last keep blocks; see
+// block.Blockchain.SetPruning. Zero, the default, keeps every block.
+func (bcs *BlockchainServer) SetPruning(keep int) {
+	bcs.prune = keep
+}
+
+// SetGenesis replaces the whole genesis config, network id included. It
+// must be called before the blockchain is first used.
+func (bcs *BlockchainServer) SetGenesis(genesis block.GenesisConfig) {
+	bcs.genesis = genesis
+}
+func (bcs *BlockchainServer) tlsEnabled() bool {
+	return bcs.certFile != "" && bcs.keyFile != ""
+}
+func (bcs *BlockchainServer) scheme() string {
+	if bcs.tlsEnabled() {
+		return "https"
+	}
+	return block.DefaultScheme
+}
+
+// methodNotAllowed rejects a request whose method the handler does not
+// support, listing the methods it does in the Allow header.
+func methodNotAllowed(w http.ResponseWriter, allowed ...string) {
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+	writeError(w, http.StatusMethodNotAllowed, ErrCodeMethodNotAllowed, "Invalid HTTP Method")
+}
+func writeError(w http.ResponseWriter, status int, code int, reason string) {
+	if status >= http.StatusInternalServerError {
+		slog.Error("request failed", "status", status, "code", code, "reason", reason)
+	} else {
+		slog.Warn("request rejected", "status", status, "code", code, "reason", reason)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	io.WriteString(w, string(utils.JsonError(code, reason)))
+}
+func transactionErrorCode(err error) int {
+	switch err {
+	case block.ErrDuplicateTransaction:
+		return ErrCodeDuplicateTransaction
+	case block.ErrNegativeFee:
+		return ErrCodeInvalidFields
+	case block.ErrInvalidRecipient:
+		return ErrCodeInvalidRecipient
+	case block.ErrInvalidSignature:
+		return ErrCodeInvalidSignature
+	case block.ErrInsufficientBalance:
+		return ErrCodeInsufficientBalance
+	case block.ErrMempoolFull:
+		return ErrCodeMempoolFull
+	case block.ErrReplayedTransaction, block.ErrSequenceGap:
+		return ErrCodeInvalidSequence
+	case block.ErrCoinbaseTransaction:
+		return ErrCodeInvalidFields
+	default:
+		return ErrCodeInternal
+	}
 }
 func (bcs *BlockchainServer) Port() uint16 {
 	return bcs.port
 }
+
+// Addr is the host:port the server listens on.
+func (bcs *BlockchainServer) Addr() string {
+	return net.JoinHostPort(bcs.bindAddress, strconv.Itoa(int(bcs.Port())))
+}
 func (bcs *BlockchainServer) GetBlockchain() *block.Blockchain {
 	bc, ok := cache["blockchain"]
 	if !ok {
-		minersWallet := wallet.NewWallet()
-		bc = block.NewBlockchain(minersWallet.BlockchainAddress(), bcs.Port())
+		minersWallet := bcs.minerWallet
+		if minersWallet == nil {
+			var err error
+			if minersWallet, err = wallet.NewWallet(); err != nil {
+				slog.Error("creating miner wallet failed", "error", err)
+				os.Exit(1)
+			}
+		}
+		bc = block.NewBlockchainWithGenesis(minersWallet.BlockchainAddress(), bcs.Port(), bcs.scheme(), bcs.genesis)
+		if bcs.dataPath != "" {
+			if _, err := os.Stat(bcs.dataPath); err == nil {
+				if err := bc.Load(bcs.dataPath); err != nil {
+					slog.Error("loading chain failed", "error", err)
+					os.Exit(1)
+				}
+				slog.Info("chain loaded", "blocks", len(bc.Chain()), "path", bcs.dataPath)
+			}
+			bc.SetAutosave(bcs.dataPath)
+		}
+		bc.SetPruning(bcs.prune)
 		cache["blockchain"] = bc
-		log.Printf("private_key %v", minersWallet.PrivateKeyStr())
-		log.Printf("public_key %v", minersWallet.PublicKeyStr())
-		log.Printf("blockchain_address %v", minersWallet.BlockchainAddress())
+		bcs.minerWallet = minersWallet
+		slog.Info("miner wallet", "blockchain_address", minersWallet.BlockchainAddress())
+		slog.Debug("miner wallet keys", "public_key", minersWallet.PublicKeyStr(), "private_key", minersWallet.PrivateKeyStr())
 	}
 	return bc
 }
+func (bcs *BlockchainServer) NodeInfo(w http.ResponseWriter, req *http.Request) {
+	if req.URL.Path != "/" {
+		http.NotFound(w, req)
+		return
+	}
+	switch req.Method {
+	case http.MethodGet:
+		endpoints := make([]string, 0)
+		for pattern := range bcs.routes() {
+			endpoints = append(endpoints, pattern)
+		}
+		sort.Strings(endpoints)
+		m, _ := json.Marshal(struct {
+			Version   string   `json:"version"`
+			Height    int      `json:"height"`
+			Endpoints []string `json:"endpoints"`
+		}{
+			Version:   NodeVersion,
+			Height:    len(bcs.GetBlockchain().Chain()) - 1,
+			Endpoints: endpoints,
+		})
+		w.Header().Add("Content-Type", "application/json")
+		io.WriteString(w, string(m[:]))
+	default:
+		methodNotAllowed(w, http.MethodGet)
+	}
+}
+
+// Info is the handshake neighbors call before syncing with us.
+func (bcs *BlockchainServer) Info(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		info := bcs.GetBlockchain().Info()
+		info.NodeVersion = NodeVersion
+		m, _ := json.Marshal(info)
+		w.Header().Add("Content-Type", "application/json")
+		io.WriteString(w, string(m[:]))
+	default:
+		methodNotAllowed(w, http.MethodGet)
+	}
+}
+
+// chainPage parses the optional offset and limit query parameters. paged is
+// false when neither is given, so peers fetching /chain still get it whole.
+func chainPage(q url.Values) (offset int, limit int, paged bool, err error) {
+	limit = DefaultChainPageLimit
+	if v := q.Get("offset"); v != "" {
+		paged = true
+		if offset, err = strconv.Atoi(v); err != nil || offset < 0 {
+			return 0, 0, true, fmt.Errorf("invalid offset %q", v)
+		}
+	}
+	if v := q.Get("limit"); v != "" {
+		paged = true
+		if limit, err = strconv.Atoi(v); err != nil || limit < 1 {
+			return 0, 0, true, fmt.Errorf("invalid limit %q", v)
+		}
+		if limit > MaxChainPageLimit {
+			limit = MaxChainPageLimit
+		}
+	}
+	return offset, limit, paged, nil
+}
 func (bcs *BlockchainServer) GetChain(w http.ResponseWriter, req *http.Request) {
 	switch req.Method {
 	case http.MethodGet:
+		q := req.URL.Query()
+		offset, limit, paged, err := chainPage(q)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, ErrCodeInvalidParameter, err.Error())
+			return
+		}
 		w.Header().Add("Content-Type", "application/json")
 		bc := bcs.GetBlockchain()
-		m, _ := bc.MarshalJSON()
+		chain := bc.Chain()
+		if paged {
+			start, end := offset, offset+limit
+			if start > len(chain) {
+				start = len(chain)
+			}
+			if end > len(chain) {
+				end = len(chain)
+			}
+			chain = chain[start:end]
+		}
+		var m []byte
+		if q.Get("headersOnly") == "true" {
+			headers := make([]*block.BlockHeader, 0, len(chain))
+			for _, b := range chain {
+				headers = append(headers, b.Header())
+			}
+			m, _ = json.Marshal(struct {
+				Headers []*block.BlockHeader `json:"headers"`
+			}{
+				Headers: headers,
+			})
+		} else if paged {
+			m, _ = json.Marshal(struct {
+				Chain  []*block.Block `json:"chain"`
+				Offset int            `json:"offset"`
+				Limit  int            `json:"limit"`
+				Height int            `json:"height"`
+			}{
+				Chain:  chain,
+				Offset: offset,
+				Limit:  limit,
+				Height: len(bc.Chain()) - 1,
+			})
+		} else {
+			m, _ = bc.MarshalJSON()
+		}
 		io.WriteString(w, string(m[:]))
 	default:
-		log.Printf("ERROR: Invalid HTTP Method")
+		methodNotAllowed(w, http.MethodGet)
 	}
 }
+func (bcs *BlockchainServer) GetBlock(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		bc := bcs.GetBlockchain()
+		var b *block.Block
+		var found bool
+		q := req.URL.Query()
+		if v := q.Get("height"); v != "" {
+			height, err := strconv.Atoi(v)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, ErrCodeInvalidParameter, fmt.Sprintf("invalid height %q", v))
+				return
+			}
+			b, found = bc.BlockByHeight(height)
+		} else if v := q.Get("hash"); v != "" {
+			b, found = bc.BlockByHash(strings.ToLower(v))
+		} else {
+			writeError(w, http.StatusBadRequest, ErrCodeInvalidParameter, "missing height or hash")
+			return
+		}
+		if !found {
+			writeError(w, http.StatusNotFound, ErrCodeNotFound, "block not found")
+			return
+		}
+		w.Header().Add("Content-Type", "application/json")
+		m, _ := b.MarshalJSON()
+		io.WriteString(w, string(m[:]))
+	case http.MethodPost:
+		// A block propagated by a neighbor.
+		var b block.Block
+		if err := json.NewDecoder(req.Body).Decode(&b); err != nil {
+			writeError(w, http.StatusBadRequest, ErrCodeMalformedRequest, err.Error())
+			return
+		}
+		bc := bcs.GetBlockchain()
+		switch err := bc.AcceptBlock(&b); err {
+		case nil:
+			w.Header().Add("Content-Type", "application/json")
+			w.WriteHeader(http.StatusCreated)
+			io.WriteString(w, string(utils.JsonStatus("success")))
+		case block.ErrUnknownAncestor:
+			// The block is held until its parent arrives. The sender may
+			// also be ahead of us or on another fork; catch up in the
+			// background.
+			bcs.resolveConflicts(bc)
+			w.Header().Add("Content-Type", "application/json")
+			w.WriteHeader(http.StatusAccepted)
+			io.WriteString(w, string(utils.JsonStatus("pending")))
+		case block.ErrStaleBlock:
+			writeError(w, http.StatusConflict, ErrCodeBlockConflict, err.Error())
+		default:
+			writeError(w, http.StatusBadRequest, ErrCodeInvalidBlock, err.Error())
+		}
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodPost)
+	}
+}
+func decodeTransactionRequest(r io.Reader) (*block.TransactionRequest, error) {
+	var raw json.RawMessage
+	if err := json.NewDecoder(r).Decode(&raw); err != nil {
+		return nil, err
+	}
+	var t *block.TransactionRequest
+	if trimmed := bytes.TrimSpace(raw); len(trimmed) > 0 && trimmed[0] == '[' {
+		var ts []*block.TransactionRequest
+		if err := json.Unmarshal(raw, &ts); err != nil {
+			return nil, err
+		}
+		if len(ts) > 1 {
+			return nil, errMultipleTransactions
+		}
+		if len(ts) == 1 {
+			t = ts[0]
+		}
+	} else if err := json.Unmarshal(raw, &t); err != nil {
+		return nil, err
+	}
+	if t == nil {
+		return nil, errors.New("empty transaction request")
+	}
+	return t, nil
+}
+func (bcs *BlockchainServer) submitTransaction(w http.ResponseWriter, req *http.Request, broadcast bool) {
+	t, err := decodeTransactionRequest(req.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeMalformedRequest, err.Error())
+		return
+	}
+	if !t.Validate() {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidFields, "missing or invalid field(s)")
+		return
+	}
+	publicKey, err := utils.PublicKeyFromString(*t.SenderPublicKey)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidPublicKey, "sender_public_key: "+err.Error())
+		return
+	}
+	signature, err := utils.SignatureFromString(*t.Signature)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidSignature, "signature: "+err.Error())
+		return
+	}
+	bc := bcs.GetBlockchain()
+	// Relaying outlives the request but not the node.
+	ctx := bcs.rootContext()
+	if broadcast {
+		err = bc.CreateTransaction(ctx, t.Transaction(), publicKey, signature)
+	} else {
+		// Gossip from a neighbor: pass it on to everyone but the sender.
+		err = bc.RelayTransaction(ctx, t.Transaction(), publicKey, signature, req.Header.Get(block.RelayFromHeader))
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, transactionErrorCode(err), err.Error())
+		return
+	}
+	w.Header().Add("Content-Type", "application/json")
+	if broadcast {
+		w.WriteHeader(http.StatusCreated)
+	}
+	io.WriteString(w, string(utils.JsonStatus("success")))
+}
 func (bcs *BlockchainServer) Transactions(w http.ResponseWriter, req *http.Request) {
 	switch req.Method {
 	case http.MethodGet:
+		if id := req.URL.Query().Get("id"); id != "" {
+			bcs.getTransaction(w, id)
+			return
+		}
 		w.Header().Add("Content-Type", "application/type")
 		bc := bcs.GetBlockchain()
 		transaction := bc.TransactionPool()
 		m, _ := json.Marshal(struct {
-			Transaction []*block.Transaction `json:"transaction"`
-			length      int                  `json:"length"`
+			Transactions []*block.Transaction `json:"transactions"`
+			Length       int                  `json:"length"`
 		}{
 			transaction,
 			len(transaction),
 		})
 		io.WriteString(w, string(m[:]))
 	case http.MethodPost:
-		decode := json.NewDecoder(req.Body)
-		var t *block.TransactionRequest
-		err := decode.Decode(&t)
-		if err != nil {
-			log.Printf("ERROR: %v", err)
-			io.WriteString(w, string(utils.JsonStatus("fail")))
-		}
-		if !t.Validate() {
-			log.Println("ERROR: missing field(s)")
-			io.WriteString(w, string(utils.JsonStatus("fail")))
-			return
-		}
-		publicKey := utils.PublicKeyFromString(*t.SenderPublicKey)
-		signature := utils.SignatureFromString(*t.Signature)
-		bc := bcs.GetBlockchain()
-		isCreate := bc.CreateTransaction(*t.SenderBlockchainAddress,
-			*t.RecipientBlockchainAddress, *t.Value, publicKey, signature)
-		w.Header().Add("Content-Type", "application/type")
-		var m []byte
-		if !isCreate {
-			w.WriteHeader(http.StatusBadRequest)
-			m = utils.JsonStatus("fail")
-		} else {
-			w.WriteHeader(http.StatusCreated)
-			m = utils.JsonStatus("success")
-		}
-		io.WriteString(w, string(m))
+		// New transactions from clients are relayed to our neighbors.
+		bcs.submitTransaction(w, req, true)
 	case http.MethodPut:
-		decode := json.NewDecoder(req.Body)
-		var t *block.TransactionRequest
-		err := decode.Decode(&t)
-		if err != nil {
-			log.Printf("ERROR: %v", err)
-			io.WriteString(w, string(utils.JsonStatus("fail")))
-		}
-		if !t.Validate() {
-			log.Println("ERROR: missing field(s)")
-			io.WriteString(w, string(utils.JsonStatus("fail")))
-			return
-		}
-		publicKey := utils.PublicKeyFromString(*t.SenderPublicKey)
-		signature := utils.SignatureFromString(*t.Signature)
+		bcs.submitTransaction(w, req, false)
+	case http.MethodDelete:
 		bc := bcs.GetBlockchain()
-		isUpdate := bc.AddTransaction(*t.SenderBlockchainAddress,
-			*t.RecipientBlockchainAddress, *t.Value, publicKey, signature)
-		w.Header().Add("Content-Type", "application/type")
-		var m []byte
-		if !isUpdate {
-			w.WriteHeader(http.StatusBadRequest)
-			m = utils.JsonStatus("fail")
+		if id := req.URL.Query().Get("id"); id != "" {
+			if !bc.RemoveTransaction(id) {
+				writeError(w, http.StatusNotFound, ErrCodeNotFound, "transaction not found")
+				return
+			}
 		} else {
-			m = utils.JsonStatus("success")
+			bc.ClearTransactionPool()
 		}
-		io.WriteString(w, string(m))
-	case http.MethodDelete:
-		bc := bcs.GetBlockchain()
-		bc.ClearTransactionPool()
 		io.WriteString(w, string(utils.JsonStatus("success")))
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodPost, http.MethodPut, http.MethodDelete)
+	}
+}
 
+// getTransaction writes a mined or pending transaction with its height and
+// confirmations.
+func (bcs *BlockchainServer) getTransaction(w http.ResponseWriter, id string) {
+	t, height, confirmations, ok := bcs.GetBlockchain().GetTransaction(id)
+	if !ok {
+		writeError(w, http.StatusNotFound, ErrCodeNotFound, "transaction not found")
+		return
+	}
+	status := block.StatusConfirmed
+	if height < 0 {
+		status = block.StatusPending
+	}
+	m, _ := json.Marshal(struct {
+		Transaction   *block.Transaction `json:"transaction"`
+		Height        int                `json:"height"`
+		Confirmations int                `json:"confirmations"`
+		Status        string             `json:"status"`
+	}{
+		Transaction:   t,
+		Height:        height,
+		Confirmations: confirmations,
+		Status:        status,
+	})
+	w.Header().Add("Content-Type", "application/json")
+	io.WriteString(w, string(m[:]))
+}
+func (bcs *BlockchainServer) AuditTransactions(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		results := bcs.GetBlockchain().AuditPool()
+		m, _ := json.Marshal(struct {
+			Transactions []block.PoolAuditResult `json:"transactions"`
+		}{
+			Transactions: results,
+		})
+		w.Header().Add("Content-Type", "application/json")
+		io.WriteString(w, string(m[:]))
+	case http.MethodDelete:
+		removed := bcs.GetBlockchain().PurgeInvalidPool()
+		m, _ := json.Marshal(struct {
+			Message string `json:"message"`
+			Removed int    `json:"removed"`
+		}{
+			Message: "success",
+			Removed: removed,
+		})
+		w.Header().Add("Content-Type", "application/json")
+		io.WriteString(w, string(m[:]))
 	default:
-		w.WriteHeader(http.StatusBadRequest)
-		log.Println("ERROR: Invalid HTTP Method")
+		methodNotAllowed(w, http.MethodGet, http.MethodDelete)
 	}
 }
 func (bcs *BlockchainServer) Mine(w http.ResponseWriter, req *http.Request) {
@@ -130,51 +562,445 @@ func (bcs *BlockchainServer) Mine(w http.ResponseWriter, req *http.Request) {
 	case http.MethodGet:
 		bc := bcs.GetBlockchain()
 		isMinde := bc.Mining()
-		var m []byte
 		if !isMinde {
-			w.WriteHeader(http.StatusBadRequest)
-			m = utils.JsonStatus("fail")
-		} else {
-			w.WriteHeader(http.StatusCreated)
-			m = utils.JsonStatus("success")
+			writeError(w, http.StatusBadRequest, ErrCodeMiningFailed, "nothing to mine or mining canceled")
+			return
 		}
-		io.WriteString(w, string(m))
+		w.WriteHeader(http.StatusCreated)
+		io.WriteString(w, string(utils.JsonStatus("success")))
 	default:
-		w.WriteHeader(http.StatusBadRequest)
-		log.Println("ERROR: Invalid HTTP Method")
+		methodNotAllowed(w, http.MethodGet)
 	}
 }
 func (bcs *BlockchainServer) StartMine(w http.ResponseWriter, req *http.Request) {
 	switch req.Method {
 	case http.MethodGet:
 		bc := bcs.GetBlockchain()
-		bc.StartMining()
+		bc.StartMining(bcs.rootContext())
 		var m []byte
 		w.WriteHeader(http.StatusCreated)
 		m = utils.JsonStatus("success")
 		io.WriteString(w, string(m))
 	default:
-		w.WriteHeader(http.StatusBadRequest)
-		log.Println("ERROR: Invalid HTTP Method")
+		methodNotAllowed(w, http.MethodGet)
 	}
 }
 func (bcs *BlockchainServer) Amount(w http.ResponseWriter, req *http.Request) {
 	switch req.Method {
 	case http.MethodGet:
 		blockchainAddress := req.URL.Query().Get("blockchain_address")
-		amount := bcs.GetBlockchain().CalculateTotalAmount(blockchainAddress)
+		if blockchainAddress == "" {
+			writeError(w, http.StatusBadRequest, ErrCodeInvalidParameter, "missing blockchain_address")
+			return
+		}
+		if !utils.ValidateAddress(blockchainAddress) {
+			writeError(w, http.StatusBadRequest, ErrCodeInvalidAddress, fmt.Sprintf("invalid blockchain_address %q", blockchainAddress))
+			return
+		}
+		amount := bcs.GetBlockchain().Balance(blockchainAddress)
 		ar := &block.AmountResponse{Amount: amount}
 		m, _ := ar.MarshalJSON()
 		w.Header().Add("Content-Type", "application/json")
 		io.WriteString(w, string(m[:]))
+	default:
+		methodNotAllowed(w, http.MethodGet)
 	}
 }
-func (bcs *BlockchainServer) Run() {
-	bcs.GetBlockchain().Run()
-	http.HandleFunc("/", bcs.GetChain)
-	http.HandleFunc("/transactions", bcs.Transactions)
-	http.HandleFunc("/mind", bcs.Mine)
-	http.HandleFunc("/mind/start", bcs.StartMine)
-	http.HandleFunc("/amount", bcs.Amount)
-	log.Fatal(http.ListenAndServe("127.0.0.1:"+strconv.Itoa(int(bcs.Port())), nil))
+
+// Sequence returns the sequence the address's next transaction must carry.
+func (bcs *BlockchainServer) Sequence(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		blockchainAddress := req.URL.Query().Get("blockchain_address")
+		if !utils.ValidateAddress(blockchainAddress) {
+			writeError(w, http.StatusBadRequest, ErrCodeInvalidAddress, fmt.Sprintf("invalid blockchain_address %q", blockchainAddress))
+			return
+		}
+		m, _ := json.Marshal(struct {
+			Sequence uint64 `json:"sequence"`
+		}{
+			Sequence: bcs.GetBlockchain().NextSequence(blockchainAddress),
+		})
+		w.Header().Add("Content-Type", "application/json")
+		io.WriteString(w, string(m[:]))
+	default:
+		methodNotAllowed(w, http.MethodGet)
+	}
+}
+
+// Balances lists every address that has transacted and its balance, sorted
+// by address and paged with offset and limit like /chain.
+func (bcs *BlockchainServer) Balances(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		offset, limit, _, err := chainPage(req.URL.Query())
+		if err != nil {
+			writeError(w, http.StatusBadRequest, ErrCodeInvalidParameter, err.Error())
+			return
+		}
+		balances := bcs.GetBlockchain().AllBalances()
+		addresses := make([]string, 0, len(balances))
+		for address := range balances {
+			addresses = append(addresses, address)
+		}
+		sort.Strings(addresses)
+		start, end := offset, offset+limit
+		if start > len(addresses) {
+			start = len(addresses)
+		}
+		if end > len(addresses) {
+			end = len(addresses)
+		}
+		type addressBalance struct {
+			BlockchainAddress string  `json:"blockchain_address"`
+			Amount            float32 `json:"amount"`
+		}
+		page := make([]addressBalance, 0, end-start)
+		for _, address := range addresses[start:end] {
+			page = append(page, addressBalance{address, balances[address]})
+		}
+		m, _ := json.Marshal(struct {
+			Balances []addressBalance `json:"balances"`
+			Offset   int              `json:"offset"`
+			Limit    int              `json:"limit"`
+			Total    int              `json:"total"`
+		}{
+			Balances: page,
+			Offset:   offset,
+			Limit:    limit,
+			Total:    len(addresses),
+		})
+		w.Header().Add("Content-Type", "application/json")
+		io.WriteString(w, string(m[:]))
+	default:
+		methodNotAllowed(w, http.MethodGet)
+	}
+}
+
+// AddressTransactions serves GET /address/{addr}/transactions, the history
+// of an address paged with offset and limit like /chain.
+func (bcs *BlockchainServer) AddressTransactions(w http.ResponseWriter, req *http.Request) {
+	blockchainAddress, rest, _ := strings.Cut(strings.TrimPrefix(req.URL.Path, "/address/"), "/")
+	if rest != "transactions" {
+		writeError(w, http.StatusNotFound, ErrCodeNotFound, fmt.Sprintf("no route for %s", req.URL.Path))
+		return
+	}
+	switch req.Method {
+	case http.MethodGet:
+		if !utils.ValidateAddress(blockchainAddress) {
+			writeError(w, http.StatusBadRequest, ErrCodeInvalidAddress, fmt.Sprintf("invalid blockchain address %q", blockchainAddress))
+			return
+		}
+		offset, limit, _, err := chainPage(req.URL.Query())
+		if err != nil {
+			writeError(w, http.StatusBadRequest, ErrCodeInvalidParameter, err.Error())
+			return
+		}
+		history := bcs.GetBlockchain().TransactionsForAddress(blockchainAddress)
+		start, end := offset, offset+limit
+		if start > len(history) {
+			start = len(history)
+		}
+		if end > len(history) {
+			end = len(history)
+		}
+		m, _ := json.Marshal(struct {
+			Transactions []block.AddressTransaction `json:"transactions"`
+			Offset       int                        `json:"offset"`
+			Limit        int                        `json:"limit"`
+			Total        int                        `json:"total"`
+		}{
+			Transactions: history[start:end],
+			Offset:       offset,
+			Limit:        limit,
+			Total:        len(history),
+		})
+		w.Header().Add("Content-Type", "application/json")
+		io.WriteString(w, string(m[:]))
+	default:
+		methodNotAllowed(w, http.MethodGet)
+	}
+}
+func (bcs *BlockchainServer) EstimateFee(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		blocks := 1
+		if v := req.URL.Query().Get("blocks"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 {
+				writeError(w, http.StatusBadRequest, ErrCodeInvalidParameter, fmt.Sprintf("invalid blocks %q", v))
+				return
+			}
+			blocks = n
+		}
+		m, _ := json.Marshal(struct {
+			Blocks int     `json:"blocks"`
+			Fee    float32 `json:"fee"`
+		}{
+			Blocks: blocks,
+			Fee:    bcs.GetBlockchain().EstimateFee(blocks),
+		})
+		w.Header().Add("Content-Type", "application/json")
+		io.WriteString(w, string(m[:]))
+	default:
+		methodNotAllowed(w, http.MethodGet)
+	}
+}
+func (bcs *BlockchainServer) Stats(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		bc := bcs.GetBlockchain()
+		m, _ := json.Marshal(struct {
+			Height              int `json:"height"`
+			TransactionPoolSize int `json:"transaction_pool_size"`
+			SerializedSize      int `json:"serialized_size"`
+		}{
+			Height:              len(bc.Chain()) - 1,
+			TransactionPoolSize: len(bc.TransactionPool()),
+			SerializedSize:      bc.SerializedSize(),
+		})
+		w.Header().Add("Content-Type", "application/json")
+		io.WriteString(w, string(m[:]))
+	default:
+		methodNotAllowed(w, http.MethodGet)
+	}
+}
+func (bcs *BlockchainServer) Health(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		bc := bcs.GetBlockchain()
+		m, _ := json.Marshal(struct {
+			Status       string  `json:"status"`
+			UptimeSec    float64 `json:"uptime_sec"`
+			Height       int     `json:"height"`
+			Peers        int     `json:"peers"`
+			MiningActive bool    `json:"mining_active"`
+		}{
+			Status:       "ok",
+			UptimeSec:    time.Since(bcs.started).Seconds(),
+			Height:       len(bc.Chain()) - 1,
+			Peers:        len(bc.Neighbors()),
+			MiningActive: bc.MiningActive(),
+		})
+		w.Header().Add("Content-Type", "application/json")
+		io.WriteString(w, string(m[:]))
+	default:
+		methodNotAllowed(w, http.MethodGet)
+	}
+}
+
+// Ready answers 503 until the genesis block exists and the first neighbor
+// sync has run, so orchestrators hold traffic until then.
+func (bcs *BlockchainServer) Ready(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		bc := bcs.GetBlockchain()
+		ready := len(bc.Chain()) > 0 && bc.Synced()
+		w.Header().Add("Content-Type", "application/json")
+		if !ready {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			io.WriteString(w, string(utils.JsonStatus("not ready")))
+			return
+		}
+		io.WriteString(w, string(utils.JsonStatus("ready")))
+	default:
+		methodNotAllowed(w, http.MethodGet)
+	}
+}
+func (bcs *BlockchainServer) metricsHandler() http.Handler {
+	bcs.metricsOnce.Do(func() {
+		bcs.metrics = newMetricsHandler(bcs.GetBlockchain())
+	})
+	return bcs.metrics
+}
+func (bcs *BlockchainServer) Metrics(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		bcs.metricsHandler().ServeHTTP(w, req)
+	default:
+		methodNotAllowed(w, http.MethodGet)
+	}
+}
+func (bcs *BlockchainServer) Throughput(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		stats := bcs.GetBlockchain().Throughput()
+		m, _ := json.Marshal(stats)
+		w.Header().Add("Content-Type", "application/json")
+		io.WriteString(w, string(m[:]))
+	default:
+		methodNotAllowed(w, http.MethodGet)
+	}
+}
+func (bcs *BlockchainServer) Nodes(w http.ResponseWriter, req *http.Request) {
+	bc := bcs.GetBlockchain()
+	switch req.Method {
+	case http.MethodGet:
+		m, _ := json.Marshal(struct {
+			Nodes []string `json:"nodes"`
+		}{
+			Nodes: bc.Neighbors(),
+		})
+		w.Header().Add("Content-Type", "application/json")
+		io.WriteString(w, string(m[:]))
+	case http.MethodPost, http.MethodDelete:
+		var nr struct {
+			Address *string `json:"address"`
+		}
+		if err := json.NewDecoder(req.Body).Decode(&nr); err != nil || nr.Address == nil {
+			writeError(w, http.StatusBadRequest, ErrCodeInvalidFields, "missing node address")
+			return
+		}
+		if req.Method == http.MethodDelete {
+			if !bc.RemoveNeighbor(*nr.Address) {
+				writeError(w, http.StatusNotFound, ErrCodeNotFound, "node not found")
+				return
+			}
+			w.Header().Add("Content-Type", "application/json")
+			io.WriteString(w, string(utils.JsonStatus("success")))
+			return
+		}
+		if err := bc.RegisterNeighbor(*nr.Address); err != nil {
+			writeError(w, http.StatusBadRequest, ErrCodeInvalidParameter, err.Error())
+			return
+		}
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		io.WriteString(w, string(utils.JsonStatus("success")))
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodPost, http.MethodDelete)
+	}
+}
+func (bcs *BlockchainServer) Resolve(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		bc := bcs.GetBlockchain()
+		replaced := bc.ResolveConflicts(req.Context())
+		m, _ := json.Marshal(struct {
+			Replaced bool `json:"replaced"`
+			Length   int  `json:"length"`
+		}{
+			Replaced: replaced,
+			Length:   len(bc.Chain()),
+		})
+		w.Header().Add("Content-Type", "application/json")
+		io.WriteString(w, string(m[:]))
+	default:
+		methodNotAllowed(w, http.MethodGet)
+	}
+}
+func (bcs *BlockchainServer) routes() map[string]http.HandlerFunc {
+	return map[string]http.HandlerFunc{
+		"/":                   bcs.NodeInfo,
+		"/info":               bcs.Info,
+		"/chain":              bcs.GetChain,
+		"/block":              bcs.GetBlock,
+		"/transactions":       limitWrites(bcs.Transactions, bcs.txLimiter),
+		"/transactions/audit": bcs.AuditTransactions,
+		"/mind":               bcs.Mine,
+		"/mind/start":         bcs.StartMine,
+		"/amount":             bcs.Amount,
+		"/balances":           bcs.Balances,
+		"/sequence":           bcs.Sequence,
+		"/address/":           bcs.AddressTransactions,
+		"/stats":              bcs.Stats,
+		"/throughput":         bcs.Throughput,
+		"/fee/estimate":       bcs.EstimateFee,
+		"/nodes":              bcs.Nodes,
+		"/resolve":            bcs.Resolve,
+		"/health":             bcs.Health,
+		"/ready":              bcs.Ready,
+		"/metrics":            bcs.Metrics,
+		"/faucet":             limitWrites(bcs.Faucet, bcs.txLimiter),
+	}
+}
+func (bcs *BlockchainServer) Handler() http.Handler {
+	// Start collecting before the first scrape so early blocks are counted.
+	bcs.metricsHandler()
+	mux := http.NewServeMux()
+	for pattern, handler := range bcs.routes() {
+		mux.HandleFunc(pattern, handler)
+	}
+	var handler http.Handler = mux
+	if bcs.cors != nil {
+		handler = cors(handler, bcs.cors)
+	}
+	if bcs.logRequests {
+		handler = logRequests(handler)
+	}
+	return handler
+}
+
+// Run serves until Stop is called or ctx is done. Background work started
+// by the server, such as mining, ends with ctx too.
+func (bcs *BlockchainServer) Run(ctx context.Context) error {
+	bcs.mux.Lock()
+	bcs.ctx = ctx
+	bcs.mux.Unlock()
+	bcs.GetBlockchain().Run(ctx)
+	bcs.mux.Lock()
+	bcs.server = &http.Server{
+		Addr:    bcs.Addr(),
+		Handler: bcs.Handler(),
+	}
+	server := bcs.server
+	bcs.mux.Unlock()
+	shutdown := make(chan error, 1)
+	stop := context.AfterFunc(ctx, func() {
+		shutdown <- bcs.Stop()
+	})
+	var err error
+	if bcs.tlsEnabled() {
+		err = server.ListenAndServeTLS(bcs.certFile, bcs.keyFile)
+	} else {
+		err = server.ListenAndServe()
+	}
+	if err != http.ErrServerClosed {
+		stop()
+		return err
+	}
+	if stop() {
+		// Closed by a direct call to Stop.
+		return nil
+	}
+	return <-shutdown
+}
+
+// rootContext is the context passed to Run, for work that outlives the
+// request that started it.
+func (bcs *BlockchainServer) rootContext() context.Context {
+	bcs.mux.Lock()
+	defer bcs.mux.Unlock()
+	if bcs.ctx == nil {
+		return context.Background()
+	}
+	return bcs.ctx
+}
+
+// resolveConflicts runs ResolveConflicts in the background unless a run it
+// started is still going, so a burst of orphans fetches each neighbor's
+// chain once.
+func (bcs *BlockchainServer) resolveConflicts(bc *block.Blockchain) {
+	if !bcs.resolving.CompareAndSwap(false, true) {
+		return
+	}
+	go func() {
+		defer bcs.resolving.Store(false)
+		bc.ResolveConflicts(bcs.rootContext())
+	}()
+}
+
+// Stop shuts the HTTP server down, waiting up to ShutdownTimeout for
+// in-flight requests, and stops the blockchain's background loops.
+func (bcs *BlockchainServer) Stop() error {
+	bcs.GetBlockchain().Stop()
+	bcs.mux.Lock()
+	server := bcs.server
+	bcs.mux.Unlock()
+	if server == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), ShutdownTimeout)
+	defer cancel()
+	return server.Shutdown(ctx)
 }
@@ -0,0 +1,615 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"goblockchain/block"
+	"goblockchain/wallet"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRootServesNodeInfo(t *testing.T) {
+	bcs := newTestServer(t)
+	w := serve(bcs, http.MethodGet, "/", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d", w.Code)
+	}
+	var info struct {
+		Version   string   `json:"version"`
+		Height    *int     `json:"height"`
+		Endpoints []string `json:"endpoints"`
+		Chain     any      `json:"chain"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &info); err != nil {
+		t.Fatal(err)
+	}
+	if info.Version != NodeVersion || info.Height == nil || *info.Height != 0 || info.Chain != nil {
+		t.Fatalf("got %s", w.Body)
+	}
+	found := false
+	for _, e := range info.Endpoints {
+		found = found || e == "/chain"
+	}
+	if !found {
+		t.Fatalf("/chain missing from endpoints %v", info.Endpoints)
+	}
+	if w := serve(bcs, http.MethodGet, "/nothing-here", nil); w.Code != http.StatusNotFound {
+		t.Fatalf("unknown path: status %d", w.Code)
+	}
+}
+func TestChainServesFullChain(t *testing.T) {
+	bcs := newTestServer(t)
+	w := serve(bcs, http.MethodGet, "/chain", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d", w.Code)
+	}
+	var v struct {
+		Chain []json.RawMessage `json:"chain"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &v); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(v.Chain), len(bcs.GetBlockchain().Chain()); got != want {
+		t.Fatalf("%d blocks, want %d", got, want)
+	}
+}
+func TestChainHeadersOnly(t *testing.T) {
+	alice, bob := newTestWallet(t), newTestWallet(t)
+	bcs := newFundedServer(t, alice)
+	if w := serve(bcs, http.MethodPost, "/transactions", jsonBody(t, transactionRequest(alice, bob, 1, 0.1, 0))); w.Code != http.StatusCreated {
+		t.Fatalf("transaction: status %d: %s", w.Code, w.Body)
+	}
+	bc := bcs.GetBlockchain()
+	if !bc.Mining() {
+		t.Fatal("nothing mined")
+	}
+	w := serve(bcs, http.MethodGet, "/chain?headersOnly=true", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d", w.Code)
+	}
+	if strings.Contains(w.Body.String(), "transactions") {
+		t.Fatalf("headers carry transactions: %s", w.Body)
+	}
+	var v struct {
+		Headers []struct {
+			Version      int    `json:"version"`
+			Height       int    `json:"height"`
+			Timestamp    int64  `json:"timestamp"`
+			Nonce        int    `json:"nonce"`
+			Difficulty   int    `json:"difficulty"`
+			PreviousHash string `json:"previous_hash"`
+			MerkleRoot   string `json:"merkle_root"`
+		} `json:"headers"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &v); err != nil {
+		t.Fatal(err)
+	}
+	chain := bc.Chain()
+	if len(v.Headers) != len(chain) {
+		t.Fatalf("%d headers, want %d", len(v.Headers), len(chain))
+	}
+	for i, r := range v.Headers {
+		h := block.BlockHeader{
+			Version:    r.Version,
+			Height:     r.Height,
+			Timestamp:  r.Timestamp,
+			Nonce:      r.Nonce,
+			Difficulty: r.Difficulty,
+		}
+		previousHash, err := hex.DecodeString(r.PreviousHash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		merkleRoot, err := hex.DecodeString(r.MerkleRoot)
+		if err != nil {
+			t.Fatal(err)
+		}
+		copy(h.PreviousHash[:], previousHash)
+		copy(h.MerkleRoot[:], merkleRoot)
+		if h.Hash() != chain[i].Hash() {
+			t.Fatalf("header %d does not hash to its block", i)
+		}
+		if i > 0 && !bc.ValidProof(&h) {
+			t.Fatalf("header %d fails proof of work", i)
+		}
+	}
+}
+func TestGetBlock(t *testing.T) {
+	bcs := newTestServer(t)
+	genesis := bcs.GetBlockchain().Chain()[0]
+	hash := fmt.Sprintf("%x", genesis.Hash())
+	for _, target := range []string{"/block?height=0", "/block?hash=" + hash, "/block?hash=" + strings.ToUpper(hash)} {
+		w := serve(bcs, http.MethodGet, target, nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: status %d: %s", target, w.Code, w.Body)
+		}
+		var b block.Block
+		if err := json.Unmarshal(w.Body.Bytes(), &b); err != nil {
+			t.Fatal(err)
+		}
+		if b.Hash() != genesis.Hash() {
+			t.Fatalf("%s: got another block", target)
+		}
+	}
+	for target, want := range map[string]int{
+		"/block?height=1":                         http.StatusNotFound,
+		"/block?height=-1":                        http.StatusNotFound,
+		"/block?hash=" + strings.Repeat("00", 32): http.StatusNotFound,
+		"/block":            http.StatusBadRequest,
+		"/block?height=one": http.StatusBadRequest,
+	} {
+		if w := serve(bcs, http.MethodGet, target, nil); w.Code != want {
+			t.Errorf("%s: status %d, want %d: %s", target, w.Code, want, w.Body)
+		}
+	}
+}
+func TestMethodNotAllowed(t *testing.T) {
+	bcs := newTestServer(t)
+	for _, c := range []struct {
+		method, target, allow string
+	}{
+		{http.MethodPost, "/amount", "GET"},
+		{http.MethodDelete, "/mind", "GET"},
+		{http.MethodPut, "/chain", "GET"},
+		{http.MethodPatch, "/transactions", "GET, POST, PUT, DELETE"},
+	} {
+		w := serve(bcs, c.method, c.target, nil)
+		if w.Code != http.StatusMethodNotAllowed {
+			t.Errorf("%s %s: status %d", c.method, c.target, w.Code)
+			continue
+		}
+		if got := w.Header().Get("Allow"); got != c.allow {
+			t.Errorf("%s %s: Allow %q, want %q", c.method, c.target, got, c.allow)
+		}
+		var v struct {
+			Code int `json:"code"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &v); err != nil || v.Code != ErrCodeMethodNotAllowed {
+			t.Errorf("%s %s: body %s", c.method, c.target, w.Body)
+		}
+	}
+}
+func TestNodes(t *testing.T) {
+	bcs := newTestServer(t)
+	list := func() []string {
+		t.Helper()
+		w := serve(bcs, http.MethodGet, "/nodes", nil)
+		var v struct {
+			Nodes []string `json:"nodes"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &v); err != nil {
+			t.Fatal(err)
+		}
+		return v.Nodes
+	}
+	peer := `{"address":"10.0.0.1:5001"}`
+	for i := 0; i < 2; i++ {
+		if w := serve(bcs, http.MethodPost, "/nodes", strings.NewReader(peer)); w.Code != http.StatusCreated {
+			t.Fatalf("add: status %d: %s", w.Code, w.Body)
+		}
+	}
+	if nodes := list(); len(nodes) != 1 || nodes[0] != "10.0.0.1:5001" {
+		t.Fatalf("nodes %v, want the one added", nodes)
+	}
+	for _, body := range []string{`{"address":"10.0.0.1"}`, `{"address":"10.0.0.1:0"}`, `{"address":":5001"}`, `{}`} {
+		if w := serve(bcs, http.MethodPost, "/nodes", strings.NewReader(body)); w.Code != http.StatusBadRequest {
+			t.Errorf("add %s: status %d", body, w.Code)
+		}
+	}
+	if w := serve(bcs, http.MethodDelete, "/nodes", strings.NewReader(peer)); w.Code != http.StatusOK {
+		t.Fatalf("remove: status %d: %s", w.Code, w.Body)
+	}
+	if nodes := list(); len(nodes) != 0 {
+		t.Fatalf("nodes %v after removing, want none", nodes)
+	}
+	if w := serve(bcs, http.MethodDelete, "/nodes", strings.NewReader(peer)); w.Code != http.StatusNotFound {
+		t.Fatalf("remove again: status %d", w.Code)
+	}
+}
+func TestResolveAdoptsLongerChain(t *testing.T) {
+	alice, bob := newTestWallet(t), newTestWallet(t)
+	genesis := block.GenesisConfig{Allocations: map[string]float32{alice.BlockchainAddress(): 100}}
+	longer := block.NewBlockchainWithGenesis("miner", 5000, "", genesis)
+	for i := 0; i < 2; i++ {
+		signed := wallet.NewTransaction(alice.PrivateKey(), alice.PublicKey(), alice.BlockchainAddress(), bob.BlockchainAddress(), 1, 0.1, 0, uint64(i))
+		tx := block.NewTransaction(alice.BlockchainAddress(), bob.BlockchainAddress(), 1, 0.1, 0, uint64(i))
+		if err := longer.AddTransaction(tx, alice.PublicKey(), signed.GenerateSignature()); err != nil {
+			t.Fatal(err)
+		}
+		if !longer.Mining() {
+			t.Fatal("nothing mined")
+		}
+	}
+	data, err := longer.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	peer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write(data)
+	}))
+	defer peer.Close()
+	bcs := newTestServer(t)
+	bcs.SetGenesis(genesis)
+	address := strings.TrimPrefix(peer.URL, "http://")
+	if w := serve(bcs, http.MethodPost, "/nodes", strings.NewReader(`{"address":"`+address+`"}`)); w.Code != http.StatusCreated {
+		t.Fatalf("add peer: status %d: %s", w.Code, w.Body)
+	}
+	w := serve(bcs, http.MethodGet, "/resolve", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	var v struct {
+		Replaced bool `json:"replaced"`
+		Length   int  `json:"length"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &v); err != nil {
+		t.Fatal(err)
+	}
+	if !v.Replaced || v.Length != 3 {
+		t.Fatalf("got %s, want the 3 block chain adopted", w.Body)
+	}
+	if bcs.GetBlockchain().LastBlock().Hash() != longer.LastBlock().Hash() {
+		t.Fatal("adopted chain has another tip")
+	}
+	w = serve(bcs, http.MethodGet, "/resolve", nil)
+	if err := json.Unmarshal(w.Body.Bytes(), &v); err != nil {
+		t.Fatal(err)
+	}
+	if v.Replaced {
+		t.Fatal("replaced by an equal chain")
+	}
+}
+func TestChainPagination(t *testing.T) {
+	alice, bob := newTestWallet(t), newTestWallet(t)
+	bcs := newFundedServer(t, alice)
+	mineTransfers(t, bcs, alice, bob, 3)
+	type page struct {
+		Chain  []*block.Block `json:"chain"`
+		Offset int            `json:"offset"`
+		Limit  int            `json:"limit"`
+		Height int            `json:"height"`
+	}
+	get := func(target string) page {
+		t.Helper()
+		w := serve(bcs, http.MethodGet, target, nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: status %d: %s", target, w.Code, w.Body)
+		}
+		var p page
+		if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+	if p := get("/chain?offset=0"); len(p.Chain) != 4 || p.Limit != DefaultChainPageLimit || p.Height != 3 {
+		t.Fatalf("default page: %d blocks, limit %d, height %d", len(p.Chain), p.Limit, p.Height)
+	}
+	p := get("/chain?offset=1&limit=2")
+	if len(p.Chain) != 2 || p.Chain[0].Height() != 1 || p.Chain[1].Height() != 2 || p.Offset != 1 {
+		t.Fatalf("window: got %+v", p)
+	}
+	if p := get("/chain?offset=10"); len(p.Chain) != 0 || p.Height != 3 {
+		t.Fatalf("out of range: got %+v", p)
+	}
+	if p := get("/chain?limit=100000"); p.Limit != MaxChainPageLimit {
+		t.Fatalf("limit %d, want it capped at %d", p.Limit, MaxChainPageLimit)
+	}
+	for _, target := range []string{"/chain?offset=-1", "/chain?limit=0", "/chain?offset=x"} {
+		if w := serve(bcs, http.MethodGet, target, nil); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status %d", target, w.Code)
+		}
+	}
+}
+func TestAddr(t *testing.T) {
+	for _, c := range []struct {
+		bind string
+		port uint16
+		want string
+	}{
+		{"0.0.0.0", 5001, "0.0.0.0:5001"},
+		{"192.168.1.20", 8080, "192.168.1.20:8080"},
+		{"::1", 5000, "[::1]:5000"},
+		{"", 5000, DefaultBindAddress + ":5000"},
+	} {
+		if got := NewBlockchainServer(c.bind, c.port, "").Addr(); got != c.want {
+			t.Errorf("NewBlockchainServer(%q, %d).Addr() = %q, want %q", c.bind, c.port, got, c.want)
+		}
+	}
+}
+func TestHealth(t *testing.T) {
+	alice := newTestWallet(t)
+	bcs := newFundedServer(t, alice)
+	var health struct {
+		Status       string   `json:"status"`
+		UptimeSec    *float64 `json:"uptime_sec"`
+		Height       int      `json:"height"`
+		Peers        *int     `json:"peers"`
+		MiningActive bool     `json:"mining_active"`
+	}
+	get := func() {
+		t.Helper()
+		w := serve(bcs, http.MethodGet, "/health", nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("status %d", w.Code)
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &health); err != nil {
+			t.Fatal(err)
+		}
+		if health.Status != "ok" || health.UptimeSec == nil || *health.UptimeSec < 0 || health.Peers == nil {
+			t.Fatalf("health %s", w.Body)
+		}
+	}
+	get()
+	if health.Height != 0 || health.MiningActive || *health.Peers != 0 {
+		t.Fatalf("fresh node reports height %d, mining %v, %d peers", health.Height, health.MiningActive, *health.Peers)
+	}
+	mineTransfers(t, bcs, alice, newTestWallet(t), 1)
+	get()
+	if want := len(bcs.GetBlockchain().Chain()) - 1; health.Height != want {
+		t.Fatalf("height %d after mining, want %d", health.Height, want)
+	}
+	if w := serve(bcs, http.MethodPost, "/health", nil); w.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("POST status %d", w.Code)
+	}
+}
+func TestReady(t *testing.T) {
+	bcs := newTestServer(t)
+	if w := serve(bcs, http.MethodGet, "/ready", nil); w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status %d before the first neighbor sync, want 503", w.Code)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	bcs.GetBlockchain().StartSyncNeighbors(ctx)
+	w := serve(bcs, http.MethodGet, "/ready", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d after the first neighbor sync", w.Code)
+	}
+	if !strings.Contains(w.Body.String(), `"ready"`) {
+		t.Fatalf("body %s", w.Body)
+	}
+}
+func TestPostBlock(t *testing.T) {
+	alice, bob := newTestWallet(t), newTestWallet(t)
+	peer := peerChain(t, alice, bob, 3)
+	chain := peer.Chain()
+	bcs := newFundedServer(t, alice)
+	post := func(b *block.Block) *httptest.ResponseRecorder {
+		t.Helper()
+		return serve(bcs, http.MethodPost, "/block", jsonBody(t, b))
+	}
+	// A block extending our tip is appended.
+	if w := post(chain[1]); w.Code != http.StatusCreated {
+		t.Fatalf("extending block: status %d: %s", w.Code, w.Body)
+	}
+	bc := bcs.GetBlockchain()
+	if bc.LastBlock().Hash() != chain[1].Hash() {
+		t.Fatal("extending block not appended")
+	}
+	// One building on a block behind our tip conflicts.
+	w := post(chain[1])
+	if w.Code != http.StatusConflict {
+		t.Fatalf("stale block: status %d: %s", w.Code, w.Body)
+	}
+	if code := errorCode(t, w); code != ErrCodeBlockConflict {
+		t.Fatalf("stale block: error code %d, want %d", code, ErrCodeBlockConflict)
+	}
+	// A tampered block is rejected outright.
+	data, err := json.Marshal(chain[2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	tampered := strings.Replace(string(data), `"nonce":`, `"nonce":1`, 1)
+	if w := serve(bcs, http.MethodPost, "/block", strings.NewReader(tampered)); w.Code != http.StatusBadRequest {
+		t.Fatalf("tampered block: status %d: %s", w.Code, w.Body)
+	}
+	if len(bc.Chain()) != 2 {
+		t.Fatalf("chain has %d blocks after rejections, want 2", len(bc.Chain()))
+	}
+}
+func TestPostBlockUnknownAncestorResolves(t *testing.T) {
+	alice, bob := newTestWallet(t), newTestWallet(t)
+	peer := peerChain(t, alice, bob, 3)
+	data, err := peer.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write(data)
+	}))
+	defer server.Close()
+	bcs := newFundedServer(t, alice)
+	address := strings.TrimPrefix(server.URL, "http://")
+	if w := serve(bcs, http.MethodPost, "/nodes", strings.NewReader(`{"address":"`+address+`"}`)); w.Code != http.StatusCreated {
+		t.Fatalf("add peer: status %d: %s", w.Code, w.Body)
+	}
+	// The tip of a chain we have none of past genesis.
+	w := serve(bcs, http.MethodPost, "/block", jsonBody(t, peer.LastBlock()))
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	bc := bcs.GetBlockchain()
+	for deadline := time.Now().Add(5 * time.Second); bc.LastBlock().Hash() != peer.LastBlock().Hash(); time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("peer's chain not adopted, height %d", len(bc.Chain())-1)
+		}
+	}
+}
+func TestPostBlockOrphansResolveOnce(t *testing.T) {
+	alice, bob := newTestWallet(t), newTestWallet(t)
+	peer := peerChain(t, alice, bob, 3)
+	data, err := peer.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var mu sync.Mutex
+	fetches := 0
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/chain" {
+			json.NewEncoder(w).Encode(block.NodeInfo{ProtocolVersion: block.ProtocolVersion, NetworkID: block.DefaultNetworkID})
+			return
+		}
+		mu.Lock()
+		fetches++
+		mu.Unlock()
+		<-release
+		w.Write(data)
+	}))
+	defer server.Close()
+	bcs := newFundedServer(t, alice)
+	address := strings.TrimPrefix(server.URL, "http://")
+	if w := serve(bcs, http.MethodPost, "/nodes", strings.NewReader(`{"address":"`+address+`"}`)); w.Code != http.StatusCreated {
+		t.Fatalf("add peer: status %d: %s", w.Code, w.Body)
+	}
+	chain := peer.Chain()
+	// An orphan whose proof of work can't meet its difficulty is refused
+	// and not chased.
+	m, err := json.Marshal(chain[2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var junk map[string]any
+	if err := json.Unmarshal(m, &junk); err != nil {
+		t.Fatal(err)
+	}
+	junk["difficulty"] = 64
+	if w := serve(bcs, http.MethodPost, "/block", jsonBody(t, junk)); w.Code != http.StatusBadRequest {
+		t.Fatalf("junk orphan: status %d: %s", w.Code, w.Body)
+	}
+	for _, b := range []*block.Block{chain[3], chain[2]} {
+		if w := serve(bcs, http.MethodPost, "/block", jsonBody(t, b)); w.Code != http.StatusAccepted {
+			t.Fatalf("orphan: status %d: %s", w.Code, w.Body)
+		}
+	}
+	close(release)
+	bc := bcs.GetBlockchain()
+	for deadline := time.Now().Add(5 * time.Second); bc.LastBlock().Hash() != peer.LastBlock().Hash(); time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("peer's chain not adopted, height %d", len(bc.Chain())-1)
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if fetches != 1 {
+		t.Fatalf("neighbor's chain fetched %d times, want once", fetches)
+	}
+}
+func TestInfo(t *testing.T) {
+	bcs := newTestServer(t)
+	bcs.SetNetworkID("testnet")
+	w := serve(bcs, http.MethodGet, "/info", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d", w.Code)
+	}
+	var info block.NodeInfo
+	if err := json.Unmarshal(w.Body.Bytes(), &info); err != nil {
+		t.Fatal(err)
+	}
+	bc := bcs.GetBlockchain()
+	want := block.NodeInfo{
+		NodeVersion:       NodeVersion,
+		ProtocolVersion:   block.ProtocolVersion,
+		NetworkID:         "testnet",
+		Height:            len(bc.Chain()) - 1,
+		BlockchainAddress: bc.BlockchainAddress(),
+	}
+	if info != want {
+		t.Fatalf("info %+v, want %+v", info, want)
+	}
+}
+func TestAmount(t *testing.T) {
+	alice := newTestWallet(t)
+	bcs := newFundedServer(t, alice)
+	for _, c := range []struct {
+		query string
+		code  int
+	}{
+		{"", ErrCodeInvalidParameter},
+		{"?blockchain_address=", ErrCodeInvalidParameter},
+		{"?blockchain_address=nope", ErrCodeInvalidAddress},
+		{"?blockchain_address=" + alice.BlockchainAddress()[:len(alice.BlockchainAddress())-1], ErrCodeInvalidAddress},
+	} {
+		w := serve(bcs, http.MethodGet, "/amount"+c.query, nil)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%q: status %d, want 400", c.query, w.Code)
+			continue
+		}
+		if code := errorCode(t, w); code != c.code {
+			t.Errorf("%q: error code %d, want %d", c.query, code, c.code)
+		}
+	}
+	for address, want := range map[string]float32{
+		alice.BlockchainAddress():            100,
+		newTestWallet(t).BlockchainAddress(): 0,
+	} {
+		w := serve(bcs, http.MethodGet, "/amount?blockchain_address="+address, nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("status %d: %s", w.Code, w.Body)
+		}
+		var v struct {
+			Amount float32 `json:"amount"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &v); err != nil {
+			t.Fatal(err)
+		}
+		if v.Amount != want {
+			t.Fatalf("%s: amount %v, want %v", address, v.Amount, want)
+		}
+	}
+}
+func TestBalancesPaged(t *testing.T) {
+	alice, bob := newTestWallet(t), newTestWallet(t)
+	bcs := newFundedServer(t, alice)
+	mineTransfers(t, bcs, alice, bob, 2)
+	want := bcs.GetBlockchain().AllBalances()
+	type page struct {
+		Balances []struct {
+			BlockchainAddress string  `json:"blockchain_address"`
+			Amount            float32 `json:"amount"`
+		} `json:"balances"`
+		Offset int `json:"offset"`
+		Limit  int `json:"limit"`
+		Total  int `json:"total"`
+	}
+	seen := make(map[string]bool)
+	previous := ""
+	for offset := 0; ; offset += 2 {
+		w := serve(bcs, http.MethodGet, fmt.Sprintf("/balances?offset=%d&limit=2", offset), nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("status %d: %s", w.Code, w.Body)
+		}
+		var p page
+		if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil {
+			t.Fatal(err)
+		}
+		if p.Total != len(want) || p.Offset != offset || p.Limit != 2 {
+			t.Fatalf("page at %d: total %d, offset %d, limit %d", offset, p.Total, p.Offset, p.Limit)
+		}
+		if len(p.Balances) == 0 {
+			break
+		}
+		for _, b := range p.Balances {
+			if b.BlockchainAddress <= previous {
+				t.Fatalf("%s listed after %s", b.BlockchainAddress, previous)
+			}
+			previous = b.BlockchainAddress
+			if b.Amount != want[b.BlockchainAddress] {
+				t.Fatalf("%s: amount %v, want %v", b.BlockchainAddress, b.Amount, want[b.BlockchainAddress])
+			}
+			seen[b.BlockchainAddress] = true
+		}
+	}
+	if len(seen) != len(want) {
+		t.Fatalf("pages listed %d addresses, want %d", len(seen), len(want))
+	}
+	if w := serve(bcs, http.MethodGet, "/balances?offset=-1", nil); w.Code != http.StatusBadRequest {
+		t.Fatalf("negative offset: status %d", w.Code)
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"goblockchain/block"
+	"goblockchain/utils"
+	"goblockchain/wallet"
+	"io"
+	"net/http"
+)
+
+// SetFaucet enables POST /faucet, which sends amount to any address from
+// the node's mining wallet. It is meant for test networks only; zero, the
+// default, disables the faucet.
+func (bcs *BlockchainServer) SetFaucet(amount float32) {
+	bcs.faucet = amount
+}
+
+// Faucet pays the faucet amount to the address in the query string out of
+// the mining rewards this node has earned, so it only works once the node
+// has mined and the coinbase outputs have matured.
+func (bcs *BlockchainServer) Faucet(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodPost:
+		if bcs.faucet <= 0 {
+			writeError(w, http.StatusForbidden, ErrCodeFaucetDisabled, "faucet is disabled")
+			return
+		}
+		address := req.URL.Query().Get("address")
+		if !utils.ValidateAddress(address) {
+			writeError(w, http.StatusBadRequest, ErrCodeInvalidRecipient, "invalid address")
+			return
+		}
+		bc := bcs.GetBlockchain()
+		miner := bcs.minerWallet
+		if miner == nil {
+			writeError(w, http.StatusInternalServerError, ErrCodeInternal, "no mining wallet to pay from")
+			return
+		}
+		sender := miner.BlockchainAddress()
+		sequence := bc.NextSequence(sender)
+		signed := wallet.NewTransaction(miner.PrivateKey(), miner.PublicKey(), sender, address, bcs.faucet, 0, 0, sequence)
+		t := block.NewTransaction(sender, address, bcs.faucet, 0, 0, sequence)
+		if err := bc.CreateTransaction(bcs.rootContext(), t, miner.PublicKey(), signed.GenerateSignature()); err != nil {
+			writeError(w, http.StatusBadRequest, transactionErrorCode(err), err.Error())
+			return
+		}
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		io.WriteString(w, string(utils.JsonStatus("success")))
+	default:
+		methodNotAllowed(w, http.MethodPost)
+	}
+}
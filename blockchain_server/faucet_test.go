@@ -0,0 +1,49 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestFaucetDisabledByDefault(t *testing.T) {
+	bcs := newTestServer(t)
+	w := serve(bcs, http.MethodPost, "/faucet?address="+newTestWallet(t).BlockchainAddress(), nil)
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("status %d, want 403", w.Code)
+	}
+	if code := errorCode(t, w); code != ErrCodeFaucetDisabled {
+		t.Fatalf("error code %d, want %d", code, ErrCodeFaucetDisabled)
+	}
+	if n := len(bcs.GetBlockchain().TransactionPool()); n != 0 {
+		t.Fatalf("%d pooled transactions, want none", n)
+	}
+}
+func TestFaucet(t *testing.T) {
+	miner, alice := newTestWallet(t), newTestWallet(t)
+	bcs := newFundedServer(t, miner)
+	bcs.SetMinerWallet(miner)
+	bcs.SetFaucet(2.5)
+	for i := 0; i < 2; i++ {
+		if w := serve(bcs, http.MethodPost, "/faucet?address="+alice.BlockchainAddress(), nil); w.Code != http.StatusCreated {
+			t.Fatalf("request %d: status %d: %s", i, w.Code, w.Body)
+		}
+	}
+	bc := bcs.GetBlockchain()
+	if n := len(bc.TransactionPool()); n != 2 {
+		t.Fatalf("%d pooled transactions, want 2", n)
+	}
+	bc.Mining()
+	if got := bc.Balance(alice.BlockchainAddress()); got != 5 {
+		t.Fatalf("balance %v after mining, want 5", got)
+	}
+	w := serve(bcs, http.MethodPost, "/faucet?address=nope", nil)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("invalid address: status %d", w.Code)
+	}
+	if code := errorCode(t, w); code != ErrCodeInvalidRecipient {
+		t.Fatalf("invalid address: error code %d, want %d", code, ErrCodeInvalidRecipient)
+	}
+	if w := serve(bcs, http.MethodGet, "/faucet?address="+alice.BlockchainAddress(), nil); w.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("GET: status %d", w.Code)
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"goblockchain/block"
+	"goblockchain/wallet"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// newTestServer returns a server whose blockchain is created afresh on
+// first use and stopped when the test ends.
+func newTestServer(t *testing.T) *BlockchainServer {
+	t.Helper()
+	delete(cache, "blockchain")
+	bcs := NewBlockchainServer("", 5000, "")
+	bcs.SetRequestLogging(false)
+	t.Cleanup(func() {
+		if bc, ok := cache["blockchain"]; ok {
+			bc.Stop()
+		}
+		delete(cache, "blockchain")
+	})
+	return bcs
+}
+
+// serve runs one request through the server's full handler.
+func serve(bcs *BlockchainServer, method string, target string, body io.Reader) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	bcs.Handler().ServeHTTP(w, httptest.NewRequest(method, target, body))
+	return w
+}
+
+// newFundedServer is newTestServer with a genesis block crediting each
+// wallet with 100.
+func newFundedServer(t *testing.T, funded ...*wallet.Wallet) *BlockchainServer {
+	t.Helper()
+	bcs := newTestServer(t)
+	allocations := make(map[string]float32)
+	for _, w := range funded {
+		allocations[w.BlockchainAddress()] = 100
+	}
+	bcs.SetGenesis(block.GenesisConfig{Allocations: allocations})
+	return bcs
+}
+func newTestWallet(t *testing.T) *wallet.Wallet {
+	t.Helper()
+	w, err := wallet.NewWallet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return w
+}
+
+// transactionRequest is the body a wallet posts to /transactions.
+func transactionRequest(from, to *wallet.Wallet, value, fee float32, sequence uint64) map[string]any {
+	signed := wallet.NewTransaction(from.PrivateKey(), from.PublicKey(), from.BlockchainAddress(), to.BlockchainAddress(), value, fee, 0, sequence)
+	return map[string]any{
+		"sender_blockchain_address":    from.BlockchainAddress(),
+		"recipient_blockchain_address": to.BlockchainAddress(),
+		"sender_public_key":            from.PublicKeyStr(),
+		"value":                        value,
+		"fee":                          fee,
+		"sequence":                     sequence,
+		"signature":                    signed.GenerateSignature().String(),
+	}
+}
+func jsonBody(t *testing.T, v any) io.Reader {
+	t.Helper()
+	m, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bytes.NewReader(m)
+}
+
+// mineTransfers mines n blocks on the server's chain, each with one
+// transfer from one wallet to another.
+func mineTransfers(t *testing.T, bcs *BlockchainServer, from, to *wallet.Wallet, n int) {
+	t.Helper()
+	bc := bcs.GetBlockchain()
+	for i := 0; i < n; i++ {
+		sequence := bc.NextSequence(from.BlockchainAddress())
+		if w := serve(bcs, http.MethodPost, "/transactions", jsonBody(t, transactionRequest(from, to, 1, 0.1, sequence))); w.Code != http.StatusCreated {
+			t.Fatalf("transaction: status %d: %s", w.Code, w.Body)
+		}
+		if !bc.Mining() {
+			t.Fatal("nothing mined")
+		}
+	}
+}
+
+// peerChain is the chain of another node on newFundedServer's network with
+// n blocks mined on top of its genesis, each paying 1 from one wallet to
+// another.
+func peerChain(t *testing.T, from, to *wallet.Wallet, n int) *block.Blockchain {
+	t.Helper()
+	bc := block.NewBlockchainWithGenesis("miner", 5000, "", block.GenesisConfig{
+		Allocations: map[string]float32{from.BlockchainAddress(): 100},
+	})
+	for i := 0; i < n; i++ {
+		signed := wallet.NewTransaction(from.PrivateKey(), from.PublicKey(), from.BlockchainAddress(), to.BlockchainAddress(), 1, 0.1, 0, uint64(i))
+		tx := block.NewTransaction(from.BlockchainAddress(), to.BlockchainAddress(), 1, 0.1, 0, uint64(i))
+		if err := bc.AddTransaction(tx, from.PublicKey(), signed.GenerateSignature()); err != nil {
+			t.Fatal(err)
+		}
+		if !bc.Mining() {
+			t.Fatal("nothing mined")
+		}
+	}
+	return bc
+}
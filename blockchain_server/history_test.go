@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"goblockchain/block"
+	"net/http"
+	"testing"
+)
+
+type historyPage struct {
+	Transactions []struct {
+		Transaction struct {
+			Sender    string  `json:"sender_blockchain_address"`
+			Recipient string  `json:"recipient_blockchain_address"`
+			Value     float32 `json:"value"`
+		} `json:"transaction"`
+		Height        int    `json:"height"`
+		Confirmations int    `json:"confirmations"`
+		Status        string `json:"status"`
+		Direction     string `json:"direction"`
+	} `json:"transactions"`
+	Offset int `json:"offset"`
+	Limit  int `json:"limit"`
+	Total  int `json:"total"`
+}
+
+func getHistory(t *testing.T, bcs *BlockchainServer, target string) historyPage {
+	t.Helper()
+	w := serve(bcs, http.MethodGet, target, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("%s: status %d: %s", target, w.Code, w.Body)
+	}
+	var p historyPage
+	if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+func TestAddressTransactions(t *testing.T) {
+	alice, bob := newTestWallet(t), newTestWallet(t)
+	bcs := newFundedServer(t, alice)
+	mineTransfers(t, bcs, alice, bob, 2)
+	mineTransfers(t, bcs, bob, alice, 1)
+	p := getHistory(t, bcs, "/address/"+alice.BlockchainAddress()+"/transactions")
+	want := []struct {
+		height    int
+		direction string
+	}{
+		{0, block.DirectionIn},
+		{1, block.DirectionOut},
+		{2, block.DirectionOut},
+		{3, block.DirectionIn},
+	}
+	if p.Total != len(want) || len(p.Transactions) != len(want) {
+		t.Fatalf("%d of %d transactions, want %d", len(p.Transactions), p.Total, len(want))
+	}
+	for i, w := range want {
+		got := p.Transactions[i]
+		if got.Height != w.height || got.Direction != w.direction {
+			t.Errorf("transaction %d: height %d %s, want height %d %s", i, got.Height, got.Direction, w.height, w.direction)
+		}
+	}
+	if genesis := p.Transactions[0].Transaction; genesis.Recipient != alice.BlockchainAddress() || genesis.Value != 100 {
+		t.Errorf("genesis allocation %+v", genesis)
+	}
+	// Paged like /chain.
+	p = getHistory(t, bcs, "/address/"+alice.BlockchainAddress()+"/transactions?offset=1&limit=2")
+	if p.Total != 4 || len(p.Transactions) != 2 || p.Transactions[0].Height != 1 || p.Transactions[1].Height != 2 {
+		t.Fatalf("page %+v", p)
+	}
+	// The miner's history holds its coinbase payouts.
+	miner := bcs.GetBlockchain().BlockchainAddress()
+	p = getHistory(t, bcs, "/address/"+miner+"/transactions")
+	if p.Total != 3 {
+		t.Fatalf("miner has %d transactions, want 3 coinbases", p.Total)
+	}
+	for _, tx := range p.Transactions {
+		if tx.Direction != block.DirectionIn || tx.Transaction.Sender != block.MiningSender {
+			t.Fatalf("miner transaction %+v", tx)
+		}
+	}
+	if w := serve(bcs, http.MethodGet, "/address/nope/transactions", nil); w.Code != http.StatusBadRequest {
+		t.Fatalf("invalid address: status %d", w.Code)
+	}
+	if w := serve(bcs, http.MethodGet, "/address/"+alice.BlockchainAddress()+"/blocks", nil); w.Code != http.StatusNotFound {
+		t.Fatalf("unknown route: status %d", w.Code)
+	}
+}
@@ -1,17 +1,110 @@
 package main
 
 import (
+	"context"
 	"flag"
-	"log"
+	"fmt"
+	"goblockchain/block"
+	"goblockchain/utils"
+	"goblockchain/wallet"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
 )
 
-func init() {
-	log.SetPrefix("Blockchain: ")
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
 }
-
 func main() {
+	bindAddress := flag.String("bind", DefaultBindAddress, "Address for Blockchain Server to listen on, e.g. 0.0.0.0 for all interfaces")
 	port := flag.Uint("port", 5000, "TCP Port Number for Blockchain Server")
+	dataPath := flag.String("data", "", "Chain data file, loaded on start and saved after each mined block")
+	logRequests := flag.Bool("log-requests", true, "Log the method, path, status and duration of every request")
+	certFile := flag.String("tls-cert", "", "TLS certificate file; serves HTTPS together with -tls-key")
+	keyFile := flag.String("tls-key", "", "TLS private key file; serves HTTPS together with -tls-cert")
+	corsOrigins := flag.String("cors-origins", "", "Comma-separated origins allowed to call the node from a browser, or * for any")
+	corsMethods := flag.String("cors-methods", "GET,POST,PUT,DELETE,OPTIONS", "Comma-separated methods allowed for cross-origin requests")
+	corsHeaders := flag.String("cors-headers", "Content-Type", "Comma-separated request headers allowed for cross-origin requests")
+	txRate := flag.Float64("tx-rate", DefaultTransactionRate, "Transactions per second each client IP may POST or PUT")
+	txBurst := flag.Int("tx-burst", DefaultTransactionBurst, "Burst of transactions each client IP may POST at once")
+	networkID := flag.String("network", block.DefaultNetworkID, "Network id; peers and chains from other networks are rejected")
+	minerKey := flag.String("miner-key", "", "Private key in hex of the wallet mining rewards go to; a new wallet by default")
+	faucet := flag.Float64("faucet", 0, "Enable POST /faucet paying this amount per request from the node's mining rewards; for test networks only")
+	genesisPath := flag.String("genesis", "", "JSON genesis config file with network_id, timestamp and allocations; -network fills in a missing network_id")
+	prune := flag.Int("prune", 0, "Keep transactions of only this many recent blocks, older ones keep just their headers; 0 keeps everything")
+	logLevel := slog.LevelInfo
+	flag.TextVar(&logLevel, "log-level", slog.LevelInfo, "Lowest level logged: debug, info, warn or error")
+	logFormat := flag.String("log-format", "text", "Log output format: text or json")
+	allocations := make(map[string]float32)
+	flag.Func("alloc", "Pre-fund an address at genesis, as address=amount; may be repeated", func(s string) error {
+		address, amount, ok := strings.Cut(s, "=")
+		if !ok {
+			return fmt.Errorf("want address=amount, got %q", s)
+		}
+		value, err := strconv.ParseFloat(amount, 32)
+		if err != nil {
+			return err
+		}
+		allocations[address] += float32(value)
+		return nil
+	})
 	flag.Parse()
-	app := NewBlockchainServer(uint16(*port))
-	app.Run()
+	logger, err := utils.NewLogger(os.Stderr, logLevel, *logFormat)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	slog.SetDefault(logger.With("app", "blockchain"))
+	app := NewBlockchainServer(*bindAddress, uint16(*port), *dataPath)
+	app.SetRequestLogging(*logRequests)
+	app.SetTLS(*certFile, *keyFile)
+	genesis := block.GenesisConfig{NetworkID: *networkID}
+	if *genesisPath != "" {
+		if genesis, err = block.LoadGenesisConfig(*genesisPath); err != nil {
+			fatal("loading genesis config failed", err)
+		}
+		if genesis.NetworkID == "" {
+			genesis.NetworkID = *networkID
+		}
+	}
+	if len(allocations) > 0 {
+		if genesis.Allocations == nil {
+			genesis.Allocations = make(map[string]float32)
+		}
+		for address, value := range allocations {
+			genesis.Allocations[address] += value
+		}
+		if err := genesis.Validate(); err != nil {
+			fatal("invalid genesis allocation", err)
+		}
+	}
+	app.SetGenesis(genesis)
+	app.SetFaucet(float32(*faucet))
+	app.SetPruning(*prune)
+	if *minerKey != "" {
+		w, err := wallet.NewWalletFromPrivateKey(*minerKey)
+		if err != nil {
+			fatal("invalid miner key", err)
+		}
+		app.SetMinerWallet(w)
+	}
+	app.SetTransactionRateLimit(*txRate, *txBurst)
+	if *corsOrigins != "" {
+		app.SetCORS(&CORSConfig{
+			AllowedOrigins: strings.Split(*corsOrigins, ","),
+			AllowedMethods: strings.Split(*corsMethods, ","),
+			AllowedHeaders: strings.Split(*corsHeaders, ","),
+		})
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if err := app.Run(ctx); err != nil {
+		stop()
+		fatal("server stopped", err)
+	}
+	slog.Info("shut down")
 }
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"goblockchain/block"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// newMetricsHandler registers the node's collectors on a fresh registry and
+// serves them in the Prometheus text format. Gauges are read from bc on each
+// scrape; the mined-block counter and mining histogram follow its events.
+func newMetricsHandler(bc *block.Blockchain) http.Handler {
+	registry := prometheus.NewRegistry()
+	height := prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "goblockchain_chain_height",
+		Help: "Height of the last block in the chain.",
+	}, func() float64 {
+		return float64(len(bc.Chain()) - 1)
+	})
+	poolSize := prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "goblockchain_transaction_pool_size",
+		Help: "Number of transactions waiting in the pool.",
+	}, func() float64 {
+		return float64(len(bc.TransactionPool()))
+	})
+	peers := prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "goblockchain_peers",
+		Help: "Number of known neighbor nodes.",
+	}, func() float64 {
+		return float64(len(bc.Neighbors()))
+	})
+	blocksMined := prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "goblockchain_blocks_mined_total",
+		Help: "Blocks mined by this node.",
+	})
+	miningDuration := prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "goblockchain_mining_duration_seconds",
+		Help:    "Time spent on proof of work for each mined block.",
+		Buckets: prometheus.ExponentialBuckets(0.01, 4, 8),
+	})
+	registry.MustRegister(height, poolSize, peers, blocksMined, miningDuration)
+
+	events, unsubscribe := bc.Subscribe()
+	go func() {
+		defer unsubscribe()
+		for {
+			select {
+			case <-bc.Done():
+				return
+			case e := <-events:
+				if e.Type == block.EventBlockMined {
+					blocksMined.Inc()
+					miningDuration.Observe(e.Duration.Seconds())
+				}
+			}
+		}
+	}()
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
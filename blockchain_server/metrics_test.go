@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bufio"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// scrape fetches /metrics and returns the value of each unlabelled sample.
+func scrape(t *testing.T, bcs *BlockchainServer) map[string]float64 {
+	t.Helper()
+	w := serve(bcs, http.MethodGet, "/metrics", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d", w.Code)
+	}
+	samples := make(map[string]float64)
+	s := bufio.NewScanner(w.Body)
+	for s.Scan() {
+		name, value, ok := strings.Cut(s.Text(), " ")
+		if !ok || strings.HasPrefix(name, "#") {
+			continue
+		}
+		v, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			t.Fatalf("sample %q: %v", s.Text(), err)
+		}
+		samples[name] = v
+	}
+	return samples
+}
+func TestMetrics(t *testing.T) {
+	alice := newTestWallet(t)
+	bcs := newFundedServer(t, alice)
+	bc := bcs.GetBlockchain()
+	samples := scrape(t, bcs)
+	if got := samples["goblockchain_chain_height"]; got != 0 {
+		t.Fatalf("height gauge %v on a fresh chain, want 0", got)
+	}
+	if got := samples["goblockchain_blocks_mined_total"]; got != 0 {
+		t.Fatalf("blocks mined %v on a fresh chain, want 0", got)
+	}
+	mineTransfers(t, bcs, alice, newTestWallet(t), 2)
+	want := float64(len(bc.Chain()) - 1)
+	// The mined-block counter follows events, so it may lag a scrape.
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		samples = scrape(t, bcs)
+		if samples["goblockchain_blocks_mined_total"] == want {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("blocks mined %v, want %v", samples["goblockchain_blocks_mined_total"], want)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := samples["goblockchain_chain_height"]; got != want {
+		t.Fatalf("height gauge %v, want %v", got, want)
+	}
+	if got := samples["goblockchain_mining_duration_seconds_count"]; got != want {
+		t.Fatalf("mining durations observed %v, want %v", got, want)
+	}
+	if got := samples["goblockchain_transaction_pool_size"]; got != float64(len(bc.TransactionPool())) {
+		t.Fatalf("pool size gauge %v, want %d", got, len(bc.TransactionPool()))
+	}
+	if _, ok := samples["goblockchain_peers"]; !ok {
+		t.Fatal("no peers gauge")
+	}
+}
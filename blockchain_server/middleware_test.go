@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// captureLogs sends the default logger's output to a buffer until the test
+// ends.
+func captureLogs(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&buf, nil)))
+	t.Cleanup(func() { slog.SetDefault(previous) })
+	return &buf
+}
+func TestLogRequests(t *testing.T) {
+	for _, c := range []struct {
+		handler http.HandlerFunc
+		status  int
+	}{
+		{func(w http.ResponseWriter, req *http.Request) { w.WriteHeader(http.StatusTeapot) }, http.StatusTeapot},
+		{func(w http.ResponseWriter, req *http.Request) { io.WriteString(w, "body") }, http.StatusOK},
+		{func(w http.ResponseWriter, req *http.Request) {}, http.StatusOK},
+	} {
+		logs := captureLogs(t)
+		w := httptest.NewRecorder()
+		logRequests(c.handler).ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/chain?offset=1", nil))
+		if w.Code != c.status {
+			t.Fatalf("response status %d, want %d", w.Code, c.status)
+		}
+		var entry struct {
+			Msg      string `json:"msg"`
+			Method   string `json:"method"`
+			Path     string `json:"path"`
+			Status   int    `json:"status"`
+			Duration *int64 `json:"duration"`
+		}
+		if err := json.Unmarshal(logs.Bytes(), &entry); err != nil {
+			t.Fatalf("log %q: %v", logs, err)
+		}
+		if entry.Msg != "request" || entry.Method != http.MethodPost || entry.Path != "/chain" || entry.Status != c.status || entry.Duration == nil {
+			t.Fatalf("logged %s, want POST /chain with status %d", logs, c.status)
+		}
+	}
+}
+func TestRequestLoggingDisabled(t *testing.T) {
+	bcs := newTestServer(t)
+	bcs.GetBlockchain()
+	logs := captureLogs(t)
+	if w := serve(bcs, http.MethodGet, "/health", nil); w.Code != http.StatusOK {
+		t.Fatalf("status %d", w.Code)
+	}
+	if bytes.Contains(logs.Bytes(), []byte(`"msg":"request"`)) {
+		t.Fatalf("request logged with logging off: %s", logs)
+	}
+}
+func corsRequest(bcs *BlockchainServer, method string, origin string, header http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, "/amount?blockchain_address=x", nil)
+	req.Header = header
+	if req.Header == nil {
+		req.Header = http.Header{}
+	}
+	req.Header.Set("Origin", origin)
+	w := httptest.NewRecorder()
+	bcs.Handler().ServeHTTP(w, req)
+	return w
+}
+func TestCORSPreflight(t *testing.T) {
+	bcs := newTestServer(t)
+	bcs.SetCORS(&CORSConfig{
+		AllowedOrigins: []string{"https://wallet.example"},
+		AllowedMethods: []string{http.MethodGet, http.MethodPost},
+		AllowedHeaders: []string{"Content-Type"},
+	})
+	preflight := http.Header{"Access-Control-Request-Method": {http.MethodPost}}
+	w := corsRequest(bcs, http.MethodOptions, "https://wallet.example", preflight)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("preflight status %d, want 204", w.Code)
+	}
+	for name, want := range map[string]string{
+		"Access-Control-Allow-Origin":  "https://wallet.example",
+		"Access-Control-Allow-Methods": "GET, POST",
+		"Access-Control-Allow-Headers": "Content-Type",
+		"Vary":                         "Origin",
+	} {
+		if got := w.Header().Get(name); got != want {
+			t.Errorf("%s: %q, want %q", name, got, want)
+		}
+	}
+	if w.Body.Len() != 0 {
+		t.Errorf("preflight has a body: %q", w.Body)
+	}
+	// An origin not on the list gets no CORS headers.
+	w = corsRequest(bcs, http.MethodOptions, "https://evil.example", preflight)
+	for _, name := range []string{"Access-Control-Allow-Origin", "Access-Control-Allow-Methods", "Access-Control-Allow-Headers"} {
+		if got := w.Header().Get(name); got != "" {
+			t.Errorf("disallowed origin got %s %q", name, got)
+		}
+	}
+}
+func TestCORSCrossOriginGet(t *testing.T) {
+	bcs := newTestServer(t)
+	bcs.SetCORS(&CORSConfig{AllowedOrigins: []string{"*"}, AllowedMethods: []string{http.MethodGet}})
+	w := corsRequest(bcs, http.MethodGet, "https://wallet.example", nil)
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "*" {
+		t.Fatalf("Access-Control-Allow-Origin %q, want *", got)
+	}
+	if got := w.Header().Get("Vary"); got != "" {
+		t.Errorf("Vary %q with a wildcard origin", got)
+	}
+	if w.Code == http.StatusNoContent {
+		t.Fatal("GET answered like a preflight")
+	}
+}
+func TestCORSDisabledByDefault(t *testing.T) {
+	bcs := newTestServer(t)
+	w := corsRequest(bcs, http.MethodGet, "https://wallet.example", nil)
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "" {
+		t.Fatalf("Access-Control-Allow-Origin %q without a CORS config", got)
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// Defaults for the per-client limit on POST and PUT /transactions.
+const (
+	DefaultTransactionRate  = 5.0
+	DefaultTransactionBurst = 10
+)
+
+// limiterIdleTimeout is how long a client's bucket is kept after its last
+// request; an idle bucket has refilled anyway.
+const limiterIdleTimeout = 3 * time.Minute
+
+type clientLimiter struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// ipRateLimiter hands out one token bucket per client IP.
+type ipRateLimiter struct {
+	mux     sync.Mutex
+	clients map[string]*clientLimiter
+	limit   rate.Limit
+	burst   int
+	pruned  time.Time
+}
+
+func newIPRateLimiter(perSecond float64, burst int) *ipRateLimiter {
+	return &ipRateLimiter{
+		clients: make(map[string]*clientLimiter),
+		limit:   rate.Limit(perSecond),
+		burst:   burst,
+	}
+}
+func (l *ipRateLimiter) allow(ip string) bool {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	now := time.Now()
+	if now.Sub(l.pruned) > limiterIdleTimeout {
+		for k, c := range l.clients {
+			if now.Sub(c.lastSeen) > limiterIdleTimeout {
+				delete(l.clients, k)
+			}
+		}
+		l.pruned = now
+	}
+	c, ok := l.clients[ip]
+	if !ok {
+		c = &clientLimiter{limiter: rate.NewLimiter(l.limit, l.burst)}
+		l.clients[ip] = c
+	}
+	c.lastSeen = now
+	return c.limiter.AllowN(now, 1)
+}
+func clientIP(req *http.Request) string {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+	return host
+}
+
+// limitWrites answers 429 to clients sending POST or PUT requests faster
+// than l allows. Other methods pass straight through.
+func limitWrites(next http.HandlerFunc, l *ipRateLimiter) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		write := req.Method == http.MethodPost || req.Method == http.MethodPut
+		if write && !l.allow(clientIP(req)) {
+			w.Header().Set("Retry-After", "1")
+			writeError(w, http.StatusTooManyRequests, ErrCodeRateLimited, "too many requests")
+			return
+		}
+		next(w, req)
+	}
+}
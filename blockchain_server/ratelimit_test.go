@@ -0,0 +1,77 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestLimitWrites(t *testing.T) {
+	ok := func(w http.ResponseWriter, req *http.Request) {}
+	for _, method := range []string{http.MethodPost, http.MethodPut} {
+		h := limitWrites(ok, newIPRateLimiter(1, 2))
+		var codes []int
+		for i := 0; i < 3; i++ {
+			w := httptest.NewRecorder()
+			h(w, httptest.NewRequest(method, "/transactions", nil))
+			codes = append(codes, w.Code)
+		}
+		if codes[0] != http.StatusOK || codes[1] != http.StatusOK || codes[2] != http.StatusTooManyRequests {
+			t.Errorf("%s: got statuses %v", method, codes)
+		}
+	}
+	h := limitWrites(ok, newIPRateLimiter(1, 1))
+	for i := 0; i < 3; i++ {
+		w := httptest.NewRecorder()
+		h(w, httptest.NewRequest(http.MethodGet, "/transactions", nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("GET limited: status %d", w.Code)
+		}
+	}
+}
+func TestLimiterIsPerClient(t *testing.T) {
+	l := newIPRateLimiter(1, 1)
+	if !l.allow("10.0.0.1") || l.allow("10.0.0.1") {
+		t.Fatal("first client not limited after its burst")
+	}
+	if !l.allow("10.0.0.2") {
+		t.Fatal("second client limited by the first")
+	}
+}
+func TestTransactionsRateLimited(t *testing.T) {
+	alice, bob := newTestWallet(t), newTestWallet(t)
+	bcs := newFundedServer(t, alice)
+	bcs.SetTransactionRateLimit(0.001, 2)
+	post := func(remoteAddr string, sequence uint64) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/transactions", jsonBody(t, transactionRequest(alice, bob, 1, 0.1, sequence)))
+		req.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		bcs.Handler().ServeHTTP(w, req)
+		return w
+	}
+	for i := uint64(0); i < 2; i++ {
+		if w := post("10.0.0.1:4000", i); w.Code != http.StatusCreated {
+			t.Fatalf("transaction %d within budget: status %d: %s", i, w.Code, w.Body)
+		}
+	}
+	w := post("10.0.0.1:4001", 2)
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("transaction over budget: status %d, want 429", w.Code)
+	}
+	if code := errorCode(t, w); code != ErrCodeRateLimited {
+		t.Fatalf("error code %d, want %d", code, ErrCodeRateLimited)
+	}
+	if w.Header().Get("Retry-After") == "" {
+		t.Fatal("no Retry-After header")
+	}
+	if n := len(bcs.GetBlockchain().TransactionPool()); n != 2 {
+		t.Fatalf("pool has %d transactions, want 2", n)
+	}
+	if w := post("10.0.0.2:4000", 2); w.Code != http.StatusCreated {
+		t.Fatalf("another client: status %d: %s", w.Code, w.Body)
+	}
+	// Reads are never limited.
+	if w := serve(bcs, http.MethodGet, "/transactions", nil); w.Code != http.StatusOK {
+		t.Fatalf("GET status %d", w.Code)
+	}
+}
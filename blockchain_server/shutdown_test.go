@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"goblockchain/block"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// freePort returns a port nothing is listening on.
+func freePort(t *testing.T) uint16 {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return uint16(l.Addr().(*net.TCPAddr).Port)
+}
+
+// startMining waits for a running server to come up and starts its mining
+// loop over HTTP.
+func startMining(t *testing.T, bcs *BlockchainServer) {
+	t.Helper()
+	url := fmt.Sprintf("http://%s/mind/start", bcs.Addr())
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		resp, err := http.Get(url)
+		if err == nil {
+			resp.Body.Close()
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("server never came up: %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !bcs.GetBlockchain().MiningActive() {
+		t.Fatal("mining not started")
+	}
+}
+
+// checkLoopsStopped fails unless the blockchain's mining and sync loops
+// have stopped.
+func checkLoopsStopped(t *testing.T, bc *block.Blockchain) {
+	t.Helper()
+	select {
+	case <-bc.Done():
+	default:
+		t.Fatal("blockchain loops not stopped")
+	}
+	for deadline := time.Now().Add(5 * time.Second); bc.MiningActive(); time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("mining still active")
+		}
+	}
+}
+func TestStop(t *testing.T) {
+	delete(cache, "blockchain")
+	t.Cleanup(func() { delete(cache, "blockchain") })
+	bcs := NewBlockchainServer("127.0.0.1", freePort(t), "")
+	bcs.SetRequestLogging(false)
+	done := make(chan error, 1)
+	go func() { done <- bcs.Run(context.Background()) }()
+	startMining(t, bcs)
+	if err := bcs.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Run returned %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return after Stop")
+	}
+	if conn, err := net.Dial("tcp", bcs.Addr()); err == nil {
+		conn.Close()
+		t.Fatal("listener still open after Stop")
+	}
+	checkLoopsStopped(t, bcs.GetBlockchain())
+}
+func TestRunStopsWithContext(t *testing.T) {
+	delete(cache, "blockchain")
+	t.Cleanup(func() { delete(cache, "blockchain") })
+	bcs := NewBlockchainServer("127.0.0.1", freePort(t), "")
+	bcs.SetRequestLogging(false)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- bcs.Run(ctx) }()
+	startMining(t, bcs)
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Run returned %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return once its context was done")
+	}
+	checkLoopsStopped(t, bcs.GetBlockchain())
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// selfSignedCert writes a certificate for 127.0.0.1 and its key to a
+// temporary directory, returning their paths and a pool that trusts it.
+func selfSignedCert(t *testing.T) (certFile string, keyFile string, roots *x509.CertPool) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	certFile, keyFile = filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	roots = x509.NewCertPool()
+	roots.AddCert(cert)
+	return certFile, keyFile, roots
+}
+func TestRunServesTLS(t *testing.T) {
+	delete(cache, "blockchain")
+	t.Cleanup(func() { delete(cache, "blockchain") })
+	certFile, keyFile, roots := selfSignedCert(t)
+	bcs := NewBlockchainServer("127.0.0.1", freePort(t), "")
+	bcs.SetRequestLogging(false)
+	bcs.SetTLS(certFile, keyFile)
+	if bcs.scheme() != "https" {
+		t.Fatalf("scheme %q with TLS set, want https", bcs.scheme())
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- bcs.Run(ctx) }()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots}}}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		resp, err := client.Get(fmt.Sprintf("https://%s/", bcs.Addr()))
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("status %d", resp.StatusCode)
+			}
+			if resp.TLS == nil {
+				t.Fatal("response not served over TLS")
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("TLS server never came up: %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	// Plain HTTP is refused rather than served alongside.
+	resp, err := http.Get(fmt.Sprintf("http://%s/", bcs.Addr()))
+	if err == nil {
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusOK {
+			t.Fatal("plain HTTP served with TLS enabled")
+		}
+	}
+}
+func TestTLSNeedsCertAndKey(t *testing.T) {
+	bcs := NewBlockchainServer("", 5000, "")
+	for _, c := range [][2]string{{"", ""}, {"cert.pem", ""}, {"", "key.pem"}} {
+		bcs.SetTLS(c[0], c[1])
+		if bcs.tlsEnabled() || bcs.scheme() != "http" {
+			t.Errorf("SetTLS(%q, %q): TLS enabled, scheme %q", c[0], c[1], bcs.scheme())
+		}
+	}
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"encoding/json"
+	"goblockchain/block"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestPostTransactionObjectOrArray(t *testing.T) {
+	alice, bob := newTestWallet(t), newTestWallet(t)
+	bcs := newFundedServer(t, alice)
+	w := serve(bcs, http.MethodPost, "/transactions", jsonBody(t, transactionRequest(alice, bob, 1, 0.1, 0)))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("object: status %d: %s", w.Code, w.Body)
+	}
+	w = serve(bcs, http.MethodPost, "/transactions", jsonBody(t, []any{transactionRequest(alice, bob, 1, 0.1, 1)}))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("one-element array: status %d: %s", w.Code, w.Body)
+	}
+	if got := len(bcs.GetBlockchain().TransactionPool()); got != 2 {
+		t.Fatalf("%d pooled transactions, want 2", got)
+	}
+	w = serve(bcs, http.MethodPost, "/transactions", jsonBody(t, []any{
+		transactionRequest(alice, bob, 1, 0.1, 2),
+		transactionRequest(alice, bob, 1, 0.1, 3),
+	}))
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "one at a time") {
+		t.Fatalf("two-element array: status %d: %s", w.Code, w.Body)
+	}
+	w = serve(bcs, http.MethodPost, "/transactions", strings.NewReader("[]"))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("empty array: status %d: %s", w.Code, w.Body)
+	}
+	if got := len(bcs.GetBlockchain().TransactionPool()); got != 2 {
+		t.Fatalf("%d pooled transactions after rejects, want 2", got)
+	}
+}
+
+// errorCode returns the code of a failed response.
+func errorCode(t *testing.T, w *httptest.ResponseRecorder) int {
+	t.Helper()
+	var v struct {
+		Message string `json:"message"`
+		Code    int    `json:"code"`
+		Reason  string `json:"reason"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &v); err != nil {
+		t.Fatalf("error body %s: %v", w.Body, err)
+	}
+	if v.Message != "fail" || v.Reason == "" {
+		t.Fatalf("error body %s", w.Body)
+	}
+	return v.Code
+}
+func TestPostTransactionUnparsableKeys(t *testing.T) {
+	alice, bob := newTestWallet(t), newTestWallet(t)
+	bcs := newFundedServer(t, alice)
+	for _, c := range []struct {
+		field, value string
+		code         int
+	}{
+		{"sender_public_key", "", ErrCodeInvalidPublicKey},
+		{"sender_public_key", "abc", ErrCodeInvalidPublicKey},
+		{"sender_public_key", strings.Repeat("zz", 64), ErrCodeInvalidPublicKey},
+		{"signature", "", ErrCodeInvalidSignature},
+		{"signature", "0123", ErrCodeInvalidSignature},
+		{"signature", strings.Repeat("0", 127), ErrCodeInvalidSignature},
+	} {
+		r := transactionRequest(alice, bob, 1, 0.1, 0)
+		r[c.field] = c.value
+		w := serve(bcs, http.MethodPost, "/transactions", jsonBody(t, r))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s %q: status %d", c.field, c.value, w.Code)
+			continue
+		}
+		if code := errorCode(t, w); code != c.code {
+			t.Errorf("%s %q: code %d, want %d", c.field, c.value, code, c.code)
+		}
+	}
+}
+func TestPostTransactionErrorCodes(t *testing.T) {
+	alice, bob, carol := newTestWallet(t), newTestWallet(t), newTestWallet(t)
+	bcs := newFundedServer(t, alice)
+	missing := transactionRequest(alice, bob, 1, 0.1, 0)
+	delete(missing, "value")
+	forged := transactionRequest(alice, bob, 1, 0.1, 0)
+	forged["signature"] = transactionRequest(carol, bob, 1, 0.1, 0)["signature"]
+	for name, c := range map[string]struct {
+		body io.Reader
+		code int
+	}{
+		"malformed JSON":       {strings.NewReader(`{"value":`), ErrCodeMalformedRequest},
+		"missing field":        {jsonBody(t, missing), ErrCodeInvalidFields},
+		"insufficient balance": {jsonBody(t, transactionRequest(alice, bob, 500, 0.1, 0)), ErrCodeInsufficientBalance},
+		"bad signature":        {jsonBody(t, forged), ErrCodeInvalidSignature},
+		"sequence gap":         {jsonBody(t, transactionRequest(alice, bob, 1, 0.1, 5)), ErrCodeInvalidSequence},
+	} {
+		w := serve(bcs, http.MethodPost, "/transactions", c.body)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status %d", name, w.Code)
+			continue
+		}
+		if code := errorCode(t, w); code != c.code {
+			t.Errorf("%s: code %d, want %d: %s", name, code, c.code, w.Body)
+		}
+	}
+	w := serve(bcs, http.MethodPost, "/transactions", jsonBody(t, transactionRequest(alice, bob, 1, 0.1, 0)))
+	if w.Code != http.StatusCreated || strings.TrimSpace(w.Body.String()) != `{"message":"success"}` {
+		t.Fatalf("success: status %d: %s", w.Code, w.Body)
+	}
+}
+func TestGetTransactionsLength(t *testing.T) {
+	alice, bob := newTestWallet(t), newTestWallet(t)
+	bcs := newFundedServer(t, alice)
+	for i := 0; i < 2; i++ {
+		if w := serve(bcs, http.MethodPost, "/transactions", jsonBody(t, transactionRequest(alice, bob, 1, 0.1, uint64(i)))); w.Code != http.StatusCreated {
+			t.Fatalf("status %d: %s", w.Code, w.Body)
+		}
+	}
+	w := serve(bcs, http.MethodGet, "/transactions", nil)
+	var v struct {
+		Transactions []json.RawMessage `json:"transactions"`
+		Length       *int              `json:"length"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &v); err != nil {
+		t.Fatal(err)
+	}
+	if v.Length == nil || *v.Length != 2 || len(v.Transactions) != 2 {
+		t.Fatalf("got %s, want 2 transactions and length 2", w.Body)
+	}
+}
+func TestDeleteTransaction(t *testing.T) {
+	alice, bob := newTestWallet(t), newTestWallet(t)
+	bcs := newFundedServer(t, alice)
+	for i := 0; i < 3; i++ {
+		if w := serve(bcs, http.MethodPost, "/transactions", jsonBody(t, transactionRequest(alice, bob, 1, 0.1, uint64(i)))); w.Code != http.StatusCreated {
+			t.Fatalf("status %d: %s", w.Code, w.Body)
+		}
+	}
+	bc := bcs.GetBlockchain()
+	last := bc.TransactionPool()[2]
+	if w := serve(bcs, http.MethodDelete, "/transactions?id="+last.TransactionId(), nil); w.Code != http.StatusOK {
+		t.Fatalf("remove: status %d: %s", w.Code, w.Body)
+	}
+	pool := bc.TransactionPool()
+	if len(pool) != 2 {
+		t.Fatalf("%d pooled transactions, want 2", len(pool))
+	}
+	for _, tx := range pool {
+		if tx.TransactionId() == last.TransactionId() {
+			t.Fatal("removed transaction still pooled")
+		}
+	}
+	w := serve(bcs, http.MethodDelete, "/transactions?id="+last.TransactionId(), nil)
+	if w.Code != http.StatusNotFound || errorCode(t, w) != ErrCodeNotFound {
+		t.Fatalf("remove missing: status %d: %s", w.Code, w.Body)
+	}
+	if w := serve(bcs, http.MethodDelete, "/transactions", nil); w.Code != http.StatusOK {
+		t.Fatalf("clear: status %d: %s", w.Code, w.Body)
+	}
+	if n := len(bc.TransactionPool()); n != 0 {
+		t.Fatalf("%d pooled transactions after clearing", n)
+	}
+}
+func TestGetTransactionById(t *testing.T) {
+	alice, bob := newTestWallet(t), newTestWallet(t)
+	bcs := newFundedServer(t, alice)
+	bc := bcs.GetBlockchain()
+	mineTransfers(t, bcs, alice, bob, 1)
+	mined := bc.LastBlock().Transactions()[0].TransactionId()
+	mineTransfers(t, bcs, alice, bob, 1)
+	if w := serve(bcs, http.MethodPost, "/transactions", jsonBody(t, transactionRequest(alice, bob, 1, 0.1, 2))); w.Code != http.StatusCreated {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	pending := bc.TransactionPool()[0].TransactionId()
+	for _, c := range []struct {
+		id            string
+		height        int
+		confirmations int
+		status        string
+	}{
+		{mined, 1, 2, block.StatusConfirmed},
+		{pending, -1, 0, block.StatusPending},
+	} {
+		w := serve(bcs, http.MethodGet, "/transactions?id="+c.id, nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: status %d: %s", c.id, w.Code, w.Body)
+		}
+		var v struct {
+			Transaction struct {
+				TransactionId string `json:"transaction_id"`
+			} `json:"transaction"`
+			Height        int    `json:"height"`
+			Confirmations int    `json:"confirmations"`
+			Status        string `json:"status"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &v); err != nil {
+			t.Fatal(err)
+		}
+		if v.Transaction.TransactionId != c.id || v.Height != c.height || v.Confirmations != c.confirmations || v.Status != c.status {
+			t.Errorf("got %s, want height %d, %d confirmations, %s", w.Body, c.height, c.confirmations, c.status)
+		}
+	}
+	w := serve(bcs, http.MethodGet, "/transactions?id=unknown", nil)
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("unknown id: status %d", w.Code)
+	}
+	if code := errorCode(t, w); code != ErrCodeNotFound {
+		t.Fatalf("unknown id: error code %d, want %d", code, ErrCodeNotFound)
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"goblockchain/wallet"
+	"io"
+	"os"
+)
+
+// PassphraseEnv is read when no -passphrase flag is given, so the
+// passphrase need not appear in the process list.
+const PassphraseEnv = "WALLET_PASSPHRASE"
+
+const usage = `usage: wallet <command> [flags]
+
+commands:
+  new    generate a wallet and print its keys and address as JSON
+  send   sign a transaction and submit it to a node
+`
+
+func main() {
+	if err := run(os.Args[1:], os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+		os.Exit(1)
+	}
+}
+func run(args []string, stdout io.Writer) error {
+	if len(args) == 0 {
+		return errors.New(usage)
+	}
+	switch args[0] {
+	case "new":
+		return runNew(args[1:], stdout)
+	case "send":
+		return runSend(args[1:], stdout)
+	default:
+		return fmt.Errorf("unknown command %q\n%s", args[0], usage)
+	}
+}
+
+// runNew prints a fresh wallet as JSON and, with -out, also writes it to an
+// encrypted keystore file.
+func runNew(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("new", flag.ContinueOnError)
+	out := fs.String("out", "", "Write the wallet to this encrypted keystore file")
+	passphrase := fs.String("passphrase", "", "Keystore passphrase, defaults to $"+PassphraseEnv)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *passphrase == "" {
+		*passphrase = os.Getenv(PassphraseEnv)
+	}
+	if *out != "" && *passphrase == "" {
+		return errors.New("-out needs a passphrase, set -passphrase or $" + PassphraseEnv)
+	}
+	w, err := wallet.NewWallet()
+	if err != nil {
+		return err
+	}
+	if *out != "" {
+		if err := w.SaveKeystore(*out, *passphrase); err != nil {
+			return err
+		}
+	}
+	m, err := w.MarshalJSON()
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(stdout, string(m))
+	return err
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"goblockchain/utils"
+	"goblockchain/wallet"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// walletOutput is what the new command prints.
+type walletOutput struct {
+	PrivateKey        string `json:"private_key"`
+	PublicKey         string `json:"public_key"`
+	BlockchainAddress string `json:"blockchain_address"`
+}
+
+func TestNew(t *testing.T) {
+	t.Setenv(PassphraseEnv, "")
+	var out bytes.Buffer
+	if err := run([]string{"new"}, &out); err != nil {
+		t.Fatal(err)
+	}
+	var v walletOutput
+	if err := json.Unmarshal(out.Bytes(), &v); err != nil {
+		t.Fatalf("output %q: %v", out.String(), err)
+	}
+	w, err := wallet.NewWalletFromPrivateKey(v.PrivateKey)
+	if err != nil {
+		t.Fatalf("private key %q: %v", v.PrivateKey, err)
+	}
+	if w.PublicKeyStr() != v.PublicKey || w.BlockchainAddress() != v.BlockchainAddress {
+		t.Fatalf("printed keys and address don't belong together: %s", out.String())
+	}
+	if _, err := utils.PublicKeyFromString(v.PublicKey); err != nil {
+		t.Fatalf("public key %q: %v", v.PublicKey, err)
+	}
+	if !utils.ValidateAddress(v.BlockchainAddress) {
+		t.Fatalf("invalid address %q", v.BlockchainAddress)
+	}
+}
+func TestNewKeystore(t *testing.T) {
+	t.Setenv(PassphraseEnv, "")
+	path := filepath.Join(t.TempDir(), "wallet.json")
+	if err := run([]string{"new", "-out", path}, &bytes.Buffer{}); err == nil || !strings.Contains(err.Error(), "passphrase") {
+		t.Fatalf("-out without a passphrase: got %v", err)
+	}
+	var out bytes.Buffer
+	if err := run([]string{"new", "-out", path, "-passphrase", "secret"}, &out); err != nil {
+		t.Fatal(err)
+	}
+	var v walletOutput
+	if err := json.Unmarshal(out.Bytes(), &v); err != nil {
+		t.Fatal(err)
+	}
+	w, err := wallet.LoadKeystore(path, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w.PrivateKeyStr() != v.PrivateKey || w.BlockchainAddress() != v.BlockchainAddress {
+		t.Fatal("keystore holds a different wallet than the one printed")
+	}
+	if _, err := wallet.LoadKeystore(path, "wrong"); err == nil {
+		t.Fatal("keystore opened with the wrong passphrase")
+	}
+	// The passphrase may also come from the environment.
+	t.Setenv(PassphraseEnv, "from-env")
+	other := filepath.Join(t.TempDir(), "wallet.json")
+	if err := run([]string{"new", "-out", other}, &bytes.Buffer{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := wallet.LoadKeystore(other, "from-env"); err != nil {
+		t.Fatal(err)
+	}
+}
+func TestUnknownCommand(t *testing.T) {
+	for _, args := range [][]string{nil, {"bogus"}} {
+		if err := run(args, &bytes.Buffer{}); err == nil || !strings.Contains(err.Error(), "usage") {
+			t.Errorf("run(%q): got %v, want usage", args, err)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"goblockchain/block"
+	"goblockchain/wallet"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+const DefaultNode = "http://127.0.0.1:5000"
+
+// runSend signs a transaction with the sender's key, taken from -key or
+// from a -keystore file, and POSTs it to the node's /transactions endpoint.
+func runSend(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("send", flag.ContinueOnError)
+	key := fs.String("key", "", "Sender private key in hex")
+	keystore := fs.String("keystore", "", "Read the sender wallet from this encrypted keystore file instead of -key")
+	passphrase := fs.String("passphrase", "", "Keystore passphrase, defaults to $"+PassphraseEnv)
+	recipient := fs.String("to", "", "Recipient blockchain address")
+	value := fs.Float64("value", 0, "Amount to send")
+	fee := fs.Float64("fee", block.MinimumFee, "Fee paid to the miner")
+	locktime := fs.Int64("locktime", 0, "Block height or unix time before which the transaction can't be mined")
+	sequence := fs.Int64("sequence", -1, "Sender's transaction sequence number; by default the node's next expected one")
+	node := fs.String("node", DefaultNode, "Base URL of the node to submit to")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *recipient == "" || *value <= 0 {
+		return errors.New("-to and a positive -value are required")
+	}
+	w, err := senderWallet(*key, *keystore, *passphrase)
+	if err != nil {
+		return err
+	}
+	base := strings.TrimRight(*node, "/")
+	sender := w.BlockchainAddress()
+	seq := uint64(*sequence)
+	if *sequence < 0 {
+		if seq, err = nextSequence(base, sender); err != nil {
+			return err
+		}
+	}
+	value32 := float32(*value)
+	fee32 := float32(*fee)
+	t := wallet.NewTransaction(w.PrivateKey(), w.PublicKey(),
+		sender, *recipient, value32, fee32, *locktime, seq)
+	publicKey := w.PublicKeyStr()
+	signature := t.GenerateSignature().String()
+	m, _ := json.Marshal(&block.TransactionRequest{
+		SenderBlockchainAddress:    &sender,
+		RecipientBlockchainAddress: recipient,
+		SenderPublicKey:            &publicKey,
+		Value:                      &value32,
+		Signature:                  &signature,
+		Fee:                        &fee32,
+		Locktime:                   locktime,
+		Sequence:                   &seq,
+	})
+	resp, err := http.Post(base+"/transactions", "application/json", bytes.NewBuffer(m))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "%s\n%s\n", resp.Status, strings.TrimSpace(string(body)))
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("node rejected the transaction: %s", resp.Status)
+	}
+	return nil
+}
+
+// nextSequence asks the node for the sequence the sender's next
+// transaction must carry.
+func nextSequence(node string, sender string) (uint64, error) {
+	resp, err := http.Get(node + "/sequence?blockchain_address=" + url.QueryEscape(sender))
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("node could not give the next sequence: %s", resp.Status)
+	}
+	var v struct {
+		Sequence uint64 `json:"sequence"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&v); err != nil {
+		return 0, err
+	}
+	return v.Sequence, nil
+}
+func senderWallet(key string, keystore string, passphrase string) (*wallet.Wallet, error) {
+	switch {
+	case key != "" && keystore != "":
+		return nil, errors.New("use either -key or -keystore, not both")
+	case key != "":
+		return wallet.NewWalletFromPrivateKey(key)
+	case keystore != "":
+		if passphrase == "" {
+			passphrase = os.Getenv(PassphraseEnv)
+		}
+		return wallet.LoadKeystore(keystore, passphrase)
+	default:
+		return nil, errors.New("-key or -keystore is required")
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"goblockchain/block"
+	"goblockchain/utils"
+	"goblockchain/wallet"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testNode serves the two endpoints send uses, /sequence and
+// /transactions, in front of a chain that funds alice.
+func testNode(t *testing.T, alice *wallet.Wallet) (*block.Blockchain, *httptest.Server) {
+	t.Helper()
+	bc := block.NewBlockchainWithGenesis("miner", 5000, "", block.GenesisConfig{
+		Allocations: map[string]float32{alice.BlockchainAddress(): 100},
+	})
+	mux := http.NewServeMux()
+	mux.HandleFunc("/sequence", func(w http.ResponseWriter, req *http.Request) {
+		fmt.Fprintf(w, `{"sequence":%d}`, bc.NextSequence(req.URL.Query().Get("blockchain_address")))
+	})
+	mux.HandleFunc("/transactions", func(w http.ResponseWriter, req *http.Request) {
+		var r block.TransactionRequest
+		if err := json.NewDecoder(req.Body).Decode(&r); err != nil || !r.Validate() {
+			http.Error(w, "invalid transaction", http.StatusBadRequest)
+			return
+		}
+		publicKey, err := utils.PublicKeyFromString(*r.SenderPublicKey)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		signature, err := utils.SignatureFromString(*r.Signature)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := bc.AddTransaction(r.Transaction(), publicKey, signature); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		w.Write(utils.JsonStatus("success"))
+	})
+	node := httptest.NewServer(mux)
+	t.Cleanup(node.Close)
+	return bc, node
+}
+func newTestWallet(t *testing.T) *wallet.Wallet {
+	t.Helper()
+	w, err := wallet.NewWallet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return w
+}
+func TestSend(t *testing.T) {
+	alice, bob := newTestWallet(t), newTestWallet(t)
+	bc, node := testNode(t, alice)
+	for i := 0; i < 2; i++ {
+		var out bytes.Buffer
+		err := run([]string{"send", "-key", alice.PrivateKeyStr(), "-to", bob.BlockchainAddress(),
+			"-value", "2.5", "-fee", "0.1", "-node", node.URL + "/"}, &out)
+		if err != nil {
+			t.Fatalf("send %d: %v", i, err)
+		}
+		if !strings.HasPrefix(out.String(), "201 Created") {
+			t.Fatalf("send %d reported %q", i, out.String())
+		}
+	}
+	pool := bc.TransactionPool()
+	if len(pool) != 2 {
+		t.Fatalf("%d pooled transactions, want 2", len(pool))
+	}
+	for i, tx := range pool {
+		var v struct {
+			Sender    string  `json:"sender_blockchain_address"`
+			Recipient string  `json:"recipient_blockchain_address"`
+			Value     float32 `json:"value"`
+		}
+		m, _ := json.Marshal(tx)
+		json.Unmarshal(m, &v)
+		if v.Sender != alice.BlockchainAddress() || v.Recipient != bob.BlockchainAddress() || v.Value != 2.5 || tx.Fee() != 0.1 {
+			t.Fatalf("pooled transaction %d is %s", i, m)
+		}
+		// The sequence is fetched from the node when not given.
+		if tx.Sequence() != uint64(i) {
+			t.Fatalf("transaction %d has sequence %d", i, tx.Sequence())
+		}
+	}
+}
+func TestSendFromKeystore(t *testing.T) {
+	alice, bob := newTestWallet(t), newTestWallet(t)
+	bc, node := testNode(t, alice)
+	path := filepath.Join(t.TempDir(), "alice.json")
+	if err := alice.SaveKeystore(path, "secret"); err != nil {
+		t.Fatal(err)
+	}
+	err := run([]string{"send", "-keystore", path, "-passphrase", "secret", "-to", bob.BlockchainAddress(),
+		"-value", "1", "-sequence", "0", "-node", node.URL}, &bytes.Buffer{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(bc.TransactionPool()); n != 1 {
+		t.Fatalf("%d pooled transactions, want 1", n)
+	}
+}
+func TestSendRejected(t *testing.T) {
+	alice, bob := newTestWallet(t), newTestWallet(t)
+	bc, node := testNode(t, alice)
+	var out bytes.Buffer
+	// More than alice has.
+	err := run([]string{"send", "-key", alice.PrivateKeyStr(), "-to", bob.BlockchainAddress(),
+		"-value", "500", "-node", node.URL}, &out)
+	if err == nil {
+		t.Fatal("rejected transaction reported as sent")
+	}
+	if !strings.HasPrefix(out.String(), "400 Bad Request") {
+		t.Fatalf("reported %q", out.String())
+	}
+	if n := len(bc.TransactionPool()); n != 0 {
+		t.Fatalf("%d pooled transactions, want none", n)
+	}
+}
+func TestSendFlags(t *testing.T) {
+	alice := newTestWallet(t)
+	for _, args := range [][]string{
+		{"-key", alice.PrivateKeyStr(), "-value", "1"},
+		{"-key", alice.PrivateKeyStr(), "-to", alice.BlockchainAddress()},
+		{"-to", alice.BlockchainAddress(), "-value", "1"},
+		{"-key", alice.PrivateKeyStr(), "-keystore", "x.json", "-to", alice.BlockchainAddress(), "-value", "1"},
+	} {
+		if err := run(append([]string{"send"}, args...), &bytes.Buffer{}); err == nil {
+			t.Errorf("send %q accepted", args)
+		}
+	}
+}
@@ -1,8 +1,22 @@
 module goblockchain
 
-go 1.19
+go 1.21
 
 require (
 	github.com/btcsuite/btcutil v1.0.2
+	github.com/prometheus/client_golang v1.14.0
 	golang.org/x/crypto v0.6.0
+	golang.org/x/time v0.3.0
+)
+
+require (
+	github.com/beorn7/perks v1.0.1 // indirect
+	github.com/cespare/xxhash/v2 v2.1.2 // indirect
+	github.com/golang/protobuf v1.5.2 // indirect
+	github.com/matttproud/golang_protobuf_extensions v1.0.1 // indirect
+	github.com/prometheus/client_model v0.3.0 // indirect
+	github.com/prometheus/common v0.37.0 // indirect
+	github.com/prometheus/procfs v0.8.0 // indirect
+	golang.org/x/sys v0.5.0 // indirect
+	google.golang.org/protobuf v1.28.1 // indirect
 )
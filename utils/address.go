@@ -0,0 +1,28 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"github.com/btcsuite/btcutil/base58"
+)
+
+const (
+	addressPayloadLen  = 21
+	addressChecksumLen = 4
+)
+
+// ValidateAddress reports whether addr is a base58 blockchain address whose
+// trailing checksum matches the double SHA-256 of its versioned payload.
+func ValidateAddress(addr string) bool {
+	b := base58.Decode(addr)
+	if len(b) != addressPayloadLen+addressChecksumLen {
+		return false
+	}
+	first := sha256.Sum256(b[:addressPayloadLen])
+	second := sha256.Sum256(first[:])
+	for i := 0; i < addressChecksumLen; i++ {
+		if b[addressPayloadLen+i] != second[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,36 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"github.com/btcsuite/btcutil/base58"
+	"testing"
+)
+
+// testAddress encodes payload as a versioned address with its checksum.
+func testAddress(payload byte) []byte {
+	b := make([]byte, addressPayloadLen, addressPayloadLen+addressChecksumLen)
+	for i := 1; i < addressPayloadLen; i++ {
+		b[i] = payload + byte(i)
+	}
+	first := sha256.Sum256(b)
+	second := sha256.Sum256(first[:])
+	return append(b, second[:addressChecksumLen]...)
+}
+func TestValidateAddress(t *testing.T) {
+	b := testAddress(7)
+	if !ValidateAddress(base58.Encode(b)) {
+		t.Fatal("valid address rejected")
+	}
+	for i := range b {
+		flipped := append([]byte(nil), b...)
+		flipped[i] ^= 0x01
+		if ValidateAddress(base58.Encode(flipped)) {
+			t.Errorf("address with byte %d flipped accepted", i)
+		}
+	}
+	for _, addr := range []string{"", "0OIl0OIl0OIl", base58.Encode(b[:len(b)-1]), base58.Encode(append(b, 0))} {
+		if ValidateAddress(addr) {
+			t.Errorf("%q accepted", addr)
+		}
+	}
+}
@@ -3,7 +3,10 @@ package utils
 import (
 	"crypto/ecdsa"
 	"crypto/elliptic"
+	"crypto/sha256"
+	"encoding/asn1"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"math/big"
 )
@@ -16,22 +19,81 @@ type Signature struct {
 func (s *Signature) String() string {
 	return fmt.Sprintf("%064x%064x", s.R, s.S)
 }
-func SignatureFromString(s string) *Signature {
-	x, y := String2BigIntTuple(s)
-	return &Signature{&x, &y}
+
+// derSignature is the ASN.1 SEQUENCE { r INTEGER, s INTEGER } used by
+// standard ECDSA tooling.
+type derSignature struct {
+	R *big.Int
+	S *big.Int
+}
+
+func (s *Signature) DER() ([]byte, error) {
+	if s.R == nil || s.S == nil {
+		return nil, errors.New("incomplete signature")
+	}
+	return asn1.Marshal(derSignature{R: s.R, S: s.S})
 }
-func String2BigIntTuple(s string) (big.Int, big.Int) {
-	bx, _ := hex.DecodeString(s[:64])
-	by, _ := hex.DecodeString(s[:64])
+func SignatureFromDER(b []byte) (*Signature, error) {
+	var ds derSignature
+	rest, err := asn1.Unmarshal(b, &ds)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) != 0 {
+		return nil, errors.New("trailing data after DER signature")
+	}
+	if ds.R == nil || ds.S == nil || ds.R.Sign() <= 0 || ds.S.Sign() <= 0 {
+		return nil, errors.New("invalid DER signature values")
+	}
+	return &Signature{R: ds.R, S: ds.S}, nil
+}
+
+// VerifyMessage checks sig against the SHA-256 of msg, the same scheme used
+// for transaction signatures.
+func VerifyMessage(publicKey *ecdsa.PublicKey, msg []byte, sig *Signature) bool {
+	if publicKey == nil || sig == nil || sig.R == nil || sig.S == nil {
+		return false
+	}
+	h := sha256.Sum256(msg)
+	return ecdsa.Verify(publicKey, h[:], sig.R, sig.S)
+}
+func SignatureFromString(s string) (*Signature, error) {
+	x, y, err := String2BigIntTuple(s)
+	if err != nil {
+		return nil, err
+	}
+	return &Signature{&x, &y}, nil
+}
+
+// String2BigIntTuple splits a 128 hex digit string into two 256-bit integers.
+func String2BigIntTuple(s string) (big.Int, big.Int, error) {
 	var bix big.Int
 	var biy big.Int
+	if len(s) != 128 {
+		return bix, biy, fmt.Errorf("expected 128 hex digits, got %d", len(s))
+	}
+	bx, err := hex.DecodeString(s[:64])
+	if err != nil {
+		return bix, biy, err
+	}
+	by, err := hex.DecodeString(s[64:])
+	if err != nil {
+		return bix, biy, err
+	}
 	_ = bix.SetBytes(bx)
 	_ = biy.SetBytes(by)
-	return bix, biy
+	return bix, biy, nil
 }
-func PublicKeyFromString(s string) *ecdsa.PublicKey {
-	x, y := String2BigIntTuple(s)
-	return &ecdsa.PublicKey{Curve: elliptic.P256(), X: &x, Y: &y}
+func PublicKeyFromString(s string) (*ecdsa.PublicKey, error) {
+	x, y, err := String2BigIntTuple(s)
+	if err != nil {
+		return nil, err
+	}
+	curve := elliptic.P256()
+	if !curve.IsOnCurve(&x, &y) {
+		return nil, errors.New("public key is not on the P256 curve")
+	}
+	return &ecdsa.PublicKey{Curve: curve, X: &x, Y: &y}, nil
 }
 func PrivateKeyFromString(s string, publicKey *ecdsa.PublicKey) *ecdsa.PrivateKey {
 	b, _ := hex.DecodeString(s[:])
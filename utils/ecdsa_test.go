@@ -0,0 +1,90 @@
+package utils
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"math/big"
+	"strings"
+	"testing"
+)
+
+func TestSignatureDERRoundTrip(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := sha256.Sum256([]byte("message"))
+	r, s, err := ecdsa.Sign(rand.Reader, key, h[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig := &Signature{R: r, S: s}
+	der, err := sig.DER()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ecdsa.VerifyASN1(&key.PublicKey, h[:], der) {
+		t.Fatal("DER signature rejected by the standard library")
+	}
+	decoded, err := SignatureFromDER(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.String() != sig.String() {
+		t.Fatalf("round trip gave %s, want %s", decoded, sig)
+	}
+	if _, err := (&Signature{R: r}).DER(); err == nil {
+		t.Fatal("incomplete signature encoded")
+	}
+}
+func TestSignatureFromMalformedDER(t *testing.T) {
+	valid, _ := (&Signature{R: big.NewInt(1), S: big.NewInt(2)}).DER()
+	zero, _ := (&Signature{R: big.NewInt(0), S: big.NewInt(2)}).DER()
+	for name, b := range map[string][]byte{
+		"empty":     nil,
+		"garbage":   []byte("not a signature"),
+		"truncated": valid[:len(valid)-1],
+		"trailing":  append(append([]byte(nil), valid...), 0),
+		"zero r":    zero,
+		"integer":   {0x02, 0x01, 0x01},
+	} {
+		if _, err := SignatureFromDER(b); err == nil {
+			t.Errorf("%s: decoded without an error", name)
+		}
+	}
+}
+func TestParseMalformedStrings(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicKey := fmt.Sprintf("%064x%064x", key.X, key.Y)
+	if parsed, err := PublicKeyFromString(publicKey); err != nil || !parsed.Equal(&key.PublicKey) {
+		t.Fatalf("valid public key: %v", err)
+	}
+	sig := (&Signature{R: big.NewInt(1), S: big.NewInt(2)}).String()
+	if _, err := SignatureFromString(sig); err != nil {
+		t.Fatalf("valid signature: %v", err)
+	}
+	for name, s := range map[string]string{
+		"empty":     "",
+		"truncated": sig[:100],
+		"odd":       sig[:127],
+		"non-hex":   strings.Repeat("zz", 64),
+		"too long":  sig + "00",
+	} {
+		if _, err := SignatureFromString(s); err == nil {
+			t.Errorf("signature %s: parsed without an error", name)
+		}
+		if _, err := PublicKeyFromString(s); err == nil {
+			t.Errorf("public key %s: parsed without an error", name)
+		}
+	}
+	offCurve := fmt.Sprintf("%064x%064x", key.X, new(big.Int).Add(key.Y, big.NewInt(1)))
+	if _, err := PublicKeyFromString(offCurve); err == nil {
+		t.Fatal("point off the curve accepted")
+	}
+}
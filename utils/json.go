@@ -4,9 +4,24 @@ import "encoding/json"
 
 func JsonStatus(message string) []byte {
 	m, _ := json.Marshal(struct {
-		Message string `json:"message"'`
+		Message string `json:"message"`
 	}{
 		Message: message,
 	})
 	return m
 }
+
+// JsonError is the failure counterpart of JsonStatus. Code identifies the
+// failure for programs and reason explains it for people.
+func JsonError(code int, reason string) []byte {
+	m, _ := json.Marshal(struct {
+		Message string `json:"message"`
+		Code    int    `json:"code"`
+		Reason  string `json:"reason"`
+	}{
+		Message: "fail",
+		Code:    code,
+		Reason:  reason,
+	})
+	return m
+}
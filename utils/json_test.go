@@ -0,0 +1,12 @@
+package utils
+
+import "testing"
+
+func TestJsonError(t *testing.T) {
+	if got, want := string(JsonError(7, "insufficient balance")), `{"message":"fail","code":7,"reason":"insufficient balance"}`; got != want {
+		t.Fatalf("got %s, want %s", got, want)
+	}
+	if got, want := string(JsonStatus("success")), `{"message":"success"}`; got != want {
+		t.Fatalf("got %s, want %s", got, want)
+	}
+}
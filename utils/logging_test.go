@@ -0,0 +1,46 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestNewLoggerLevel(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := NewLogger(&buf, slog.LevelWarn, "json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger.Debug("debug message")
+	logger.Info("info message")
+	logger.Warn("warn message", "peer", "127.0.0.1:5001")
+	logger.Error("error message")
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("logged %d records, want warn and error only: %s", len(lines), buf.String())
+	}
+	var record map[string]any
+	if err := json.Unmarshal([]byte(lines[0]), &record); err != nil {
+		t.Fatal(err)
+	}
+	if record["level"] != "WARN" || record["msg"] != "warn message" || record["peer"] != "127.0.0.1:5001" {
+		t.Fatalf("first record %v, want the warning", record)
+	}
+}
+func TestNewLoggerFormat(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := NewLogger(&buf, slog.LevelInfo, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger.Info("hello", "port", 5000)
+	if got := buf.String(); !strings.Contains(got, "level=INFO") || !strings.Contains(got, "port=5000") {
+		t.Fatalf("text record %q", got)
+	}
+	if _, err := NewLogger(&buf, slog.LevelInfo, "xml"); err == nil {
+		t.Fatal("unknown format accepted")
+	}
+}
@@ -2,6 +2,8 @@ package utils
 
 import (
 	"fmt"
+	"log/slog"
+	"math/big"
 	"net"
 	"os"
 	"regexp"
@@ -9,38 +11,150 @@ import (
 	"time"
 )
 
+// MaxScanHosts bounds how many addresses a CIDR scan may expand to, so a
+// wide IPv6 prefix can't turn into an endless probe.
+const MaxScanHosts = 4096
+
 func IsFoundHost(host string, port uint16) bool {
-	target := fmt.Sprintf("%s:%d", host, port)
-	_, err := net.DialTimeout("tcp", target, 1*time.Second)
+	target := net.JoinHostPort(host, strconv.Itoa(int(port)))
+	conn, err := net.DialTimeout("tcp", target, 1*time.Second)
 	if err != nil {
-		fmt.Printf("%s %v\n", target, err)
+		slog.Debug("host not found", "target", target, "error", err)
 		return false
 	}
+	conn.Close()
 	return true
 }
 
 var PATTERN = regexp.MustCompile(`((25[0-5]|2[0-4][0-9]|[01]?[0-9][0-9]\.){3}(25[0-5]|2[0-4][0-9]|[01]?[0-9][0-9]?))`)
 
+// FindNeighbors probes the hosts whose last address byte is startIp to
+// endIp above myHost's, on every port from startPort to endPort. It works
+// for IPv4 and IPv6 hosts.
 func FindNeighbors(myHost string, myPort uint16, startIp uint8, endIp uint8, startPort uint16, endPort uint16) []string {
-	address := fmt.Sprintf("%s: %d", myHost, myPort)
-	m := PATTERN.FindStringSubmatch(myHost)
-	if m == nil {
+	ip := net.ParseIP(myHost)
+	if ip == nil {
 		return nil
 	}
-	prefixHost := m[1]
-	lastIp, _ := strconv.Atoi(m[len(m)-1])
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	hosts := make([]string, 0)
+	last := int(ip[len(ip)-1])
+	for offset := int(startIp); offset <= int(endIp); offset++ {
+		if last+offset > 255 {
+			break
+		}
+		guess := make(net.IP, len(ip))
+		copy(guess, ip)
+		guess[len(guess)-1] = byte(last + offset)
+		hosts = append(hosts, guess.String())
+	}
+	return FindNeighborsInHosts(hosts, myHost, myPort, startPort, endPort)
+}
+
+// FindNeighborsInCIDR probes every host in cidr on every port from
+// startPort to endPort.
+func FindNeighborsInCIDR(cidr string, myHost string, myPort uint16, startPort uint16, endPort uint16) ([]string, error) {
+	hosts, err := HostsInCIDR(cidr)
+	if err != nil {
+		return nil, err
+	}
+	return FindNeighborsInHosts(hosts, myHost, myPort, startPort, endPort), nil
+}
+
+// FindNeighborsInHosts probes each host on every port from startPort to
+// endPort and returns the host:port pairs that accept a connection.
+// The node itself is never probed, see IsSelf.
+func FindNeighborsInHosts(hosts []string, myHost string, myPort uint16, startPort uint16, endPort uint16) []string {
 	neighbors := make([]string, 0)
-	for port := startPort; port <= endPort; port += 1 {
-		for ip := startIp; ip <= endIp; ip += 1 {
-			guessHost := fmt.Sprintf("%s%d", prefixHost, lastIp+int(ip))
-			guessTarget := fmt.Sprintf("%s:%d", guessHost, port)
-			if guessTarget != address && IsFoundHost(guessHost, port) {
-				neighbors = append(neighbors, guessTarget)
+	for _, host := range hosts {
+		for port := int(startPort); port <= int(endPort); port++ {
+			target := net.JoinHostPort(host, strconv.Itoa(port))
+			if IsSelf(host, uint16(port), myHost, myPort) {
+				continue
+			}
+			if IsFoundHost(host, uint16(port)) {
+				neighbors = append(neighbors, target)
 			}
 		}
 	}
 	return neighbors
 }
+
+// IsSelf reports whether host:port reaches the node listening on myPort at
+// myHost. Besides myHost itself, loopback, unspecified and local interface
+// addresses count as the node, as do names resolving to any of them.
+func IsSelf(host string, port uint16, myHost string, myPort uint16) bool {
+	if port != myPort {
+		return false
+	}
+	if host == myHost {
+		return true
+	}
+	ips := []net.IP{net.ParseIP(host)}
+	if ips[0] == nil {
+		var err error
+		if ips, err = net.LookupIP(host); err != nil {
+			return false
+		}
+	}
+	mine := net.ParseIP(myHost)
+	for _, ip := range ips {
+		if ip.Equal(mine) || ip.IsLoopback() || ip.IsUnspecified() || isLocalIP(ip) {
+			return true
+		}
+	}
+	return false
+}
+func isLocalIP(ip net.IP) bool {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return false
+	}
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// HostsInCIDR lists the addresses in cidr. For IPv4 prefixes shorter than
+// /31 the network and broadcast addresses are left out.
+func HostsInCIDR(cidr string) ([]string, error) {
+	ip, network, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return nil, err
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	ones, bits := network.Mask.Size()
+	if bits-ones > 62 || uint64(1)<<uint(bits-ones) > MaxScanHosts+2 {
+		return nil, fmt.Errorf("%s has more than %d hosts", cidr, MaxScanHosts)
+	}
+	size := uint64(1) << uint(bits-ones)
+	base := new(big.Int).SetBytes(ip.Mask(network.Mask))
+	hosts := make([]string, 0, size)
+	for i := uint64(0); i < size; i++ {
+		if bits == 32 && size > 2 && (i == 0 || i == size-1) {
+			continue
+		}
+		n := new(big.Int).Add(base, new(big.Int).SetUint64(i))
+		hosts = append(hosts, bigToIP(n, bits/8).String())
+	}
+	return hosts, nil
+}
+func bigToIP(n *big.Int, length int) net.IP {
+	b := n.Bytes()
+	ip := make(net.IP, length)
+	copy(ip[length-len(b):], b)
+	if length == net.IPv4len {
+		return net.IPv4(ip[0], ip[1], ip[2], ip[3])
+	}
+	return ip
+}
 func GetHost() string {
 	hostname, err := os.Hostname()
 	if err != nil {
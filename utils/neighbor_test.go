@@ -0,0 +1,104 @@
+package utils
+
+import (
+	"net"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+// listen starts a TCP listener on 127.0.0.1 for the rest of the test and
+// returns its port.
+func listen(t *testing.T) uint16 {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	return uint16(l.Addr().(*net.TCPAddr).Port)
+}
+func TestHostsInCIDR(t *testing.T) {
+	for _, c := range []struct {
+		cidr string
+		want []string
+	}{
+		{"192.168.1.4/30", []string{"192.168.1.5", "192.168.1.6"}},
+		{"192.168.1.7/30", []string{"192.168.1.5", "192.168.1.6"}},
+		{"10.0.0.0/31", []string{"10.0.0.0", "10.0.0.1"}},
+		{"10.0.0.9/32", []string{"10.0.0.9"}},
+		{"fd00::/126", []string{"fd00::", "fd00::1", "fd00::2", "fd00::3"}},
+		{"::1/128", []string{"::1"}},
+	} {
+		got, err := HostsInCIDR(c.cidr)
+		if err != nil {
+			t.Errorf("%s: %v", c.cidr, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: got %v, want %v", c.cidr, got, c.want)
+		}
+	}
+	for _, cidr := range []string{"10.0.0.0/8", "fd00::/64", "10.0.0.0", "not a cidr"} {
+		if _, err := HostsInCIDR(cidr); err == nil {
+			t.Errorf("%s accepted", cidr)
+		}
+	}
+}
+func TestFindNeighborsInCIDR(t *testing.T) {
+	port := listen(t)
+	got, err := FindNeighborsInCIDR("127.0.0.0/30", "10.0.0.1", 5000, port, port)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{net.JoinHostPort("127.0.0.1", strconv.Itoa(int(port)))}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	if _, err := FindNeighborsInCIDR("10.0.0.0/8", "10.0.0.1", 5000, port, port); err == nil {
+		t.Fatal("oversized range scanned")
+	}
+}
+func TestFindNeighborsInHosts(t *testing.T) {
+	port := listen(t)
+	got := FindNeighborsInHosts([]string{"127.0.0.2", "127.0.0.1"}, "10.0.0.1", 5000, port, port)
+	want := []string{net.JoinHostPort("127.0.0.1", strconv.Itoa(int(port)))}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	// The node's own address is skipped even though it is listening.
+	if got := FindNeighborsInHosts([]string{"127.0.0.1"}, "127.0.0.1", port, port, port); len(got) != 0 {
+		t.Fatalf("own address found: %v", got)
+	}
+}
+func TestIsSelf(t *testing.T) {
+	for _, c := range []struct {
+		host string
+		port uint16
+		want bool
+	}{
+		{"192.0.2.10", 5000, true},
+		{"127.0.0.1", 5000, true},
+		{"localhost", 5000, true},
+		{"0.0.0.0", 5000, true},
+		{"::1", 5000, true},
+		{"192.0.2.10", 5001, false},
+		{"192.0.2.11", 5000, false},
+	} {
+		if got := IsSelf(c.host, c.port, "192.0.2.10", 5000); got != c.want {
+			t.Errorf("IsSelf(%s, %d): got %v, want %v", c.host, c.port, got, c.want)
+		}
+	}
+}
+func TestFindNeighborsSkipsSelf(t *testing.T) {
+	port := listen(t)
+	address := net.JoinHostPort("127.0.0.1", strconv.Itoa(int(port)))
+	// Seen from another port the listener is a neighbor.
+	if got := FindNeighbors("127.0.0.1", port+1, 0, 1, port, port); !reflect.DeepEqual(got, []string{address}) {
+		t.Fatalf("got %v, want %s", got, address)
+	}
+	// The scan covers our host and port, which we are listening on.
+	if got := FindNeighbors("127.0.0.1", port, 0, 1, port, port); len(got) != 0 {
+		t.Fatalf("own address found: %v", got)
+	}
+}
@@ -0,0 +1,128 @@
+package wallet
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/scrypt"
+	"io"
+	"os"
+)
+
+const KeystoreVersion = 1
+
+// scrypt parameters for deriving the keystore encryption key.
+const (
+	scryptN      = 1 << 15
+	scryptR      = 8
+	scryptP      = 1
+	scryptKeyLen = 32
+)
+
+var ErrWrongPassphrase = errors.New("wrong passphrase or corrupted keystore")
+
+// keystoreFile is the on-disk format. Only the private key is encrypted;
+// the address is stored in clear so a keystore can be identified without
+// the passphrase.
+type keystoreFile struct {
+	Version           int    `json:"version"`
+	BlockchainAddress string `json:"blockchain_address"`
+	Salt              string `json:"salt"`
+	Nonce             string `json:"nonce"`
+	Ciphertext        string `json:"ciphertext"`
+}
+
+func keystoreCipher(passphrase string, salt []byte) (cipher.AEAD, error) {
+	key, err := scrypt.Key([]byte(passphrase), salt, scryptN, scryptR, scryptP, scryptKeyLen)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// SaveKeystore writes the wallet's private key to path, encrypted with
+// AES-GCM under a key derived from passphrase with scrypt.
+func (w *Wallet) SaveKeystore(path string, passphrase string) error {
+	salt := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return err
+	}
+	aead, err := keystoreCipher(passphrase, salt)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return err
+	}
+	d := make([]byte, 32)
+	w.privateKey.D.FillBytes(d)
+	ks := keystoreFile{
+		Version:           KeystoreVersion,
+		BlockchainAddress: w.BlockchainAddress(),
+		Salt:              hex.EncodeToString(salt),
+		Nonce:             hex.EncodeToString(nonce),
+		Ciphertext:        hex.EncodeToString(aead.Seal(nil, nonce, d, []byte(w.BlockchainAddress()))),
+	}
+	m, err := json.Marshal(ks)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, m, 0600)
+}
+
+// LoadKeystore decrypts a keystore written by SaveKeystore and rebuilds the
+// wallet, including its blockchain address.
+func LoadKeystore(path string, passphrase string) (*Wallet, error) {
+	m, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var ks keystoreFile
+	if err := json.Unmarshal(m, &ks); err != nil {
+		return nil, err
+	}
+	if ks.Version != KeystoreVersion {
+		return nil, fmt.Errorf("unsupported keystore version %d", ks.Version)
+	}
+	salt, err := hex.DecodeString(ks.Salt)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := hex.DecodeString(ks.Nonce)
+	if err != nil {
+		return nil, err
+	}
+	ciphertext, err := hex.DecodeString(ks.Ciphertext)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := keystoreCipher(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	if len(nonce) != aead.NonceSize() {
+		return nil, ErrWrongPassphrase
+	}
+	d, err := aead.Open(nil, nonce, ciphertext, []byte(ks.BlockchainAddress))
+	if err != nil {
+		return nil, ErrWrongPassphrase
+	}
+	privateKey, err := privateKeyFromBytes(d)
+	if err != nil {
+		return nil, err
+	}
+	w := newWallet(privateKey)
+	if w.BlockchainAddress() != ks.BlockchainAddress {
+		return nil, errors.New("keystore address does not match its key")
+	}
+	return w, nil
+}
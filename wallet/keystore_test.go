@@ -0,0 +1,63 @@
+package wallet
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestKeystoreRoundTrip(t *testing.T) {
+	w, err := NewWallet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "wallet.json")
+	if err := w.SaveKeystore(path, "correct horse"); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(data, []byte(w.PrivateKeyStr())) {
+		t.Fatal("private key stored in clear")
+	}
+	loaded, err := LoadKeystore(path, "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.PrivateKeyStr() != w.PrivateKeyStr() || loaded.BlockchainAddress() != w.BlockchainAddress() {
+		t.Fatal("loaded wallet differs from the saved one")
+	}
+	if _, err := LoadKeystore(path, "wrong horse"); !errors.Is(err, ErrWrongPassphrase) {
+		t.Fatalf("wrong passphrase: got %v, want %v", err, ErrWrongPassphrase)
+	}
+}
+func TestKeystoreAddressTampered(t *testing.T) {
+	w, err := NewWallet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := NewWallet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "wallet.json")
+	if err := w.SaveKeystore(path, "pass"); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(path)
+	var ks keystoreFile
+	if err := json.Unmarshal(data, &ks); err != nil {
+		t.Fatal(err)
+	}
+	ks.BlockchainAddress = other.BlockchainAddress()
+	data, _ = json.Marshal(ks)
+	os.WriteFile(path, data, 0600)
+	if _, err := LoadKeystore(path, "pass"); !errors.Is(err, ErrWrongPassphrase) {
+		t.Fatalf("tampered address: got %v, want %v", err, ErrWrongPassphrase)
+	}
+}
@@ -5,11 +5,15 @@ import (
 	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/btcsuite/btcutil/base58"
 	"goblockchain/utils"
 	"golang.org/x/crypto/ripemd160"
+	"io"
+	"math/big"
 )
 
 type Wallet struct {
@@ -18,10 +22,44 @@ type Wallet struct {
 	blockChainAddress string
 }
 
-func NewWallet() *Wallet {
+func NewWallet() (*Wallet, error) {
+	return NewWalletWithRand(rand.Reader)
+}
+
+// NewWalletWithRand makes a wallet whose key is drawn from r. The same
+// bytes always give the same key; ecdsa.GenerateKey doesn't promise that.
+func NewWalletWithRand(r io.Reader) (*Wallet, error) {
 	//1. Creating ECDSA private key (32 bytes) public key (64 bytes)
+	d := make([]byte, 32)
+	for {
+		if _, err := io.ReadFull(r, d); err != nil {
+			return nil, err
+		}
+		// Retrying out-of-range draws keeps the key uniform.
+		if privateKey, err := privateKeyFromBytes(d); err == nil {
+			return newWallet(privateKey), nil
+		}
+	}
+}
+
+// NewWalletFromPrivateKey restores a wallet from the hex string returned by
+// PrivateKeyStr.
+func NewWalletFromPrivateKey(hexKey string) (*Wallet, error) {
+	d, err := hex.DecodeString(hexKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(d) == 0 || len(d) > 32 {
+		return nil, fmt.Errorf("invalid private key length %d", len(d))
+	}
+	privateKey, err := privateKeyFromBytes(d)
+	if err != nil {
+		return nil, err
+	}
+	return newWallet(privateKey), nil
+}
+func newWallet(privateKey *ecdsa.PrivateKey) *Wallet {
 	w := new(Wallet)
-	privateKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
 	w.privateKey = privateKey
 	w.publicKey = &w.privateKey.PublicKey
 	//2. Perform SHA-256 hashing on the public key (32 bytes)
@@ -46,7 +84,8 @@ func NewWallet() *Wallet {
 	h6.Write(digit2)
 	digit3 := h6.Sum(nil)
 	//7.Take the fist 4 byte of the second SHA-256 hash of checksum
-	chsum := digit3[:6]
+	chsum := digit3[:4]
+	//8. Add the 4 checksum bytes at the end of extended RIPEMD-160 hash (21 + 4 = 25 bytes)
 	dc8 := make([]byte, 25)
 	copy(dc8[:21], vd4[:])
 	copy(dc8[21:], chsum[:])
@@ -55,6 +94,20 @@ func NewWallet() *Wallet {
 	w.blockChainAddress = address
 	return w
 }
+
+// privateKeyFromBytes rebuilds a P256 private key, and its public half, from
+// the raw scalar.
+func privateKeyFromBytes(d []byte) (*ecdsa.PrivateKey, error) {
+	curve := elliptic.P256()
+	k := new(big.Int).SetBytes(d)
+	if k.Sign() == 0 || k.Cmp(curve.Params().N) >= 0 {
+		return nil, errors.New("private key out of range")
+	}
+	privateKey := &ecdsa.PrivateKey{D: k}
+	privateKey.PublicKey.Curve = curve
+	privateKey.PublicKey.X, privateKey.PublicKey.Y = curve.ScalarBaseMult(k.Bytes())
+	return privateKey, nil
+}
 func (w *Wallet) PrivateKey() *ecdsa.PrivateKey {
 	return w.privateKey
 }
@@ -70,6 +123,17 @@ func (w *Wallet) PublicKeyStr() string {
 func (w *Wallet) BlockchainAddress() string {
 	return w.blockChainAddress
 }
+
+// SignMessage signs the SHA-256 of msg, for example to prove ownership of
+// the wallet's address. Verify it with utils.VerifyMessage.
+func (w *Wallet) SignMessage(msg []byte) (*utils.Signature, error) {
+	h := sha256.Sum256(msg)
+	r, s, err := ecdsa.Sign(rand.Reader, w.privateKey, h[:])
+	if err != nil {
+		return nil, err
+	}
+	return &utils.Signature{R: r, S: s}, nil
+}
 func (w *Wallet) MarshalJSON() ([]byte, error) {
 	return json.Marshal(struct {
 		PrivateKey        string `json:"private_key"`
@@ -88,15 +152,21 @@ type Transaction struct {
 	senderBlockchainAddress    string
 	recipientBlockchainAddress string
 	value                      float32
+	fee                        float32
+	locktime                   int64
+	sequence                   uint64
 }
 
-func NewTransaction(privateKey *ecdsa.PrivateKey, publicKey *ecdsa.PublicKey, sender string, recipient string, value float32) *Transaction {
+func NewTransaction(privateKey *ecdsa.PrivateKey, publicKey *ecdsa.PublicKey, sender string, recipient string, value float32, fee float32, locktime int64, sequence uint64) *Transaction {
 	return &Transaction{
 		senderPrivateKey:           privateKey,
 		senderPublicKey:            publicKey,
 		senderBlockchainAddress:    sender,
 		recipientBlockchainAddress: recipient,
-		value:                      value}
+		value:                      value,
+		fee:                        fee,
+		locktime:                   locktime,
+		sequence:                   sequence}
 }
 func (t *Transaction) GenerateSignature() *utils.Signature {
 	m, _ := json.Marshal(t)
@@ -104,15 +174,21 @@ func (t *Transaction) GenerateSignature() *utils.Signature {
 	r, s, _ := ecdsa.Sign(rand.Reader, t.senderPrivateKey, h[:])
 	return &utils.Signature{R: r, S: s}
 }
-func (t *Transaction) MarshaJSON() ([]byte, error) {
+func (t *Transaction) MarshalJSON() ([]byte, error) {
 	return json.Marshal(struct {
 		Sender    string  `json:"sender_blockchain_address"`
 		Recipient string  `json:"recipient_blockchain_address"`
 		Value     float32 `json:"value"`
+		Fee       float32 `json:"fee"`
+		Locktime  int64   `json:"locktime"`
+		Sequence  uint64  `json:"sequence,omitempty"`
 	}{
 		Sender:    t.senderBlockchainAddress,
 		Recipient: t.recipientBlockchainAddress,
 		Value:     t.value,
+		Fee:       t.fee,
+		Locktime:  t.locktime,
+		Sequence:  t.sequence,
 	})
 }
 
@@ -122,6 +198,9 @@ type TransactionRequest struct {
 	RecipientBlockchainAddress *string `json:"recipient_blockchain_address"`
 	SenderPublicKey            *string `json:"sender_public_key"`
 	Value                      *string `json:"value"`
+	Fee                        *string `json:"fee,omitempty"`
+	Locktime                   *string `json:"locktime,omitempty"`
+	Sequence                   *string `json:"sequence,omitempty"`
 }
 
 func (tr *TransactionRequest) Validate() bool {
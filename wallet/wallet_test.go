@@ -0,0 +1,165 @@
+package wallet
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"github.com/btcsuite/btcutil/base58"
+	"goblockchain/utils"
+	"golang.org/x/crypto/ripemd160"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestNewWalletWithRandDeterministic(t *testing.T) {
+	a, err := NewWalletWithRand(rand.New(rand.NewSource(1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := NewWalletWithRand(rand.New(rand.NewSource(1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.PrivateKeyStr() != b.PrivateKeyStr() || a.BlockchainAddress() != b.BlockchainAddress() {
+		t.Fatal("same random bytes gave different keys")
+	}
+	c, _ := NewWalletWithRand(rand.New(rand.NewSource(2)))
+	if c.PrivateKeyStr() == a.PrivateKeyStr() {
+		t.Fatal("different random bytes gave the same key")
+	}
+}
+func TestNewWalletWithRandRejectsOutOfRange(t *testing.T) {
+	// All ones is above the curve order and must be skipped.
+	r := bytes.NewReader(append(bytes.Repeat([]byte{0xff}, 32), bytes.Repeat([]byte{0x01}, 32)...))
+	w, err := NewWalletWithRand(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := w.PrivateKeyStr(), "0101010101010101010101010101010101010101010101010101010101010101"; got != want {
+		t.Fatalf("private key %s, want %s", got, want)
+	}
+}
+
+type failingReader struct{}
+
+func (failingReader) Read([]byte) (int, error) {
+	return 0, errors.New("entropy source failed")
+}
+func TestNewWalletWithRandError(t *testing.T) {
+	w, err := NewWalletWithRand(failingReader{})
+	if err == nil {
+		t.Fatal("no error from a failing reader")
+	}
+	if w != nil {
+		t.Fatal("wallet returned along with an error")
+	}
+	// A short read is as much a failure as an error.
+	if _, err := NewWalletWithRand(bytes.NewReader(make([]byte, 16))); err == nil {
+		t.Fatal("no error from a short reader")
+	}
+}
+func TestTransactionSignsItsFields(t *testing.T) {
+	w, err := NewWallet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest := func(tx *Transaction) [32]byte {
+		m, err := json.Marshal(tx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return sha256.Sum256(m)
+	}
+	one := NewTransaction(w.PrivateKey(), w.PublicKey(), w.BlockchainAddress(), "recipient", 1, 0, 0, 0)
+	two := NewTransaction(w.PrivateKey(), w.PublicKey(), w.BlockchainAddress(), "recipient", 2, 0, 0, 0)
+	if digest(one) == digest(two) {
+		t.Fatal("transactions with different values have the same digest")
+	}
+	s := one.GenerateSignature()
+	h := digest(one)
+	if !ecdsa.Verify(w.PublicKey(), h[:], s.R, s.S) {
+		t.Fatal("signature does not verify")
+	}
+	h = digest(two)
+	if ecdsa.Verify(w.PublicKey(), h[:], s.R, s.S) {
+		t.Fatal("signature verifies for a different value")
+	}
+}
+func TestNewWalletFromPrivateKey(t *testing.T) {
+	w, err := NewWallet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	restored, err := NewWalletFromPrivateKey(w.PrivateKeyStr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restored.BlockchainAddress() != w.BlockchainAddress() || restored.PublicKeyStr() != w.PublicKeyStr() {
+		t.Fatal("restored wallet differs from the original")
+	}
+	for _, key := range []string{"", "zz", "00", strings.Repeat("ff", 32), strings.Repeat("01", 33)} {
+		if _, err := NewWalletFromPrivateKey(key); err == nil {
+			t.Errorf("key %q accepted", key)
+		}
+	}
+}
+func TestAddressChecksum(t *testing.T) {
+	w, err := NewWallet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := base58.Decode(w.BlockchainAddress())
+	if len(b) != 25 {
+		t.Fatalf("address decodes to %d bytes, want 25", len(b))
+	}
+	first := sha256.Sum256(b[:21])
+	second := sha256.Sum256(first[:])
+	if !bytes.Equal(b[21:], second[:4]) {
+		t.Fatalf("checksum %x, want %x", b[21:], second[:4])
+	}
+	h := sha256.New()
+	h.Write(w.PublicKey().X.Bytes())
+	h.Write(w.PublicKey().Y.Bytes())
+	r := ripemd160.New()
+	r.Write(h.Sum(nil))
+	if b[0] != 0x00 || !bytes.Equal(b[1:21], r.Sum(nil)) {
+		t.Fatal("payload is not the version byte and the public key hash")
+	}
+	if !utils.ValidateAddress(w.BlockchainAddress()) {
+		t.Fatal("generated address fails validation")
+	}
+}
+func TestSignMessage(t *testing.T) {
+	w, err := NewWallet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := NewWallet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := []byte("prove you own this address: 1234")
+	s, err := w.SignMessage(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !utils.VerifyMessage(w.PublicKey(), msg, s) {
+		t.Fatal("valid signature rejected")
+	}
+	if utils.VerifyMessage(w.PublicKey(), []byte("prove you own this address: 1235"), s) {
+		t.Fatal("signature verifies a tampered message")
+	}
+	forged, err := other.SignMessage(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if utils.VerifyMessage(w.PublicKey(), msg, forged) {
+		t.Fatal("signature from another key accepted")
+	}
+	if utils.VerifyMessage(w.PublicKey(), msg, nil) {
+		t.Fatal("missing signature accepted")
+	}
+}
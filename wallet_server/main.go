@@ -2,16 +2,25 @@ package main
 
 import (
 	"flag"
-	"log"
+	"fmt"
+	"goblockchain/utils"
+	"log/slog"
+	"os"
 )
 
-func init() {
-	log.SetPrefix("Wallet Server:")
-}
 func main() {
 	port := flag.Uint("port", 8080, "TCP Port Number for Wallet Server")
 	gateway := flag.String("gateway", "http://127.0.0.1:5002", "Blockchain Gateway")
+	logLevel := slog.LevelInfo
+	flag.TextVar(&logLevel, "log-level", slog.LevelInfo, "Lowest level logged: debug, info, warn or error")
+	logFormat := flag.String("log-format", "text", "Log output format: text or json")
 	flag.Parse()
+	logger, err := utils.NewLogger(os.Stderr, logLevel, *logFormat)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	slog.SetDefault(logger.With("app", "wallet"))
 	app := NewWalletServer(uint16(*port), *gateway)
 	app.Run()
 }
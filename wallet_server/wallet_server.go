@@ -9,8 +9,10 @@ import (
 	"goblockchain/wallet"
 	"html/template"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
+	"net/url"
+	"os"
 	"path"
 	"strconv"
 )
@@ -37,19 +39,25 @@ func (ws *WalletServer) Index(w http.ResponseWriter, req *http.Request) {
 		t, _ := template.ParseFiles(path.Join(tempDir, "index.html"))
 		t.Execute(w, "")
 	default:
-		log.Printf("ERROR: Invalid HTTP Method")
+		slog.Warn("invalid HTTP method", "method", req.Method, "path", req.URL.Path)
 	}
 }
 func (ws *WalletServer) Wallet(w http.ResponseWriter, req *http.Request) {
 	switch req.Method {
 	case http.MethodPost:
+		myWallet, err := wallet.NewWallet()
+		if err != nil {
+			slog.Error("creating wallet failed", "error", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			io.WriteString(w, string(utils.JsonStatus("fail")))
+			return
+		}
 		w.Header().Add("Content-Type", "application/json")
-		myWallet := wallet.NewWallet()
 		m, _ := myWallet.MarshalJSON()
 		io.WriteString(w, string(m[:]))
 	default:
 		w.WriteHeader(http.StatusBadRequest)
-		log.Println("ERROR: Invalid HTTP Method")
+		slog.Warn("invalid HTTP method", "method", req.Method, "path", req.URL.Path)
 	}
 }
 func (ws *WalletServer) CreateTransaction(w http.ResponseWriter, req *http.Request) {
@@ -59,26 +67,61 @@ func (ws *WalletServer) CreateTransaction(w http.ResponseWriter, req *http.Reque
 		decoder := json.NewDecoder(req.Body)
 		err := decoder.Decode(&t)
 		if err != nil {
-			log.Printf("ERROR: %v", err)
+			slog.Warn("decoding transaction request failed", "error", err)
 			io.WriteString(w, string(utils.JsonStatus("fail")))
 		}
 		if !t.Validate() {
-			log.Println("ERROR: missing field(s)")
+			slog.Warn("transaction request is missing fields")
+			io.WriteString(w, string(utils.JsonStatus("fail")))
+			return
+		}
+		publicKey, err := utils.PublicKeyFromString(*t.SenderPublicKey)
+		if err != nil {
+			slog.Warn("invalid sender public key", "error", err)
 			io.WriteString(w, string(utils.JsonStatus("fail")))
 			return
 		}
-		publicKey := utils.PublicKeyFromString(*t.SenderPublicKey)
 		privateKey := utils.PrivateKeyFromString(*t.SenderPrivateKey, publicKey)
 		Value, err := strconv.ParseFloat(*t.Value, 32)
 		if err != nil {
-			log.Println("ERROR: parse error")
+			slog.Warn("parsing transaction request failed", "error", err)
 			io.WriteString(w, string(utils.JsonStatus("fail")))
 			return
 		}
 		value32 := float32(Value)
+		var fee32 float32
+		if t.Fee != nil && *t.Fee != "" {
+			fee, err := strconv.ParseFloat(*t.Fee, 32)
+			if err != nil {
+				slog.Warn("parsing transaction request failed", "error", err)
+				io.WriteString(w, string(utils.JsonStatus("fail")))
+				return
+			}
+			fee32 = float32(fee)
+		}
+		var locktime int64
+		if t.Locktime != nil && *t.Locktime != "" {
+			locktime, err = strconv.ParseInt(*t.Locktime, 10, 64)
+			if err != nil {
+				slog.Warn("parsing transaction request failed", "error", err)
+				io.WriteString(w, string(utils.JsonStatus("fail")))
+				return
+			}
+		}
+		var sequence uint64
+		if t.Sequence != nil && *t.Sequence != "" {
+			sequence, err = strconv.ParseUint(*t.Sequence, 10, 64)
+		} else {
+			sequence, err = ws.nextSequence(*t.SenderBlockchainAddress)
+		}
+		if err != nil {
+			slog.Warn("getting transaction sequence failed", "error", err)
+			io.WriteString(w, string(utils.JsonStatus("fail")))
+			return
+		}
 		w.Header().Add("Content-Type", "application/json")
 		transaction := wallet.NewTransaction(privateKey, publicKey,
-			*t.SenderBlockchainAddress, *t.RecipientBlockchainAddress, value32)
+			*t.SenderBlockchainAddress, *t.RecipientBlockchainAddress, value32, fee32, locktime, sequence)
 		signature := transaction.GenerateSignature()
 		signatureStr := signature.String()
 		bt := &block.TransactionRequest{
@@ -87,6 +130,9 @@ func (ws *WalletServer) CreateTransaction(w http.ResponseWriter, req *http.Reque
 			SenderPublicKey:            t.SenderPublicKey,
 			Value:                      &value32,
 			Signature:                  &signatureStr,
+			Fee:                        &fee32,
+			Locktime:                   &locktime,
+			Sequence:                   &sequence,
 		}
 		m, _ := json.Marshal(bt)
 		buf := bytes.NewBuffer(m)
@@ -102,10 +148,28 @@ func (ws *WalletServer) CreateTransaction(w http.ResponseWriter, req *http.Reque
 		}
 		io.WriteString(w, string(utils.JsonStatus("fail")))
 	default:
-		log.Println("ERROR: Invalid HTTP Method")
+		slog.Warn("invalid HTTP method", "method", req.Method, "path", req.URL.Path)
 		w.WriteHeader(http.StatusBadRequest)
 	}
 }
+
+// nextSequence asks the gateway for the sequence the sender's next
+// transaction must carry.
+func (ws *WalletServer) nextSequence(blockchainAddress string) (uint64, error) {
+	resp, err := http.Get(ws.Gateway() + "/sequence?blockchain_address=" + url.QueryEscape(blockchainAddress))
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("gateway could not give the next sequence: %s", resp.Status)
+	}
+	var v struct {
+		Sequence uint64 `json:"sequence"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&v)
+	return v.Sequence, err
+}
 func (ws *WalletServer) WalletAmount(w http.ResponseWriter, req *http.Request) {
 	switch req.Method {
 	case http.MethodGet:
@@ -118,7 +182,7 @@ func (ws *WalletServer) WalletAmount(w http.ResponseWriter, req *http.Request) {
 		bcsReq.URL.RawQuery = q.Encode()
 		bcsResp, err := client.Do(bcsReq)
 		if err != nil {
-			log.Printf("ERROR: %v", err)
+			slog.Error("gateway request failed", "gateway", ws.Gateway(), "error", err)
 			io.WriteString(w, string(utils.JsonStatus("fail")))
 		}
 		w.Header().Add("Content-Type", "application/type")
@@ -127,7 +191,7 @@ func (ws *WalletServer) WalletAmount(w http.ResponseWriter, req *http.Request) {
 			var bar *block.AmountResponse
 			err := decode.Decode(&bar)
 			if err != nil {
-				log.Printf("ERROR: %v", err)
+				slog.Error("decoding gateway response failed", "error", err)
 				io.WriteString(w, string(utils.JsonStatus("fail")))
 			}
 			m, _ := json.Marshal(struct {
@@ -142,7 +206,7 @@ func (ws *WalletServer) WalletAmount(w http.ResponseWriter, req *http.Request) {
 			io.WriteString(w, string(utils.JsonStatus("fail")))
 		}
 	default:
-		log.Println("ERROR: Invalid HTTP Method")
+		slog.Warn("invalid HTTP method", "method", req.Method, "path", req.URL.Path)
 		w.WriteHeader(http.StatusBadRequest)
 	}
 }
@@ -151,5 +215,7 @@ func (ws *WalletServer) Run() {
 	http.HandleFunc("/wallet", ws.Wallet)
 	http.HandleFunc("/wallet/amount", ws.WalletAmount)
 	http.HandleFunc("/transaction", ws.CreateTransaction)
-	log.Fatal(http.ListenAndServe("0.0.0.0:"+strconv.Itoa(int(ws.Port())), nil))
+	err := http.ListenAndServe("0.0.0.0:"+strconv.Itoa(int(ws.Port())), nil)
+	slog.Error("server stopped", "error", err)
+	os.Exit(1)
 }